@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"muvtuberdriver/persona"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+// AdminServer listen addr, serves the admin API to manage the driver at runtime:
+//
+//	GET  /persona         -> { "active": "name", "personas": [...] }
+//	POST /persona/switch  <- { "name": "catgirl" }
+//	POST /persona/reload  (re-read the persona dir)
+//
+// Requests should carry "Authorization: Bearer <token>" if token is not
+// empty. personas is nil if the persona is disabled: the /persona routes
+// respond 404 then.
+func AdminServer(addr string, token string, personas *persona.Manager) {
+	// no logger
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(adminAuth(token))
+
+	p := r.Group("/persona", func(c *gin.Context) {
+		if personas == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "persona is disabled"})
+		}
+	})
+
+	p.GET("", func(c *gin.Context) {
+		active := ""
+		if a := personas.Active(); a != nil {
+			active = a.Name
+		}
+		c.JSON(http.StatusOK, gin.H{"active": active, "personas": personas.List()})
+	})
+
+	p.POST("/switch", func(c *gin.Context) {
+		var req struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Info("[AdminServer] switch persona.", "name", req.Name, "remote", c.ClientIP())
+
+		err := personas.Switch(req.Name)
+		switch {
+		case errors.Is(err, persona.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil: // switched, but some components failed to apply it
+			c.JSON(http.StatusInternalServerError, gin.H{"active": req.Name, "error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "active": req.Name})
+		}
+	})
+
+	p.POST("/reload", func(c *gin.Context) {
+		slog.Info("[AdminServer] reload personas.", "remote", c.ClientIP())
+		if err := personas.Reload(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "personas": len(personas.List())})
+	})
+
+	if err := r.Run(addr); err != nil {
+		slog.Error("[AdminServer] stopped.", "addr", addr, "err", err)
+	}
+}
+
+// adminAuth checks the bearer token. Empty token for no check.
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/bililive"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// bilibili live commands
+const (
+	bilibiliCmdDanmu           = "DANMU_MSG"
+	bilibiliCmdGift            = "SEND_GIFT"
+	bilibiliCmdGuardBuy        = "GUARD_BUY"
+	bilibiliCmdSuperChat       = "SUPER_CHAT_MESSAGE"
+	bilibiliCmdSuperChatDelete = "SUPER_CHAT_MESSAGE_DELETE"
+)
+
+// bilibiliDanmuToTextMessage decodes a DANMU_MSG into textMessageData.
+//
+//	{"cmd": "DANMU_MSG", "info": [[meta...], content, [uid, uname, isAdmin, ...], [medalLevel, ...], [userLevel, ...], ...]}
+func bilibiliDanmuToTextMessage(raw json.RawMessage) (*textMessageData, error) {
+	var msg struct {
+		Info []json.RawMessage `json:"info"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	if len(msg.Info) < 5 {
+		return nil, fmt.Errorf("DANMU_MSG: unexpected info length: %d", len(msg.Info))
+	}
+
+	var tmd textMessageData
+
+	if err := json.Unmarshal(msg.Info[1], &tmd.Content); err != nil {
+		return nil, fmt.Errorf("DANMU_MSG: content: %w", err)
+	}
+
+	var user []any // [uid, uname, isAdmin, ...]
+	if err := json.Unmarshal(msg.Info[2], &user); err != nil || len(user) < 3 {
+		return nil, fmt.Errorf("DANMU_MSG: user: %v", user)
+	}
+	tmd.AuthorName, _ = user[1].(string)
+	if isAdmin, _ := user[2].(float64); isAdmin != 0 {
+		tmd.AuthorType = 2 // blivechat: 0 normal, 1 guard, 2 admin, 3 streamer
+	}
+
+	var medal []any // [level, name, ...] or []
+	if json.Unmarshal(msg.Info[3], &medal) == nil && len(medal) > 0 {
+		level, _ := medal[0].(float64)
+		tmd.MedalLevel = int64(level)
+	}
+
+	var level []any // [level, ...]
+	if json.Unmarshal(msg.Info[4], &level) == nil && len(level) > 0 {
+		l, _ := level[0].(float64)
+		tmd.AuthorLevel = int64(l)
+	}
+
+	return &tmd, nil
+}
+
+// bilibiliGiftToGiftMessage decodes a SEND_GIFT into giftMessageData.
+// Only gold (paid) coins are counted into the TotalCoin.
+func bilibiliGiftToGiftMessage(raw json.RawMessage) (*giftMessageData, error) {
+	var msg struct {
+		Data struct {
+			Uname     string `json:"uname"`
+			GiftName  string `json:"giftName"`
+			Num       int64  `json:"num"`
+			CoinType  string `json:"coin_type"`
+			TotalCoin int64  `json:"total_coin"`
+			Timestamp int64  `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	gift := &giftMessageData{
+		Timestamp:  msg.Data.Timestamp,
+		AuthorName: msg.Data.Uname,
+		GiftName:   msg.Data.GiftName,
+		Num:        msg.Data.Num,
+	}
+	if msg.Data.CoinType == "gold" {
+		gift.TotalCoin = msg.Data.TotalCoin
+	}
+	return gift, nil
+}
+
+// bilibiliGuardBuyToMemberMessage decodes a GUARD_BUY into memberMessageData.
+func bilibiliGuardBuyToMemberMessage(raw json.RawMessage) (*memberMessageData, error) {
+	var msg struct {
+		Data struct {
+			Username   string `json:"username"`
+			GuardLevel int64  `json:"guard_level"`
+			StartTime  int64  `json:"start_time"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	return &memberMessageData{
+		Timestamp:     msg.Data.StartTime,
+		AuthorName:    msg.Data.Username,
+		PrivilegeType: msg.Data.GuardLevel,
+	}, nil
+}
+
+// bilibiliSuperChatToSuperChatMessage decodes a SUPER_CHAT_MESSAGE into superChatMessageData.
+func bilibiliSuperChatToSuperChatMessage(raw json.RawMessage) (*superChatMessageData, error) {
+	var msg struct {
+		Data struct {
+			Id        int64  `json:"id"`
+			Price     int64  `json:"price"`
+			Message   string `json:"message"`
+			StartTime int64  `json:"start_time"`
+			UserInfo  struct {
+				Uname string `json:"uname"`
+			} `json:"user_info"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	return &superChatMessageData{
+		Id:         strconv.FormatInt(msg.Data.Id, 10),
+		Timestamp:  msg.Data.StartTime,
+		AuthorName: msg.Data.UserInfo.Uname,
+		Price:      msg.Data.Price,
+		Content:    msg.Data.Message,
+	}, nil
+}
+
+// bilibiliSuperChatDeleteIds decodes the ids from a SUPER_CHAT_MESSAGE_DELETE.
+func bilibiliSuperChatDeleteIds(raw json.RawMessage) ([]string, error) {
+	var msg struct {
+		Data struct {
+			Ids []int64 `json:"ids"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(msg.Data.Ids))
+	for _, id := range msg.Data.Ids {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	return ids, nil
+}
+
+// bilibiliAuthorID decodes the uid of the author of the message:
+// info[2][0] for DANMU_MSG, data.uid for others.
+func bilibiliAuthorID(msg bililive.Message) string {
+	var m struct {
+		Info []json.RawMessage `json:"info"`
+		Data struct {
+			Uid json.RawMessage `json:"uid"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Raw, &m); err != nil {
+		return ""
+	}
+	if msg.Cmd != bilibiliCmdDanmu {
+		return bilibiliUid(m.Data.Uid)
+	}
+
+	var user []json.RawMessage // [uid, uname, ...]
+	if len(m.Info) < 3 || json.Unmarshal(m.Info[2], &user) != nil || len(user) == 0 {
+		return ""
+	}
+	return bilibiliUid(user[0])
+}
+
+// bilibiliUid decodes a uid, a number or a string, to a plain string.
+func bilibiliUid(raw json.RawMessage) string {
+	var uid json.Number
+	if json.Unmarshal(raw, &uid) == nil {
+		return uid.String()
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return ""
+}
+
+// bilibiliMessageToTextIn converts a message from the bilibili danmaku server
+// to a TextIn. It returns ErrEventIgnored for the messages that are not
+// interesting to the vtuber (or handled internally, e.g. the SC deletions).
+func bilibiliMessageToTextIn(msg bililive.Message, o *blivedmClientOptions) (*model.TextIn, error) {
+	var textIn *model.TextIn
+	var err error
+
+	switch msg.Cmd {
+	case bilibiliCmdDanmu:
+		var tmd *textMessageData
+		if tmd, err = bilibiliDanmuToTextMessage(msg.Raw); err == nil {
+			textIn = textMessageToTextIn(tmd)
+		}
+	case bilibiliCmdSuperChat:
+		var sc *superChatMessageData
+		if sc, err = bilibiliSuperChatToSuperChatMessage(msg.Raw); err == nil {
+			textIn = superChatToTextIn(sc)
+		}
+	case bilibiliCmdGift:
+		var gift *giftMessageData
+		if gift, err = bilibiliGiftToGiftMessage(msg.Raw); err == nil {
+			textIn, err = giftToTextIn(gift, o.GiftTemplate, o.GiftMinCoin)
+		}
+	case bilibiliCmdGuardBuy:
+		var member *memberMessageData
+		if member, err = bilibiliGuardBuyToMemberMessage(msg.Raw); err == nil {
+			textIn, err = memberToTextIn(member, o.MemberTemplate)
+		}
+	case bilibiliCmdSuperChatDelete:
+		var ids []string
+		if ids, err = bilibiliSuperChatDeleteIds(msg.Raw); err == nil {
+			n := superChats.Delete(ids...)
+			slog.Info("[bilidm] SC deleted", "ids", ids, "revoked", n)
+			err = ErrEventIgnored
+		}
+	default:
+		err = ErrEventIgnored
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	textIn.AuthorID = bilibiliAuthorID(msg)
+	return textIn, nil
+}
+
+// TextInFromBilibili 直接连接 bilibili 直播弹幕服务器（而不经过 blivechat），
+// 从 roomid 的直播间接收弹幕消息，发送到 textIn。
+//
+// 与 TextInFromDm 输出相同的 TextIn。
+// Blocks forever.
+func TextInFromBilibili(roomid int, textIn chan<- *model.TextIn, opts ...BlivedmClientOption) (err error) {
+	o := newBlivedmClientOptions(opts...)
+
+	var clientOpts []bililive.Option
+	if o.BilibiliServer != "" {
+		clientOpts = append(clientOpts, bililive.WithServer(o.BilibiliServer))
+	}
+
+	retryAt, retryInterval := time.Now(), time.Second
+	for {
+		slog.Info("[bilidm] TextInFromBilibili: connect to room.", "roomid", roomid)
+		err := receiveFromBilibili(roomid, textIn, &o, clientOpts...)
+		slog.Error("[bilidm] TextInFromBilibili: client down.", "err", err)
+
+		if time.Since(retryAt) < retryInterval*3 { // what a quick break
+			retryInterval *= 2
+		} else {
+			retryInterval = time.Second
+		}
+		slog.Warn(fmt.Sprintf("[bilidm] TextInFromBilibili: try to reconnect in %v...", retryInterval))
+		time.Sleep(retryInterval)
+		retryAt = time.Now()
+	}
+}
+
+// receiveFromBilibili connects to the room and sends the TextIns to textIn.
+// Blocks until the connection is broken.
+func receiveFromBilibili(roomid int, textIn chan<- *model.TextIn, o *blivedmClientOptions, opts ...bililive.Option) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := bililive.NewClient(roomid, opts...)
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	slog.Info("[bilidm] connected.", "roomid", client.RoomID())
+
+	msgCh := make(chan bililive.Message, o.RecvMsgChanBuf)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Receive(ctx, msgCh)
+	}()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case msg := <-msgCh:
+			t, err := bilibiliMessageToTextIn(msg, o)
+			if errors.Is(err, ErrEventIgnored) {
+				continue
+			}
+			if err != nil {
+				slog.Warn("[bilidm] bilibiliMessageToTextIn error.", "cmd", msg.Cmd, "err", err)
+				continue
+			}
+			slog.Info("[bilidm] TextInFromBilibili",
+				"cmd", msg.Cmd, "author", t.Author, "priority", t.Priority, "content", t.Content)
+			textIn <- t
+		}
+	}
+}
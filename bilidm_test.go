@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/bililive"
+	"testing"
+)
+
+func Test_bilibiliMessageToTextIn(t *testing.T) {
+	o := newBlivedmClientOptions(WithGiftTemplate("{author}: {num}x{gift}"), WithGiftMinCoin(100))
+
+	tests := []struct {
+		name    string
+		cmd     string
+		raw     string
+		want    *model.TextIn
+		wantErr error
+	}{
+		{
+			name: "danmu",
+			cmd:  bilibiliCmdDanmu,
+			raw:  `{"cmd":"DANMU_MSG","info":[[0,1,25],"你好呀",[12345,"foo",1,0,0,10000,1,""],[21,"粉丝团"],[23,0],["",""]]}`,
+			want: &model.TextIn{Author: "foo", AuthorID: "12345", Content: "你好呀", Priority: model.PriorityLow},
+		},
+		{
+			name: "danmuQuotedUid",
+			cmd:  bilibiliCmdDanmu,
+			raw:  `{"cmd":"DANMU_MSG","info":[[0,1,25],"你好呀",["12345","foo",1,0,0,10000,1,""],[],[23,0],["",""]]}`,
+			want: &model.TextIn{Author: "foo", AuthorID: "12345", Content: "你好呀", Priority: model.PriorityLow},
+		},
+		{
+			name: "giftGold",
+			cmd:  bilibiliCmdGift,
+			raw:  `{"cmd":"SEND_GIFT","data":{"coin_type":"gold","giftName":"小花花","num":3,"total_coin":300,"uid":23456,"uname":"bar"}}`,
+			want: &model.TextIn{Author: "bar", AuthorID: "23456", Content: "bar: 3x小花花", Priority: 0},
+		},
+		{
+			name:    "giftSilver",
+			cmd:     bilibiliCmdGift,
+			raw:     `{"cmd":"SEND_GIFT","data":{"coin_type":"silver","giftName":"辣条","num":1,"total_coin":100,"uname":"bar"}}`,
+			wantErr: ErrEventIgnored,
+		},
+		{
+			name: "superChat",
+			cmd:  bilibiliCmdSuperChat,
+			raw:  `{"cmd":"SUPER_CHAT_MESSAGE","data":{"id":7654321,"price":30,"message":"晚上好","user_info":{"uname":"baz"}}}`,
+			want: &model.TextIn{Author: "baz", Content: "晚上好", Priority: 3, Source: model.SourceSuperChat},
+		},
+		{
+			name:    "unknown",
+			cmd:     "INTERACT_WORD",
+			raw:     `{"cmd":"INTERACT_WORD","data":{}}`,
+			wantErr: ErrEventIgnored,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bilibiliMessageToTextIn(bililive.Message{Cmd: tt.cmd, Raw: json.RawMessage(tt.raw)}, &o)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if got.Author != tt.want.Author || got.AuthorID != tt.want.AuthorID || got.Content != tt.want.Content || got.Priority != tt.want.Priority {
+				t.Errorf("got %+v, want %+v", *got, *tt.want)
+			}
+			if tt.want.Source != "" && got.Source != tt.want.Source {
+				t.Errorf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// region CircuitBreaker
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // healthy: requests pass
+	CircuitOpen                         // broken: requests fail fast until the backoff passes
+	CircuitHalfOpen                     // trying: one request passes to see if it's back
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// 断路器的默认参数
+var (
+	CircuitBaseBackoff = 5 * time.Second // 第一次断开后多久再试
+	CircuitMaxBackoff  = 2 * time.Minute // 每次再试失败，等待时间翻倍，最多这么久
+)
+
+// ErrCircuitOpen is returned without calling the backend when its circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker guards a backend (address):
+//
+//   - closed: requests pass. After FailureThreshold successive failures,
+//     it opens.
+//   - open: requests fail fast (Allow returns false). After the backoff,
+//     it becomes half-open.
+//   - half-open: one request (the trial) passes. Success closes it,
+//     failure opens it again with the backoff doubled (up to MaxBackoff).
+//
+// The health probes (see WatchHealth) never close it: a healthy probe only
+// turns it from open to half-open, leaving the verdict to the trial request.
+type CircuitBreaker struct {
+	Addr             string
+	FailureThreshold int
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int // successive failures in closed state
+	openedAt time.Time
+	backoff  time.Duration
+	trying   bool // half-open: a request is in flight
+
+	now func() time.Time // for testing
+}
+
+func NewCircuitBreaker(addr string) *CircuitBreaker {
+	return &CircuitBreaker{
+		Addr:             addr,
+		FailureThreshold: MaxConsecutiveFailures,
+		BaseBackoff:      CircuitBaseBackoff,
+		MaxBackoff:       CircuitMaxBackoff,
+		now:              time.Now,
+	}
+}
+
+// Allow reports whether a request can be sent to the backend.
+// If it returns true, the caller must report the result by
+// Success, Failure or Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.backoff {
+			return false
+		}
+		b.setState(CircuitHalfOpen)
+		b.trying = true
+		return true
+	case CircuitHalfOpen:
+		if b.trying {
+			return false
+		}
+		b.trying = true
+		return true
+	}
+	return true
+}
+
+// Ready is like Allow, without taking the chance of the half-open request.
+// It's used to skip a broken backend without waiting.
+func (b *CircuitBreaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		return b.now().Sub(b.openedAt) >= b.backoff
+	case CircuitHalfOpen:
+		return !b.trying
+	}
+	return true
+}
+
+// Success reports a successful request: it closes the circuit.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.backoff = 0
+	b.trying = false
+	b.setState(CircuitClosed)
+}
+
+// Failure reports a failed request.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitClosed {
+		b.failures++
+		if b.failures < b.FailureThreshold {
+			return
+		}
+	}
+	b.open()
+}
+
+// ProbeSuccess reports a healthy probe: an open circuit becomes half-open,
+// so that the next request tries without waiting for the backoff.
+// A half-open circuit is left to its trial request.
+func (b *CircuitBreaker) ProbeSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		b.trying = false
+		b.setState(CircuitHalfOpen)
+	}
+}
+
+// ProbeFailure reports a failed probe: an open circuit waits longer.
+// A half-open circuit is left to its trial request.
+func (b *CircuitBreaker) ProbeFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		b.open()
+	}
+}
+
+// open (or reopen) the circuit: the backoff starts from BaseBackoff,
+// and is doubled on each failure after (up to MaxBackoff). b.mu must be held.
+func (b *CircuitBreaker) open() {
+	if b.state == CircuitClosed {
+		b.backoff = b.BaseBackoff
+	} else { // open or half-open: failed again, wait longer
+		b.backoff *= 2
+		if b.backoff < b.BaseBackoff {
+			b.backoff = b.BaseBackoff
+		}
+		if b.backoff > b.MaxBackoff {
+			b.backoff = b.MaxBackoff
+		}
+	}
+	b.trying = false
+	b.openedAt = b.now()
+	b.setState(CircuitOpen)
+}
+
+// Release reports a request that ended without a verdict (e.g. canceled
+// by the caller): a half-open circuit lets the next request try.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trying = false
+}
+
+// State returns the current state.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState logs the transition. b.mu must be held.
+func (b *CircuitBreaker) setState(s CircuitState) {
+	if b.state == s && s != CircuitOpen {
+		return
+	}
+	if s == CircuitOpen {
+		slog.Warn("[CircuitBreaker] open.", "addr", b.Addr, "from", b.state, "retryAfter", b.backoff)
+	} else {
+		slog.Info("[CircuitBreaker] state changed.", "addr", b.Addr, "from", b.state, "to", s)
+	}
+	b.state = s
+}
+
+// endregion CircuitBreaker
+
+// region circuit breakers registry
+
+// circuitBreakers: addr -> *CircuitBreaker.
+// All the clients to the same backend share one CircuitBreaker.
+var circuitBreakers sync.Map
+
+// CircuitBreakerOf returns the CircuitBreaker of the backend address.
+func CircuitBreakerOf(addr string) *CircuitBreaker {
+	if b, ok := circuitBreakers.Load(addr); ok {
+		return b.(*CircuitBreaker)
+	}
+	b, _ := circuitBreakers.LoadOrStore(addr, NewCircuitBreaker(addr))
+	return b.(*CircuitBreaker)
+}
+
+// availabler is implemented by the chatbots that know whether they can
+// answer right now (e.g. SessionClientsPool with its circuit breaker).
+type availabler interface {
+	Available() bool
+}
+
+// IsAvailable reports whether the chatbot can be called right now.
+// Chatbots that do not know are assumed available.
+func IsAvailable(chatbot Chatbot) bool {
+	if a, ok := chatbot.(availabler); ok {
+		return a.Available()
+	}
+	return true
+}
+
+// endregion circuit breakers registry
+
+// region health check
+
+// WatchHealth probes the backends whose circuit is not closed every interval,
+// until ctx is done. A healthy probe makes an open circuit half-open, so that
+// the backend is tried again without waiting for the backoff; a failed one
+// keeps it open. See CircuitBreaker.ProbeSuccess and ProbeFailure.
+func WatchHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		circuitBreakers.Range(func(_, value any) bool {
+			b := value.(*CircuitBreaker)
+			if b.State() == CircuitClosed {
+				return true
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, interval)
+			err := ProbeHealth(probeCtx, b.Addr)
+			cancel()
+			if err != nil {
+				slog.Warn("[WatchHealth] backend unhealthy.", "addr", b.Addr, "err", err)
+				b.ProbeFailure()
+			} else {
+				slog.Info("[WatchHealth] backend healthy.", "addr", b.Addr)
+				b.ProbeSuccess()
+			}
+			return true
+		})
+	}
+}
+
+// ProbeHealth checks the backend via the gRPC health checking protocol.
+//
+// Backends not implementing the health service are considered healthy
+// as long as they answer (with Unimplemented).
+func ProbeHealth(ctx context.Context, addr string) error {
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil // it's there, just doesn't speak health
+	}
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return errors.New("not serving: " + resp.GetStatus().String())
+	}
+	return nil
+}
+
+// endregion health check
@@ -0,0 +1,106 @@
+package chatbot
+
+import (
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewCircuitBreaker("test")
+	b.FailureThreshold = 2
+	b.BaseBackoff = time.Second
+	b.MaxBackoff = 3 * time.Second
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if b.State() != CircuitClosed || !b.Allow() {
+		t.Fatal("1 failure should not open the circuit")
+	}
+	b.Failure()
+	if b.State() != CircuitOpen || b.Allow() || b.Ready() {
+		t.Fatal("2 failures should open the circuit")
+	}
+
+	now = now.Add(time.Second)
+	if !b.Ready() {
+		t.Error("Ready() = false after backoff")
+	}
+	if !b.Allow() || b.State() != CircuitHalfOpen {
+		t.Fatal("after backoff: one request should pass (half-open)")
+	}
+	if b.Allow() {
+		t.Error("half-open: only one request should pass")
+	}
+
+	b.Failure() // backoff doubled: 2s
+	now = now.Add(time.Second)
+	if b.Allow() {
+		t.Error("half-open failed: backoff should be doubled")
+	}
+	now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Error("doubled backoff passed: want a try")
+	}
+	b.Release()
+	if !b.Allow() {
+		t.Error("released: the next request should try")
+	}
+
+	b.Success()
+	if b.State() != CircuitClosed || !b.Allow() {
+		t.Error("success should close the circuit")
+	}
+}
+
+func TestCircuitBreaker_Probe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewCircuitBreaker("test")
+	b.FailureThreshold = 1
+	b.BaseBackoff = time.Second
+	b.MaxBackoff = 4 * time.Second
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	b.ProbeFailure() // backoff doubled: 2s
+	now = now.Add(time.Second)
+	if b.State() != CircuitOpen || b.Ready() {
+		t.Fatal("failed probe: the circuit should stay open and wait longer")
+	}
+
+	b.ProbeSuccess()
+	if b.State() != CircuitHalfOpen || !b.Allow() {
+		t.Fatal("healthy probe: the circuit should be half-open for a trial")
+	}
+	b.ProbeSuccess() // while the trial is in flight
+	b.ProbeFailure()
+	if b.State() != CircuitHalfOpen || b.Allow() {
+		t.Fatal("probes should not interfere with the trial in flight")
+	}
+
+	b.Success()
+	if b.State() != CircuitClosed {
+		t.Error("the trial succeeded: the circuit should be closed")
+	}
+}
+
+// unavailableChatbot is a fakeChatbot with Available() = false
+type unavailableChatbot struct{ fakeChatbot }
+
+func (unavailableChatbot) Available() bool { return false }
+
+func TestPrioritizedChatbot_SkipUnavailable(t *testing.T) {
+	high := &unavailableChatbot{fakeChatbot{name: "high", delay: time.Second}}
+	low := &fakeChatbot{name: "low"}
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{0: low, 1: high})
+
+	start := time.Now()
+	textOut, err := p.Chat(model.NewTextIn(model.SourceDm, "a", "hi", 1))
+	if err != nil || textOut.Content != "low" {
+		t.Fatalf("Chat() = %v, %v, want low", textOut, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("unavailable chatbot should be skipped without waiting")
+	}
+}
@@ -0,0 +1,534 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/textsim"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// region CacheChatbot
+
+// CacheChatbot wraps a Chatbot with a response cache, so the questions
+// viewers ask again and again ("你是谁", "多大了") do not go to the
+// wrapped (expensive) Chatbot every time.
+//
+// The questions are keyed by textsim.Normalize: "你是谁？" and "你 是 谁"
+// are the same. With WithCacheFuzzy, a similar enough question is a hit
+// as well.
+//
+// Each question keeps up to variety answers (WithCacheVariety): the first
+// askings go to the wrapped Chatbot to collect them, then the cached ones
+// are used in turn. The answers expire after the TTL; the least recently
+// used questions are evicted beyond the max size.
+//
+// Note that a cached answer was generated for another viewer.
+//
+// A CacheChatbot should wrap the MemoryChatbot (keyed by the question, not
+// by the framed prompt that differs every time). A hit is remembered by the
+// wrapped MemoryChatbot as well: see MemoryChatbot.Remember.
+type CacheChatbot struct {
+	Chatbot
+	cache *responseCache
+
+	similarity   float64 // fuzzy matching threshold, 0 to disable
+	file         string  // persistence file, "" to disable
+	saveInterval time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	stop chan struct{}
+}
+
+type CacheOption func(c *CacheChatbot)
+
+// WithCacheTTL sets how long an answer is kept. Default: 24 hours.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *CacheChatbot) {
+		if ttl > 0 {
+			c.cache.ttl = ttl
+		}
+	}
+}
+
+// WithCacheSize sets the max number of questions cached. Default: 1000.
+func WithCacheSize(size int) CacheOption {
+	return func(c *CacheChatbot) {
+		if size > 0 {
+			c.cache.maxSize = size
+		}
+	}
+}
+
+// WithCacheVariety sets how many answers are kept for each question.
+// Default: 1, the same answer every time.
+func WithCacheVariety(n int) CacheOption {
+	return func(c *CacheChatbot) {
+		if n > 0 {
+			c.cache.variety = n
+		}
+	}
+}
+
+// WithCacheFuzzy makes a question hit the most similar cached one if the
+// textsim.Similarity is at least threshold (0~1, e.g. 0.8).
+// Default: 0, exact match (after normalization) only.
+func WithCacheFuzzy(threshold float64) CacheOption {
+	return func(c *CacheChatbot) {
+		c.similarity = threshold
+	}
+}
+
+// WithCacheFile persists the cache to the JSON file:
+// it's loaded on NewCacheChatbot, and saved every interval if changed
+// (and on Close). Default interval: 1 minute.
+func WithCacheFile(file string, interval time.Duration) CacheOption {
+	return func(c *CacheChatbot) {
+		c.file = file
+		if interval > 0 {
+			c.saveInterval = interval
+		}
+	}
+}
+
+// NewCacheChatbot wraps the chatbot with a response cache.
+//
+// If a cache file is set and exists, it's loaded.
+// A missing file is not an error.
+func NewCacheChatbot(chatbot Chatbot, opts ...CacheOption) (*CacheChatbot, error) {
+	c := &CacheChatbot{
+		Chatbot:      chatbot,
+		cache:        newResponseCache(),
+		saveInterval: time.Minute,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.similarity < 0 || c.similarity > 1 {
+		return nil, fmt.Errorf("cache similarity threshold should be in [0, 1], got %v", c.similarity)
+	}
+
+	if c.file != "" {
+		if err := c.cache.load(c.file); err != nil {
+			return nil, fmt.Errorf("load cache: %w", err)
+		}
+		slog.Info("[CacheChatbot] cache loaded.", "file", c.file, "questions", c.cache.len())
+		go c.autosave()
+	}
+
+	return c, nil
+}
+
+// Chat answers the textIn from the cache if possible, or chats with the
+// wrapped Chatbot and caches the answer.
+func (c *CacheChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface. See Chat.
+func (c *CacheChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, nil
+	}
+	if textOut := c.lookupCtx(ctx, textIn); textOut != nil {
+		return textOut, nil
+	}
+
+	textOut, err := WithContext(c.Chatbot).ChatContext(ctx, textIn)
+	if err != nil || textOut == nil {
+		return textOut, err
+	}
+	c.cache.add(textsim.Normalize(textIn.Content), textIn.Content, textOut.Content)
+	return textOut, nil
+}
+
+// ChatStream implements the StreamChatbot interface. See Chat.
+// A cached answer is delivered as a single delta.
+func (c *CacheChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, nil
+	}
+	if textOut := c.lookupCtx(ctx, textIn); textOut != nil {
+		delta := *textOut
+		onDelta(&delta)
+		return textOut, nil
+	}
+
+	textOut, err := WithStream(c.Chatbot).ChatStream(ctx, textIn, onDelta)
+	if err != nil || textOut == nil {
+		return textOut, err
+	}
+	c.cache.add(textsim.Normalize(textIn.Content), textIn.Content, textOut.Content)
+	return textOut, nil
+}
+
+// lookupCtx is lookup, but if the ctx carries a rejected answer
+// (Regenerate, see WithRejected), the answer is forgotten and it's a
+// miss: go to the wrapped Chatbot for a new one.
+func (c *CacheChatbot) lookupCtx(ctx context.Context, textIn *model.TextIn) *model.TextOut {
+	rejected := rejectedFrom(ctx)
+	if rejected == nil {
+		return c.lookup(textIn)
+	}
+	if n := c.cache.forget(rejected.Content); n > 0 {
+		slog.Info("[CacheChatbot] rejected answer forgotten.",
+			"answer", ellipsis.Ending(rejected.Content, 20), "n", n)
+	}
+	return nil
+}
+
+// lookup returns the cached answer to the textIn, or nil on a miss.
+func (c *CacheChatbot) lookup(textIn *model.TextIn) *model.TextOut {
+	key := textsim.Normalize(textIn.Content)
+	if key == "" { // emojis, "？？？": nothing to ask
+		return nil
+	}
+
+	answer, matched, similarity, ok := c.cache.get(key, c.similarity)
+	if !ok {
+		misses := c.misses.Add(1)
+		slog.Debug("[CacheChatbot] miss.",
+			"question", ellipsis.Ending(textIn.Content, 20),
+			"hits", c.hits.Load(), "misses", misses)
+		return nil
+	}
+
+	hits := c.hits.Add(1)
+	slog.Info("[CacheChatbot] hit.",
+		"question", ellipsis.Ending(textIn.Content, 20),
+		"matched", ellipsis.Ending(matched, 20), "similarity", similarity,
+		"answer", ellipsis.Ending(answer, 20),
+		"hits", hits, "misses", c.misses.Load())
+
+	textOut := textIn.Reply("CacheChatbot", answer)
+	textOut.SetMeta(model.MetaCacheHit, true)
+
+	// the wrapped MemoryChatbot does not see the turn: tell it
+	if r, ok := c.Chatbot.(rememberer); ok {
+		r.Remember(textIn, textOut)
+	}
+	return textOut
+}
+
+// CacheStats is the statistics of a CacheChatbot.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Questions int // questions cached
+}
+
+// HitRate is Hits / (Hits + Misses), 0 if no lookup.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats returns the hit/miss statistics since the CacheChatbot is created.
+func (c *CacheChatbot) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Questions: c.cache.len(),
+	}
+}
+
+// Available reports whether the wrapped Chatbot is available. See IsAvailable.
+//
+// The cache may still answer when the wrapped Chatbot is not available,
+// but the PrioritizedChatbot skips the unavailable ones without asking.
+func (c *CacheChatbot) Available() bool {
+	return IsAvailable(c.Chatbot)
+}
+
+// SetPrompt sets the prompt of the wrapped Chatbot (see PromptSetter),
+// and clears the cache: the answers are from the old prompt.
+func (c *CacheChatbot) SetPrompt(prompt string) error {
+	ok, err := SetPrompt(c.Chatbot, prompt)
+	if ok && err == nil {
+		n := c.cache.reset()
+		slog.Info("[CacheChatbot] prompt changed, cache cleared.", "questions", n)
+	}
+	return err
+}
+
+// Save writes the cache to the file (if set).
+func (c *CacheChatbot) Save() error {
+	if c.file == "" {
+		return nil
+	}
+	return c.cache.save(c.file)
+}
+
+// Close stops the autosave, saves the cache, and closes the wrapped
+// Chatbot if it's an io.Closer.
+func (c *CacheChatbot) Close() error {
+	select {
+	case <-c.stop:
+		return nil // already closed
+	default:
+		close(c.stop)
+	}
+
+	stats := c.Stats()
+	slog.Info("[CacheChatbot] closed.",
+		"hits", stats.Hits, "misses", stats.Misses, "hitRate", stats.HitRate(), "questions", stats.Questions)
+
+	errs := []error{c.Save()}
+	if closer, ok := c.Chatbot.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (c *CacheChatbot) autosave() {
+	ticker := time.NewTicker(c.saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if !c.cache.isDirty() {
+				continue
+			}
+			if err := c.Save(); err != nil {
+				slog.Warn("[CacheChatbot] save cache failed.", "file", c.file, "err", err)
+			}
+			stats := c.Stats()
+			slog.Info("[CacheChatbot] stats.",
+				"hits", stats.Hits, "misses", stats.Misses, "hitRate", stats.HitRate(), "questions", stats.Questions)
+		}
+	}
+}
+
+// endregion CacheChatbot
+
+// region responseCache
+
+// cachedAnswer is an answer to a cached question.
+type cachedAnswer struct {
+	Text string    `json:"text"`
+	Time time.Time `json:"time"` // when it's generated
+}
+
+// cacheEntry is a cached question and its answers.
+type cacheEntry struct {
+	Question string         `json:"question"` // as first asked
+	Answers  []cachedAnswer `json:"answers"`
+	LastUsed time.Time      `json:"last_used"`
+
+	next int // the answer to use next
+}
+
+// responseCache: normalized question -> answers.
+// The exported fields are persisted.
+type responseCache struct {
+	mu sync.Mutex
+
+	Entries map[string]*cacheEntry `json:"entries"`
+
+	ttl     time.Duration
+	maxSize int
+	variety int
+	dirty   dirtyTracker
+
+	now func() time.Time // for testing
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		Entries: map[string]*cacheEntry{},
+		ttl:     24 * time.Hour,
+		maxSize: 1000,
+		variety: 1,
+		now:     time.Now,
+	}
+}
+
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.Entries)
+}
+
+// get returns the next cached answer to the question (key) and the
+// question matched. With a similarity threshold > 0, the most similar
+// cached question is used if no exact match.
+//
+// It's a miss if the entry has fewer answers than variety: go to collect
+// another one.
+func (c *responseCache) get(key string, similarity float64) (answer, matched string, sim float64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry, sim := c.Entries[key], 1.0
+	if entry == nil && similarity > 0 {
+		sim = 0
+		for k, e := range c.Entries {
+			if s := textsim.Similarity(key, k); s >= similarity && s > sim {
+				entry, sim = e, s
+			}
+		}
+	}
+	if entry == nil {
+		return "", "", 0, false
+	}
+
+	c.expire(entry, now)
+	if len(entry.Answers) < c.variety {
+		return "", "", 0, false
+	}
+
+	answer = entry.Answers[entry.next%len(entry.Answers)].Text
+	entry.next++
+	entry.LastUsed = now
+	c.dirty.changed()
+	return answer, entry.Question, sim, true
+}
+
+// add caches the answer to the question (key).
+func (c *responseCache) add(key, question, answer string) {
+	if key == "" || answer == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry, ok := c.Entries[key]
+	if !ok {
+		entry = &cacheEntry{Question: question}
+		c.Entries[key] = entry
+	}
+	c.expire(entry, now)
+	entry.Answers = append(entry.Answers, cachedAnswer{Text: answer, Time: now})
+	if len(entry.Answers) > c.variety {
+		entry.Answers = append(entry.Answers[:0], entry.Answers[len(entry.Answers)-c.variety:]...)
+	}
+	entry.LastUsed = now
+	c.dirty.changed()
+
+	c.evict()
+}
+
+// reset drops all the questions. Returns the number dropped.
+func (c *responseCache) reset() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.Entries)
+	c.Entries = map[string]*cacheEntry{}
+	c.dirty.changed()
+	return n
+}
+
+// forget drops the answer from all the questions.
+// Returns the number of answers dropped.
+func (c *responseCache) forget(answer string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, entry := range c.Entries {
+		kept := entry.Answers[:0]
+		for _, a := range entry.Answers {
+			if a.Text != answer {
+				kept = append(kept, a)
+			}
+		}
+		n += len(entry.Answers) - len(kept)
+		entry.Answers = kept
+	}
+	if n > 0 {
+		c.dirty.changed()
+	}
+	return n
+}
+
+// expire drops the answers older than the ttl. c.mu must be held.
+func (c *responseCache) expire(entry *cacheEntry, now time.Time) {
+	fresh := entry.Answers[:0]
+	for _, a := range entry.Answers {
+		if now.Sub(a.Time) < c.ttl {
+			fresh = append(fresh, a)
+		}
+	}
+	if len(fresh) != len(entry.Answers) {
+		c.dirty.changed()
+	}
+	entry.Answers = fresh
+}
+
+// evict the least recently used questions beyond maxSize. c.mu must be held.
+func (c *responseCache) evict() {
+	if len(c.Entries) <= c.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(c.Entries))
+	for k := range c.Entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.Entries[keys[i]].LastUsed.Before(c.Entries[keys[j]].LastUsed)
+	})
+	for _, k := range keys[:len(keys)-c.maxSize] {
+		delete(c.Entries, k)
+	}
+}
+
+func (c *responseCache) isDirty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dirty.unsaved()
+}
+
+// load reads the cache from the JSON file. A missing file is ignored.
+func (c *responseCache) load(file string) error {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return err
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]*cacheEntry{}
+	}
+	for k, e := range c.Entries {
+		if e == nil {
+			delete(c.Entries, k)
+		}
+	}
+	c.evict()
+	return nil
+}
+
+// save writes the cache to the JSON file atomically. See saveJSON.
+func (c *responseCache) save(file string) error {
+	return saveJSON(file, &c.mu, c, &c.dirty)
+}
+
+// endregion responseCache
@@ -0,0 +1,82 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"muvtuberdriver/model"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingChatbot answers "answer N" to the Nth call.
+type countingChatbot struct {
+	calls int
+}
+
+func (c *countingChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	c.calls++
+	return textIn.Reply("counting", fmt.Sprintf("answer %d", c.calls)), nil
+}
+
+func TestCacheChatbot(t *testing.T) {
+	bot := &countingChatbot{}
+	file := filepath.Join(t.TempDir(), "cache.json")
+	c, err := NewCacheChatbot(bot, WithCacheVariety(2), WithCacheFuzzy(0.5), WithCacheFile(file, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ask := func(content string) string {
+		t.Helper()
+		textOut, err := c.Chat(model.NewTextIn(model.SourceDm, "a", content, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return textOut.Content
+	}
+
+	// collect 2 answers, then rotate
+	for i, q := range []string{"你是谁？", "你 是 谁", "你是谁", "你是谁!", "你是谁呀"} {
+		want := []string{"answer 1", "answer 2", "answer 1", "answer 2", "answer 1"}[i]
+		if got := ask(q); got != want {
+			t.Errorf("ask(%q) = %q, want %q", q, got, want)
+		}
+	}
+	if got := ask("多大了"); got != "answer 3" {
+		t.Errorf("ask(多大了) = %q, want a new answer", got)
+	}
+	if stats := c.Stats(); stats.Hits != 3 || stats.Misses != 3 || stats.Questions != 2 {
+		t.Errorf("Stats() = %+v, want 3 hits, 3 misses, 2 questions", stats)
+	}
+
+	// expired
+	c.cache.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if got := ask("你是谁"); got != "answer 4" {
+		t.Errorf("ask(你是谁) after ttl = %q, want a new answer", got)
+	}
+	c.cache.now = time.Now
+
+	// persisted
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewCacheChatbot(bot, WithCacheVariety(1), WithCacheFile(file, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := ask("多大了？"); got != "answer 3" {
+		t.Errorf("ask(多大了) after reload = %q, want the cached answer 3", got)
+	}
+
+	// rejected (e.g. by the moderation): forgotten, ask for a new one
+	textIn := model.NewTextIn(model.SourceDm, "a", "多大了", 0)
+	textOut, err := c.ChatContext(WithRejected(context.Background(), textIn.Reply("CacheChatbot", "answer 3")), textIn)
+	if err != nil || textOut.Content != "answer 5" {
+		t.Errorf("regenerate(多大了) = %v, %v; want a new answer 5", textOut, err)
+	}
+	if got := ask("多大了"); got != "answer 5" {
+		t.Errorf("ask(多大了) after rejected = %q, want the new answer 5", got)
+	}
+}
@@ -1,9 +1,15 @@
 package chatbot
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"muvtuberdriver/model"
+	"sync"
+	"time"
+
 	"github.com/cdfmlr/ellipsis"
 )
 
@@ -11,15 +17,62 @@ type Chatbot interface {
 	Chat(textIn *model.TextIn) (*model.TextOut, error)
 }
 
-func TextOutFromChatbot(chatbot Chatbot, textInChan <-chan *model.TextIn, textOutChan chan<- *model.TextOut) {
-	for {
-		textIn := <-textInChan
-		textOut, err := chatbot.Chat(textIn)
-		if err != nil {
-			log.Printf("ERROR chatbot.Chat(%v) failed: %v", textIn, err)
-		}
-		textOutChan <- textOut
+// ContextChatbot is a Chatbot that can be canceled:
+// ChatContext should return (with ctx.Err()) soon after ctx is done,
+// and stop the in-flight work (e.g. the RPC).
+type ContextChatbot interface {
+	Chatbot
+	ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error)
+}
+
+// WithContext adapts a Chatbot to a ContextChatbot.
+//
+// If the chatbot is already a ContextChatbot, it's returned as is.
+// Otherwise, the ChatContext of the adapter returns once ctx is done,
+// but the old implementation can not be stopped: it keeps running in the
+// background, and its answer is dropped.
+func WithContext(chatbot Chatbot) ContextChatbot {
+	if c, ok := chatbot.(ContextChatbot); ok {
+		return c
 	}
+	return contextAdapter{chatbot}
+}
+
+type contextAdapter struct {
+	Chatbot
+}
+
+func (a contextAdapter) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	type result struct {
+		textOut *model.TextOut
+		err     error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		textOut, err := a.Chatbot.Chat(textIn)
+		ch <- result{textOut, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.textOut, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TextOutFromChatbot receives TextIns from textInChan, chats with the chatbot,
+// and sends the TextOuts to textOutChan.
+//
+// By default, the TextIns are handled one by one. Use WithWorkers to chat
+// several in parallel, and WithOrder and WithMaxAge to control the output
+// (see workers.go).
+//
+// It returns when ctx is done (or textInChan is closed and the in-flight
+// TextIns are done). The in-flight Chats are canceled as well.
+func TextOutFromChatbot(ctx context.Context, chatbot Chatbot, textInChan <-chan *model.TextIn, textOutChan chan<- *model.TextOut, opts ...WorkerOption) {
+	runWorkers(ctx, "TextOutFromChatbot", chanSource(textInChan), chat(WithContext(chatbot)),
+		textOutChan, newWorkerOptions(opts))
 }
 
 // region ChatGPTChatbot
@@ -31,52 +84,492 @@ func TextOutFromChatbot(chatbot Chatbot, textInChan <-chan *model.TextIn, textOu
 // PrioritizedChatbot 按照 TextIn 的 Priority 调用 Chatbot。
 // 高优先级的 Chatbot 应该是对话质量更高的（例如 ChatGPTChatbot），而低优先级的 Chatbot 用来保底。
 // 如果没有对应级别的 Chatbot，会往下滑到更低的级别。
+//
+// 每一级可以设置超时 (WithLevelTimeout)，超时或失败就试下一级。
+// 不可用的 Chatbot (IsAvailable 为 false，例如断路器打开) 直接跳过，不等待。
+// 设置了 WithHedgeDelay 的话，一级在 delay 内还没回复，就同时开始试下一级，谁先回复用谁的。
+// 所有级别都失败了，先试 WithFallback 设置的 Chatbot (例如 RuleChatbot)，
+// 再不行就用 WithCannedReplies 设置的话术兜底。
 type PrioritizedChatbot struct {
 	chatbots map[model.Priority]Chatbot
+
+	timeouts       map[model.Priority]time.Duration // per-level timeout
+	defaultTimeout time.Duration                    // for the levels not in timeouts, 0 for no timeout
+	hedgeDelay     time.Duration                    // 0 for no hedging: try the levels one by one
+
+	fallback Chatbot // tried when all the levels failed, whatever the priority of the textIn
+
+	cannedReplies []string
+	cannedIndex   int
+	cannedMu      sync.Mutex
+
+	observer ChatObserver
+}
+
+type PrioritizedChatbotOption func(p *PrioritizedChatbot)
+
+// WithLevelTimeout sets the timeout of the Chatbot at the priority level.
+func WithLevelTimeout(priority model.Priority, timeout time.Duration) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.timeouts[priority] = timeout
+	}
+}
+
+// WithDefaultTimeout sets the timeout of the levels without WithLevelTimeout.
+// 0 (default) means no timeout other than the Chatbot's own.
+func WithDefaultTimeout(timeout time.Duration) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.defaultTimeout = timeout
+	}
+}
+
+// WithHedgeDelay enables the hedged mode: if a level does not answer
+// within delay, the next lower level is fired as well,
+// and whichever answers first wins.
+func WithHedgeDelay(delay time.Duration) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.hedgeDelay = delay
+	}
+}
+
+// WithFallback sets the chatbot to try when all the levels failed.
+//
+// Unlike the levels, the fallback is reachable by the TextIns of any
+// priority, so a local chatbot (e.g. RuleChatbot) put here answers when
+// the backends are down, without taking the low priority TextIns from
+// the lowest level.
+func WithFallback(chatbot Chatbot) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.fallback = chatbot
+	}
+}
+
+// WithCannedReplies sets the replies (used in turn) when all the levels failed.
+func WithCannedReplies(replies ...string) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.cannedReplies = replies
+	}
+}
+
+// ChatObserver is called with the outcome of every Chat (and ChatStream)
+// of a PrioritizedChatbot: the textOut (whose Author is the chatbot that
+// answered) or the error. E.g. transcript.Recorder.RecordChat.
+type ChatObserver func(textIn *model.TextIn, textOut *model.TextOut, err error)
+
+// WithChatObserver sets the observer of the chats.
+func WithChatObserver(observer ChatObserver) PrioritizedChatbotOption {
+	return func(p *PrioritizedChatbot) {
+		p.observer = observer
+	}
 }
 
-// TODO: timeout -> try others.
+func NewPrioritizedChatbot(chatbots map[model.Priority]Chatbot, opts ...PrioritizedChatbotOption) *PrioritizedChatbot {
+	p := &PrioritizedChatbot{
+		chatbots: chatbots,
+		timeouts: map[model.Priority]time.Duration{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// ErrNoChatbotAvailable is returned when all the levels failed
+// and there is no canned reply.
+var ErrNoChatbotAvailable = errors.New("no chatbot available")
+
 func (p *PrioritizedChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return p.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext is Chat with a context: the caller can cancel it.
+func (p *PrioritizedChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
 	if textIn == nil {
 		return nil, nil
 	}
+	textOut, err := p.chatContext(ctx, textIn)
+	p.observe(textIn, textOut, err)
+	return textOut, err
+}
+
+func (p *PrioritizedChatbot) chatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
 	log.Printf("INFO [PrioritizedChatbot] Chat(%s): %q", textIn.Author, ellipsis.Centering(textIn.Content, 17))
 
-	priority := textIn.Priority
+	var textOut *model.TextOut
+	var err error
+	if p.hedgeDelay > 0 {
+		textOut, err = p.chatHedged(ctx, textIn)
+	} else {
+		textOut, err = p.chatOneByOne(ctx, textIn)
+	}
+
+	if err == nil && textOut != nil {
+		// 这个作为特例，不用 ellipsis，而是输出完整的内容：
+		// 这个是目前唯一一个一行看到完整 输入 -> 输出 的地方，也许可以用来收集数据做训练？
+		// 新改成了 %q 的格式，以前会换行，现在不允许了。
+		log.Printf("INFO [PrioritizedChatbot] Chat(%s): %q => (%s): %q", textIn.Author, textIn.Content, textOut.Author, textOut.Content)
+		return textOut, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if textOut, err = p.chatFallback(ctx, textIn, err); err == nil {
+		return textOut, nil
+	}
+
+	if canned := p.nextCannedReply(); canned != "" {
+		log.Printf("WARN [PrioritizedChatbot] all Chatbots failed: %v, use canned reply: %q", err, canned)
+		return cannedReply(textIn, canned), nil
+	}
+	log.Printf("ERROR [PrioritizedChatbot] all Chatbots failed: %v, return nil", err)
+	return nil, err
+}
 
+// chatFallback tries the fallback chatbot after the levels failed with errLevels.
+// The returned error joins errLevels and the fallback's.
+func (p *PrioritizedChatbot) chatFallback(ctx context.Context, textIn *model.TextIn, errLevels error) (*model.TextOut, error) {
+	if p.fallback == nil {
+		return nil, errLevels
+	}
+
+	textOut, err := WithContext(p.fallback).ChatContext(ctx, textIn)
+	if err == nil && textOut == nil {
+		err = fmt.Errorf("%T.Chat returns nil", p.fallback)
+	}
+	if err != nil {
+		return nil, errors.Join(errLevels, fmt.Errorf("fallback (%T): %w", p.fallback, err))
+	}
+
+	log.Printf("WARN [PrioritizedChatbot] all Chatbots failed: %v, fallback (%T): %q => %q", errLevels, p.fallback, textIn.Content, textOut.Content)
+	textOut.SetMeta(model.MetaDegraded, "fallback")
+	return textOut, nil
+}
+
+// cannedReply replies the textIn with the canned content.
+func cannedReply(textIn *model.TextIn, canned string) *model.TextOut {
+	textOut := textIn.Reply("CannedReply", canned)
+	textOut.SetMeta(model.MetaDegraded, "canned")
+	return textOut
+}
+
+// IsDegraded reports whether the textOut is a stopgap answered by the
+// PrioritizedChatbot as all the chatbots failed: from the fallback or the
+// canned replies. See model.MetaDegraded.
+func IsDegraded(textOut *model.TextOut) bool {
+	return textOut != nil && textOut.Meta(model.MetaDegraded) != nil
+}
+
+// levels returns the priorities of the chatbots to try for the textIn,
+// from high to low. The unavailable ones (e.g. circuit open) are skipped.
+func (p *PrioritizedChatbot) levels(priority model.Priority) []model.Priority {
+	var levels []model.Priority
 	for i := priority; i >= 0; i-- {
 		chatbot, ok := p.chatbots[i]
 		if !ok {
 			continue
 		}
+		if !IsAvailable(chatbot) {
+			log.Printf("INFO [PrioritizedChatbot] skip unavailable chatbot: level %v (%T)", i, chatbot)
+			continue
+		}
+		levels = append(levels, i)
+	}
+	return levels
+}
+
+// chatLevel calls the Chatbot at the level with the level's timeout.
+func (p *PrioritizedChatbot) chatLevel(ctx context.Context, level model.Priority, textIn *model.TextIn) (*model.TextOut, error) {
+	if timeout := p.levelTimeout(level); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-		textOut, err := chatbot.Chat(textIn)
-		if err != nil {
-			if i == 0 {
-				log.Printf("ERROR [PrioritizedChatbot] all Chatbots failed: %v, return nil", err)
-				return nil, err
-			} else {
-				log.Printf("WARN [PrioritizedChatbot] %T.Chat(%v) failed: %v, try next chatbot", chatbot, textIn, err)
-				continue
+	chatbot := p.chatbots[level]
+	textOut, err := WithContext(chatbot).ChatContext(ctx, textIn)
+	if err == nil && textOut == nil {
+		err = fmt.Errorf("%T.Chat returns nil", chatbot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("level %v (%T): %w", level, chatbot, err)
+	}
+	textOut.SetMeta(model.MetaChatbotLevel, level)
+	return textOut, nil
+}
+
+// ErrCannotRegenerate is returned by Regenerate for the answers not from
+// a level: the fallback, the canned replies, or the chunks of an answer.
+var ErrCannotRegenerate = errors.New("can not regenerate")
+
+// Regenerate asks the level that answered the rejected TextOut (e.g. by
+// the moderation) to answer its TextIn (ReplyTo) again.
+//
+// The rejected answer is put in the ctx (see WithRejected), so that a
+// CacheChatbot forgets it instead of answering it again.
+func (p *PrioritizedChatbot) Regenerate(ctx context.Context, rejected *model.TextOut) (*model.TextOut, error) {
+	if rejected == nil || rejected.ReplyTo == nil {
+		return nil, fmt.Errorf("%w: not a reply", ErrCannotRegenerate)
+	}
+	if rejected.Meta(model.MetaChunkOf) != nil {
+		return nil, fmt.Errorf("%w: a chunk of a longer answer", ErrCannotRegenerate)
+	}
+	level, ok := rejected.Meta(model.MetaChatbotLevel).(model.Priority)
+	if !ok || p.chatbots[level] == nil {
+		return nil, fmt.Errorf("%w: not answered by a chatbot level (%s)", ErrCannotRegenerate, rejected.Author)
+	}
+
+	textIn := rejected.ReplyTo
+	log.Printf("INFO [PrioritizedChatbot] Regenerate(%s): %q at level %v", textIn.Author, ellipsis.Centering(textIn.Content, 17), level)
+	textOut, err := p.chatLevel(WithRejected(ctx, rejected), level, textIn)
+	p.observe(textIn, textOut, err)
+	return textOut, err
+}
+
+// rejectedKey is the context key of WithRejected.
+type rejectedKey struct{}
+
+// WithRejected returns a ctx carrying the rejected answer to regenerate.
+func WithRejected(ctx context.Context, rejected *model.TextOut) context.Context {
+	return context.WithValue(ctx, rejectedKey{}, rejected)
+}
+
+// rejectedFrom returns the rejected answer in the ctx, or nil.
+func rejectedFrom(ctx context.Context) *model.TextOut {
+	rejected, _ := ctx.Value(rejectedKey{}).(*model.TextOut)
+	return rejected
+}
+
+// levelTimeout returns the timeout of the level, 0 for no timeout.
+func (p *PrioritizedChatbot) levelTimeout(level model.Priority) time.Duration {
+	if timeout, ok := p.timeouts[level]; ok {
+		return timeout
+	}
+	return p.defaultTimeout
+}
+
+// chatOneByOne tries the levels from high to low, until one succeeds.
+func (p *PrioritizedChatbot) chatOneByOne(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	err := ErrNoChatbotAvailable
+	for _, level := range p.levels(textIn.Priority) {
+		var textOut *model.TextOut
+		textOut, err = p.chatLevel(ctx, level, textIn)
+		if err == nil {
+			return textOut, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("WARN [PrioritizedChatbot] Chat(%v) failed: %v, try next chatbot", ellipsis.Centering(textIn.Content, 17), err)
+	}
+	return nil, err
+}
+
+// chatHedged fires the levels from high to low: the next level starts
+// when the previous one failed or did not answer within hedgeDelay.
+// The first answer wins, the others are canceled.
+func (p *PrioritizedChatbot) chatHedged(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	levels := p.levels(textIn.Priority)
+	if len(levels) == 0 {
+		return nil, ErrNoChatbotAvailable
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // the losers
+
+	type result struct {
+		textOut *model.TextOut
+		err     error
+	}
+	results := make(chan result, len(levels))
+
+	next, running := 0, 0
+	var hedge <-chan time.Time
+	fire := func() {
+		if next >= len(levels) {
+			hedge = nil
+			return
+		}
+		level := levels[next]
+		next++
+		running++
+		go func() {
+			textOut, err := p.chatLevel(ctx, level, textIn)
+			results <- result{textOut, err}
+		}()
+		hedge = time.After(p.hedgeDelay)
+	}
+
+	fire()
+	var errs []error
+	for running > 0 {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil {
+				return r.textOut, nil
 			}
+			errs = append(errs, r.err)
+			log.Printf("WARN [PrioritizedChatbot] Chat(%v) failed: %v, try next chatbot", ellipsis.Centering(textIn.Content, 17), r.err)
+			fire()
+		case <-hedge:
+			log.Printf("INFO [PrioritizedChatbot] Chat(%v) no answer in %v, hedge with next chatbot", ellipsis.Centering(textIn.Content, 17), p.hedgeDelay)
+			fire()
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-		if textOut != nil {
-			// log.Printf("[PrioritizedChatbot] Chat(%s): %s => (%s): %s", textIn.Author, ellipsis.Centering(textIn.Content, 17), textOut.Author, ellipsis.Centering(textOut.Content, 17))
-			// 这个作为特例，不用 ellipsis，而是输出完整的内容：
-			// 这个是目前唯一一个一行看到完整 输入 -> 输出 的地方，也许可以用来收集数据做训练？
-			// 新改成了 %q 的格式，以前会换行，现在不允许了。
-			log.Printf("INFO [PrioritizedChatbot] Chat(%s): %q => (%s): %q", textIn.Author, textIn.Content, textOut.Author, textOut.Content)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ChatStream implements the StreamChatbot interface: the streaming version
+// of ChatContext. The levels not supporting streaming deliver the whole
+// response as one delta (see WithStream).
+//
+// Differences from ChatContext, since a delivered piece may be spoken
+// already and can not be taken back:
+//
+//   - The levels are tried one by one, no hedging.
+//   - The timeout of a level is the time to its first piece: a level that
+//     has started answering is not cut off (but by its own RPC timeout).
+//   - Once a level has delivered some pieces, its failure is returned
+//     without trying the next level or the canned replies.
+func (p *PrioritizedChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, nil
+	}
+	textOut, err := p.chatStream(ctx, textIn, onDelta)
+	p.observe(textIn, textOut, err)
+	return textOut, err
+}
+
+func (p *PrioritizedChatbot) chatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	log.Printf("INFO [PrioritizedChatbot] ChatStream(%s): %q", textIn.Author, ellipsis.Centering(textIn.Content, 17))
+
+	err := ErrNoChatbotAvailable
+	for _, level := range p.levels(textIn.Priority) {
+		var textOut *model.TextOut
+		var delivered bool
+		textOut, delivered, err = p.chatLevelStream(ctx, level, textIn, onDelta)
+		if err == nil {
+			log.Printf("INFO [PrioritizedChatbot] ChatStream(%s): %q => (%s): %q", textIn.Author, textIn.Content, textOut.Author, textOut.Content)
 			return textOut, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if delivered {
+			log.Printf("ERROR [PrioritizedChatbot] ChatStream(%v) failed halfway: %v", ellipsis.Centering(textIn.Content, 17), err)
+			return nil, err
+		}
+		log.Printf("WARN [PrioritizedChatbot] ChatStream(%v) failed: %v, try next chatbot", ellipsis.Centering(textIn.Content, 17), err)
+	}
+
+	var textOut *model.TextOut
+	if textOut, err = p.chatFallback(ctx, textIn, err); err == nil {
+		onDelta(textOut)
+		return textOut, nil
 	}
 
-	return nil, errors.New("no chatbot available")
+	if canned := p.nextCannedReply(); canned != "" {
+		log.Printf("WARN [PrioritizedChatbot] all Chatbots failed: %v, use canned reply: %q", err, canned)
+		textOut := cannedReply(textIn, canned)
+		onDelta(textOut)
+		return textOut, nil
+	}
+	log.Printf("ERROR [PrioritizedChatbot] all Chatbots failed: %v, return nil", err)
+	return nil, err
 }
 
-func NewPrioritizedChatbot(chatbots map[model.Priority]Chatbot) Chatbot {
-	return &PrioritizedChatbot{
-		chatbots: chatbots,
+// chatLevelStream calls ChatStream of the Chatbot at the level, canceling
+// it if no piece arrives within the level's timeout.
+// delivered reports whether any piece has been passed to onDelta.
+func (p *PrioritizedChatbot) chatLevelStream(ctx context.Context, level model.Priority, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (textOut *model.TextOut, delivered bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timeout := p.levelTimeout(level)
+	var firstPiece *time.Timer
+	if timeout > 0 {
+		firstPiece = time.AfterFunc(timeout, cancel)
+		defer firstPiece.Stop()
+	}
+
+	chatbot := p.chatbots[level]
+	textOut, err = WithStream(chatbot).ChatStream(ctx, textIn, func(delta *model.TextOut) {
+		if firstPiece != nil {
+			firstPiece.Stop()
+		}
+		delivered = true
+		onDelta(delta)
+	})
+	if err == nil && textOut == nil {
+		err = fmt.Errorf("%T.ChatStream returns nil", chatbot)
+	}
+	if err != nil {
+		if !delivered && timeout > 0 && ctx.Err() != nil {
+			err = fmt.Errorf("no answer in %v: %w", timeout, err)
+		}
+		return nil, delivered, fmt.Errorf("level %v (%T): %w", level, chatbot, err)
+	}
+	textOut.SetMeta(model.MetaChatbotLevel, level)
+	return textOut, delivered, nil
+}
+
+// SetPrompt sets the prompt of the levels and the fallback that are
+// PromptSetters. See PromptSetter.
+func (p *PrioritizedChatbot) SetPrompt(prompt string) error {
+	var errs []error
+	for _, chatbot := range p.all() {
+		if _, err := SetPrompt(chatbot, prompt); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", chatbot, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// all returns the levels and the fallback (if any).
+func (p *PrioritizedChatbot) all() []Chatbot {
+	chatbots := make([]Chatbot, 0, len(p.chatbots)+1)
+	if p.fallback != nil {
+		chatbots = append(chatbots, p.fallback)
+	}
+	for _, chatbot := range p.chatbots {
+		if chatbot != nil {
+			chatbots = append(chatbots, chatbot)
+		}
+	}
+	return chatbots
+}
+
+// Close closes the levels and the fallback that are io.Closer
+// (e.g. saving the memory).
+func (p *PrioritizedChatbot) Close() error {
+	var errs []error
+	for _, chatbot := range p.all() {
+		if c, ok := chatbot.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *PrioritizedChatbot) observe(textIn *model.TextIn, textOut *model.TextOut, err error) {
+	if p.observer != nil {
+		p.observer(textIn, textOut, err)
+	}
+}
+
+func (p *PrioritizedChatbot) nextCannedReply() string {
+	p.cannedMu.Lock()
+	defer p.cannedMu.Unlock()
+
+	if len(p.cannedReplies) == 0 {
+		return ""
 	}
+	reply := p.cannedReplies[p.cannedIndex%len(p.cannedReplies)]
+	p.cannedIndex++
+	return reply
 }
 
 // endregion PrioritizedChatbot
@@ -0,0 +1,215 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+// fakeChatbot replies its name after the delay, or fails if err is set.
+type fakeChatbot struct {
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (f *fakeChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return textIn.Reply(f.name, f.name), nil
+}
+
+func TestPrioritizedChatbot(t *testing.T) {
+	slow := &fakeChatbot{name: "slow", delay: 200 * time.Millisecond}
+	fast := &fakeChatbot{name: "fast", delay: 10 * time.Millisecond}
+	broken := &fakeChatbot{name: "broken", err: errors.New("broken")}
+
+	tests := []struct {
+		name     string
+		chatbots map[model.Priority]Chatbot
+		opts     []PrioritizedChatbotOption
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "highFirst",
+			chatbots: map[model.Priority]Chatbot{0: fast, 1: slow},
+			want:     "slow",
+		},
+		{
+			name:     "failThenFallback",
+			chatbots: map[model.Priority]Chatbot{0: fast, 1: broken},
+			want:     "fast",
+		},
+		{
+			name:     "levelTimeout",
+			chatbots: map[model.Priority]Chatbot{0: fast, 1: slow},
+			opts:     []PrioritizedChatbotOption{WithLevelTimeout(1, 50*time.Millisecond)},
+			want:     "fast",
+		},
+		{
+			name:     "hedged",
+			chatbots: map[model.Priority]Chatbot{0: fast, 1: slow},
+			opts:     []PrioritizedChatbotOption{WithHedgeDelay(20 * time.Millisecond)},
+			want:     "fast",
+		},
+		{
+			name:     "hedgedHighAnswersFirst",
+			chatbots: map[model.Priority]Chatbot{0: slow, 1: fast},
+			opts:     []PrioritizedChatbotOption{WithHedgeDelay(100 * time.Millisecond)},
+			want:     "fast",
+		},
+		{
+			name:     "canned",
+			chatbots: map[model.Priority]Chatbot{0: broken},
+			opts:     []PrioritizedChatbotOption{WithCannedReplies("canned")},
+			want:     "canned",
+		},
+		{
+			name:     "allFailed",
+			chatbots: map[model.Priority]Chatbot{0: broken, 1: broken},
+			opts:     []PrioritizedChatbotOption{WithHedgeDelay(time.Millisecond)},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPrioritizedChatbot(tt.chatbots, tt.opts...)
+			textIn := model.NewTextIn(model.SourceDm, "a", "hi", 1)
+
+			textOut, err := p.Chat(textIn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Chat() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if textOut.Content != tt.want {
+				t.Errorf("Chat() = %q, want %q", textOut.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrioritizedChatbot_Cancel(t *testing.T) {
+	p := NewPrioritizedChatbot(
+		map[model.Priority]Chatbot{0: &fakeChatbot{name: "slow", delay: time.Second}},
+		WithCannedReplies("canned"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.ChatContext(ctx, model.NewTextIn(model.SourceDm, "a", "hi", 0))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ChatContext() err = %v, want DeadlineExceeded", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("ChatContext() not canceled in time")
+	}
+}
+
+// ctxChatbot blocks until ctx is done.
+type ctxChatbot struct{ canceled chan struct{} }
+
+func (c *ctxChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatContext(context.Background(), textIn)
+}
+
+func (c *ctxChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	<-ctx.Done()
+	close(c.canceled)
+	return nil, ctx.Err()
+}
+
+func TestWithContext(t *testing.T) {
+	cc := &ctxChatbot{canceled: make(chan struct{})}
+	if WithContext(cc) != ContextChatbot(cc) {
+		t.Error("WithContext(ContextChatbot) should return itself")
+	}
+
+	old := WithContext(&fakeChatbot{name: "old", delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := old.ChatContext(ctx, model.NewTextIn(model.SourceDm, "a", "hi", 0)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("adapter ChatContext() err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestTextOutFromChatbot_Cancel(t *testing.T) {
+	cc := &ctxChatbot{canceled: make(chan struct{})}
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{0: cc})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	textInChan := make(chan *model.TextIn, 1)
+	textOutChan := make(chan *model.TextOut, 1)
+	done := make(chan struct{})
+	go func() {
+		TextOutFromChatbot(ctx, p, textInChan, textOutChan)
+		close(done)
+	}()
+
+	textInChan <- model.NewTextIn(model.SourceDm, "a", "hi", 0)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-cc.canceled: // the in-flight chat is canceled
+	case <-time.After(time.Second):
+		t.Fatal("in-flight ChatContext not canceled")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TextOutFromChatbot not returned")
+	}
+}
+
+func TestPrioritizedChatbot_Fallback(t *testing.T) {
+	broken := &fakeChatbot{name: "broken", err: errors.New("broken")}
+	fallback := &fakeChatbot{name: "fallback"}
+
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{0: broken},
+		WithFallback(fallback), WithCannedReplies("canned"))
+	// the fallback is reachable even if there is no level for the priority
+	for _, priority := range []model.Priority{0, model.PriorityHighest} {
+		textOut, err := p.Chat(model.NewTextIn(model.SourceDm, "a", "hi", priority))
+		if err != nil || textOut.Content != "fallback" {
+			t.Errorf("Chat(priority=%v) = %v, %v, want fallback", priority, textOut, err)
+		}
+	}
+
+	p = NewPrioritizedChatbot(map[model.Priority]Chatbot{0: broken},
+		WithFallback(broken), WithCannedReplies("canned"))
+	if textOut, err := p.Chat(model.NewTextIn(model.SourceDm, "a", "hi", 0)); err != nil || textOut.Content != "canned" {
+		t.Errorf("Chat() = %v, %v, want canned reply after the fallback failed", textOut, err)
+	}
+}
+
+type closerChatbot struct {
+	fakeChatbot
+	err    error
+	closed bool
+}
+
+func (c *closerChatbot) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestPrioritizedChatbot_Close(t *testing.T) {
+	level := &closerChatbot{fakeChatbot: fakeChatbot{name: "level"}}
+	fallback := &closerChatbot{fakeChatbot: fakeChatbot{name: "fallback"}, err: errors.New("close fallback")}
+
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{0: level}, WithFallback(fallback))
+	if err := p.Close(); !errors.Is(err, fallback.err) {
+		t.Errorf("Close() = %v, want the error of the fallback", err)
+	}
+	if !level.closed || !fallback.closed {
+		t.Errorf("closed: level=%v, fallback=%v, want both", level.closed, fallback.closed)
+	}
+}
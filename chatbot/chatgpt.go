@@ -1,11 +1,10 @@
 package chatbot
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"muvtuberdriver/model"
-	"time"
+	"muvtuberdriver/pkg/ratelimit"
 )
 
 // ChatGPTConfig is the config to a ChatGPT Chatbot server session.
@@ -38,10 +37,15 @@ func (c ChatGPTConfig) InitPrompt() string {
 // that uses the ChatGPT API.
 type chatGPTChatbot struct {
 	*SessionClientsPool
-	Cooldown
+	limiter *ratelimit.Limiter // nil for no limit
+
+	configs []ChatGPTConfig // as created: SetPrompt replaces the InitialPrompt of them
 }
 
-func NewChatGPTChatbot(addr string, cooldown time.Duration, configs ...ChatGPTConfig) (Chatbot, error) {
+// NewChatGPTChatbot creates a ChatGPT Chatbot, rate limited by the limiter
+// (nil for no limit), whose sessions are recycled as the lifecycle says.
+// It's an io.Closer: Close deletes the sessions.
+func NewChatGPTChatbot(addr string, limiter *ratelimit.Limiter, lifecycle SessionLifecycle, configs ...ChatGPTConfig) (Chatbot, error) {
 	scp, err := NewSessionClientsPool(addr, CastToChatbotConfig(configs)...)
 	if err != nil {
 		return nil, err
@@ -49,20 +53,46 @@ func NewChatGPTChatbot(addr string, cooldown time.Duration, configs ...ChatGPTCo
 
 	scp.Name = "ChatGPTChatbot"
 	scp.Verbose = true
+	scp.Lifecycle = lifecycle
 
 	return &chatGPTChatbot{
 		SessionClientsPool: scp,
-		Cooldown:           Cooldown{Interval: cooldown},
+		limiter:            limiter,
+		configs:            configs,
 	}, nil
 }
 
 func (c *chatGPTChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
-	if !c.TryCooldown() {
-		return nil, fmt.Errorf("%w: %v / %v", ErrCooldown,
-			c.CooldownLeftTime(), c.Interval)
+	return c.ChatContext(context.Background(), textIn)
+}
+
+func (c *chatGPTChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	if err := takeToken(c.limiter); err != nil {
+		return nil, err
 	}
 
-	return c.SessionClientsPool.Chat(textIn)
+	return c.SessionClientsPool.ChatContext(ctx, textIn)
 }
 
-var ErrCooldown = errors.New("Chatbot is cooling down")
+// ChatStream implements the StreamChatbot interface, with the rate limit.
+func (c *chatGPTChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if err := takeToken(c.limiter); err != nil {
+		return nil, err
+	}
+
+	return c.SessionClientsPool.ChatStream(ctx, textIn, onDelta)
+}
+
+// SetPrompt replaces the InitialPrompt of the configs, and starts new
+// sessions with them (see SessionClientsPool.SetConfigs).
+// An empty prompt restores the InitialPrompts in the configs.
+func (c *chatGPTChatbot) SetPrompt(prompt string) error {
+	configs := make([]ChatGPTConfig, len(c.configs))
+	for i, config := range c.configs {
+		configs[i] = config
+		if prompt != "" {
+			configs[i].InitialPrompt = prompt
+		}
+	}
+	return c.SessionClientsPool.SetConfigs(CastToChatbotConfig(configs)...)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	chatbotv2 "muvtuberdriver/chatbot/proto"
@@ -14,7 +17,9 @@ import (
 
 	"golang.org/x/exp/slog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 var MaxConsecutiveFailures = 3
@@ -29,6 +34,8 @@ type Client struct {
 
 	RPCTimeout time.Duration
 
+	noStream atomic.Bool // the server does not implement ChatStream: use Chat instead
+
 	pool.Poolable // 其实这种写法不对，好像，嵌入一个 interface 是用来 wrap interface 的，不是用来提示实现了哪些接口的。。。see sort.Reverse
 }
 
@@ -81,8 +88,16 @@ func CastToChatbotConfig[T ChatbotConfig](configs []T) []ChatbotConfig {
 }
 
 func (c *Client) NewSession(config ChatbotConfig) (*Session, error) {
+	return c.NewSessionContext(context.Background(), config)
+}
+
+// NewSessionContext is NewSession with a context.
+func (c *Client) NewSessionContext(ctx context.Context, config ChatbotConfig) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.RPCTimeout)
+	defer cancel()
+
 	resp, err := c.client.NewSession(
-		context.Background(),
+		ctx,
 		&chatbotv2.NewSessionRequest{
 			Config:        config.Config(),
 			InitialPrompt: config.InitPrompt(),
@@ -123,34 +138,61 @@ type Session struct {
 }
 
 // Chat implements the Chatbot interface.
+func (s *Session) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return s.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface.
 //
 // It calls the chat to do the RPC, handles the error (successive failures),
 // and construct the response (TextOut).
-func (s *Session) Chat(textIn *model.TextIn) (*model.TextOut, error) {
-	respContent, err := s.chat(textIn.Content)
+//
+// Canceled by the caller (ctx done) is not counted as a failure of the session.
+func (s *Session) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return s.reply(ctx, textIn, s.chat)
+}
+
+// ChatStream implements the StreamChatbot interface: it does the ChatStream
+// RPC, and calls onDelta with each piece of the response as it arrives.
+//
+// If the server does not implement ChatStream, it falls back to Chat
+// (the whole response is one delta).
+func (s *Session) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	return s.reply(ctx, textIn, func(ctx context.Context, prompt string) (string, error) {
+		return s.chatStream(ctx, prompt, func(piece string) {
+			onDelta(textIn.Reply(s.authorName(), piece))
+		})
+	})
+}
+
+// reply calls the chat to do the RPC, handles the error (successive failures),
+// and construct the response (TextOut).
+func (s *Session) reply(ctx context.Context, textIn *model.TextIn, chat func(ctx context.Context, prompt string) (string, error)) (*model.TextOut, error) {
+	respContent, err := chat(ctx, textIn.Content)
 
 	if err != nil {
-		s.successiveFailures++
+		if ctx.Err() == nil {
+			s.successiveFailures++
+		}
 		return nil, err
 	}
 	s.successiveFailures = 0
 
+	resp := textIn.Reply(s.authorName(), respContent)
+
+	return resp, nil
+}
+
+func (s *Session) authorName() string {
 	if s.AuthorName == "" {
 		s.AuthorName = "AnonymousChatbot"
 	}
-
-	resp := &model.TextOut{
-		Author:   s.AuthorName,
-		Content:  respContent,
-		Priority: textIn.Priority,
-	}
-
-	return resp, nil
+	return s.AuthorName
 }
 
 // chat do PRC (with timeout). Returns the text content of response from Chatbot.
-func (s *Session) chat(prompt string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), s.client.RPCTimeout)
+func (s *Session) chat(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.client.RPCTimeout)
 	defer cancel()
 
 	resp, err := s.client.client.Chat(ctx, &chatbotv2.ChatRequest{
@@ -165,6 +207,56 @@ func (s *Session) chat(prompt string) (string, error) {
 	return resp.GetResponse(), nil
 }
 
+// chatStream do the streaming RPC (with timeout): onPiece is called with
+// each piece of the response. Returns the whole response.
+func (s *Session) chatStream(ctx context.Context, prompt string, onPiece func(piece string)) (string, error) {
+	if s.client.noStream.Load() {
+		return s.chatAsStream(ctx, prompt, onPiece)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.client.RPCTimeout)
+	defer cancel()
+
+	stream, err := s.client.client.ChatStream(ctx, &chatbotv2.ChatRequest{
+		SessionId: s.SessionID,
+		Prompt:    prompt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if status.Code(err) == codes.Unimplemented && sb.Len() == 0 {
+			// an old server: remember it, and do not try again.
+			s.client.noStream.Store(true)
+			slog.Warn("[chatbot] ChatStream is not implemented by the server, fall back to Chat.")
+			return s.chatAsStream(ctx, prompt, onPiece)
+		}
+		if err != nil {
+			return "", err
+		}
+		if piece := resp.GetResponse(); piece != "" {
+			sb.WriteString(piece)
+			onPiece(piece)
+		}
+	}
+}
+
+// chatAsStream does the unary Chat and yields the whole response as one piece.
+func (s *Session) chatAsStream(ctx context.Context, prompt string, onPiece func(piece string)) (string, error) {
+	resp, err := s.chat(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	onPiece(resp)
+	return resp, nil
+}
+
 // Close the ChatbotSession by calling the DeleteSession RPC.
 func (s *Session) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.client.RPCTimeout)
@@ -214,6 +306,9 @@ type SessionClient struct {
 	client  *Client
 	session *Session
 
+	sessionCreated time.Time // when the session was created: for SessionLifecycle.MaxAge
+	chats          int       // successful chats in the session: for SessionLifecycle.MaxChats
+
 	Name string // the name of the chatbot: for Session.AuthorName
 
 	Quiet bool // if true, it will not log.
@@ -234,11 +329,23 @@ func NewSessionClient(addr string, config ChatbotConfig) (*SessionClient, error)
 }
 
 // Chat implements the Chatbot interface.
+func (c *SessionClient) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface.
 // It do the RPC, and returns the response.
 //
 // if session is not created, it creates a new one.
 // if client is not created, it creates a new one.
-func (c *SessionClient) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+func (c *SessionClient) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatStream(ctx, textIn, nil)
+}
+
+// ChatStream implements the StreamChatbot interface. See Session.ChatStream.
+//
+// A nil onDelta means not streaming: the unary Chat RPC is used.
+func (c *SessionClient) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
 	if textIn == nil {
 		return nil, errors.New("textIn is nil")
 	}
@@ -249,11 +356,11 @@ func (c *SessionClient) Chat(textIn *model.TextIn) (*model.TextOut, error) {
 	if err := c.initClientIfNil(); err != nil {
 		return nil, err
 	}
-	if err := c.initSessionIfNil(); err != nil {
+	if err := c.initSessionIfNil(ctx); err != nil {
 		return nil, err
 	}
 
-	return c.chat(textIn)
+	return c.chat(ctx, textIn, onDelta)
 }
 
 func (c *SessionClient) initClientIfNil() error {
@@ -276,12 +383,12 @@ func (c *SessionClient) initClientIfNil() error {
 	return nil
 }
 
-func (c *SessionClient) initSessionIfNil() error {
+func (c *SessionClient) initSessionIfNil(ctx context.Context) error {
 	if c.session != nil {
 		return nil
 	}
 
-	session, err := c.client.NewSession(c.config)
+	session, err := c.client.NewSessionContext(ctx, c.config)
 	if err != nil {
 		err = fmt.Errorf("NewSession(addr=%v) failed: %w", c.addr, err)
 		return err
@@ -290,6 +397,8 @@ func (c *SessionClient) initSessionIfNil() error {
 	session.AuthorName = c.Name
 
 	c.session = session
+	c.sessionCreated = time.Now()
+	c.chats = 0
 
 	if !c.Quiet {
 		slog.Info("[chatbot] SessionClient Chat: NewSession created.",
@@ -299,9 +408,15 @@ func (c *SessionClient) initSessionIfNil() error {
 	return nil
 }
 
-// chat calls session.Chat and logs.
-func (c *SessionClient) chat(textIn *model.TextIn) (*model.TextOut, error) {
-	textOut, err := c.session.Chat(textIn)
+// chat calls session.ChatContext (or ChatStream if onDelta is not nil) and logs.
+func (c *SessionClient) chat(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	var textOut *model.TextOut
+	var err error
+	if onDelta != nil {
+		textOut, err = c.session.ChatStream(ctx, textIn, onDelta)
+	} else {
+		textOut, err = c.session.ChatContext(ctx, textIn)
+	}
 
 	if err != nil {
 		err = fmt.Errorf("Chat(addr=%v) failed: %w", c.addr, err)
@@ -310,6 +425,7 @@ func (c *SessionClient) chat(textIn *model.TextIn) (*model.TextOut, error) {
 	if textOut == nil {
 		return nil, errors.New("textOut is nil")
 	}
+	c.chats++
 
 	if !c.Quiet {
 		slog.Info("[chatbot] SessionClient Chat success.",
@@ -344,6 +460,68 @@ func (c *SessionClient) SuccessiveFailures() int {
 	return c.session.SuccessiveFailures()
 }
 
+// Chats returns the number of successful chats in the session.
+func (c *SessionClient) Chats() int {
+	return c.chats
+}
+
+// Age returns how long the session has lived. 0 if not created yet.
+func (c *SessionClient) Age() time.Duration {
+	if c.session == nil {
+		return 0
+	}
+	return time.Since(c.sessionCreated)
+}
+
+// SessionLifecycle decides when a SessionClient in a SessionClientsPool
+// is recycled: closed (the remote session deleted) and replaced by a new
+// one lazily. The context of a ChatGPT session grows with every chat,
+// until the backend refuses it.
+//
+// The zero value keeps the sessions until they fail MaxConsecutiveFailures
+// times. A session failed with a context length error (see
+// IsContextLengthError) is recycled anyway.
+type SessionLifecycle struct {
+	MaxChats int           // recycle after so many successful chats. 0 for no limit
+	MaxAge   time.Duration // recycle the sessions older than this. 0 for no limit
+}
+
+// recycleReason returns why the SessionClient should be recycled,
+// or "" to keep it.
+func (l SessionLifecycle) recycleReason(c *SessionClient) string {
+	switch {
+	case l.MaxChats > 0 && c.Chats() >= l.MaxChats:
+		return "max chats"
+	case l.MaxAge > 0 && c.Age() >= l.MaxAge:
+		return "max age"
+	}
+	return ""
+}
+
+// contextLengthErrors are (lowercased) parts of the error messages from
+// the backends when the conversation is too long for the model.
+var contextLengthErrors = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context length exceeded",
+	"reduce the length of the messages",
+}
+
+// IsContextLengthError reports whether the err is from a backend that
+// refuses the session because its context is too long.
+func IsContextLengthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range contextLengthErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
 // SessionClientsPool is a pool of SessionClient.
 //
 // SessionClientsPool implements the Chatbot interface.
@@ -352,13 +530,22 @@ func (c *SessionClient) SuccessiveFailures() int {
 //	ccsp, _ := NewSessionClientsPool(addr, config{"you are hatsune miku"})
 //	textOut, _ := ccsp.Chat(textIn).
 type SessionClientsPool struct {
-	// pool holds the ChatbotClientWithSessions.
-	pool pool.Pool[*SessionClient]
+	// pool holds the SessionClients of the current configs.
+	// It's replaced by SetConfigs.
+	pool   *sessionPool
+	poolMu sync.RWMutex
+
+	addr    string
+	breaker *CircuitBreaker // shared by all the pools to addr
 
 	configs       []ChatbotConfig
 	nextConfigIdx int
 	configsMu     sync.Mutex
 
+	closed bool // by Close: guarded by poolMu
+
+	Lifecycle SessionLifecycle // when to recycle the sessions
+
 	// ⬇️ 这些都是可选的：我觉得这层可以打日志了，别麻烦调用者。但又觉得这样不太好，耦合功能了。
 
 	Verbose bool   // if true, it will log the errors.
@@ -376,16 +563,89 @@ func NewSessionClientsPool(addr string, configs ...ChatbotConfig) (*SessionClien
 	}
 	ccsp := &SessionClientsPool{
 		configs: configs,
+		addr:    addr,
+		breaker: CircuitBreakerOf(addr),
 	}
 
-	ccsp.pool = pool.NewPool(
+	ccsp.pool = ccsp.newSessionPool()
+
+	return ccsp, nil
+}
+
+// newSessionPool creates a sessionPool whose SessionClients are created
+// with the configs in a round-robin fashion.
+func (p *SessionClientsPool) newSessionPool() *sessionPool {
+	sp := &sessionPool{}
+	sp.Pool = pool.NewPool(
 		DefaultClientPoolSize,
 		func() (*SessionClient, error) {
-			return NewSessionClient(addr, ccsp.nextConfig())
+			if sp.isRetired() {
+				return nil, errPoolRetired
+			}
+			return NewSessionClient(p.addr, p.nextConfig())
 		},
 	)
+	return sp
+}
 
-	return ccsp, nil
+// currentPool returns the pool of the current configs.
+func (p *SessionClientsPool) currentPool() *sessionPool {
+	p.poolMu.RLock()
+	defer p.poolMu.RUnlock()
+	return p.pool
+}
+
+// SetConfigs replaces the configs (e.g. to switch the persona), and
+// drains the pool: the idle SessionClients are closed (their sessions
+// deleted) right now, and the ones in use are closed when they are done.
+// New sessions are created with the new configs lazily.
+func (p *SessionClientsPool) SetConfigs(configs ...ChatbotConfig) error {
+	if len(configs) == 0 {
+		return errors.New("configs is empty")
+	}
+
+	p.poolMu.Lock()
+	if p.closed {
+		p.poolMu.Unlock()
+		return ErrPoolClosed
+	}
+	p.configsMu.Lock()
+	p.configs = configs
+	p.nextConfigIdx = 0
+	p.configsMu.Unlock()
+
+	old := p.pool
+	p.pool = p.newSessionPool()
+	p.poolMu.Unlock()
+
+	closed, err := old.retire()
+	slog.Info("[chatbot] SessionClientsPool configs changed, old sessions closed.",
+		"chatbot", p.Name, "configs", len(configs), "closed", closed, "err", err)
+	return nil
+}
+
+// Close closes the pool gracefully: the idle SessionClients are closed
+// (their remote sessions deleted) right now, and it waits (at most
+// SessionPoolCloseTimeout) for the ones in use to be done and closed.
+// No more chats after Close.
+func (p *SessionClientsPool) Close() error {
+	p.poolMu.Lock()
+	if p.closed {
+		p.poolMu.Unlock()
+		return nil
+	}
+	p.closed = true
+	sp := p.pool
+	p.poolMu.Unlock()
+
+	closed, err := sp.retire()
+	done := sp.wait(SessionPoolCloseTimeout)
+	slog.Info("[chatbot] SessionClientsPool closed.",
+		"chatbot", p.Name, "closed", closed, "allDone", done, "err", err)
+	if !done {
+		err = errors.Join(err, fmt.Errorf("timeout waiting for the sessions in use (%v): they are not closed", SessionPoolCloseTimeout))
+	}
+	return err
 }
 
 // Chat implements the Chatbot interface.
@@ -396,7 +656,18 @@ func NewSessionClientsPool(addr string, configs ...ChatbotConfig) (*SessionClien
 // 可以这样来包装错误，**推迟**或**集中**日志的打印工作，避免代码里到处是 log。
 // 只是一种实验。
 func (p *SessionClientsPool) Chat(textIn *model.TextIn) (*model.TextOut, error) {
-	textOut, err := p.chat(textIn)
+	return p.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface. See Chat.
+func (p *SessionClientsPool) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return p.ChatStream(ctx, textIn, nil)
+}
+
+// ChatStream implements the StreamChatbot interface. See Chat and
+// Session.ChatStream. A nil onDelta means not streaming.
+func (p *SessionClientsPool) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	textOut, err := p.chat(ctx, textIn, onDelta)
 	if err != nil && p.Verbose {
 		if p.Name == "" {
 			p.Name = "SessionClientsPool"
@@ -416,36 +687,127 @@ func (p *SessionClientsPool) Chat(textIn *model.TextIn) (*model.TextOut, error)
 	return textOut, err
 }
 
-// chat gets a SessionClient from the pool, and calls Chat on it.
-func (p *SessionClientsPool) chat(textIn *model.TextIn) (*model.TextOut, error) {
+// Available reports whether the backend can be called right now:
+// false if its circuit is open.
+func (p *SessionClientsPool) Available() bool {
+	return p.breaker.Ready()
+}
+
+// chat gets a SessionClient from the pool, and calls ChatStream on it.
+//
+// The result is reported to the circuit breaker of the backend:
+// it fails fast with ErrCircuitOpen if the backend is broken.
+func (p *SessionClientsPool) chat(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if !p.breaker.Allow() {
+		return nil, fmt.Errorf("%w: serAddr=%v", ErrCircuitOpen, p.addr)
+	}
+
+	textOut, err := p.chatSession(ctx, textIn, onDelta)
+	switch {
+	case err == nil:
+		p.breaker.Success()
+	case ctx.Err() != nil: // canceled by the caller: not the backend's fault
+		p.breaker.Release()
+	default:
+		p.breaker.Failure()
+	}
+	return textOut, err
+}
+
+// chatSession gets a SessionClient from the pool, and calls ChatStream on it.
+//
+// If the session is refused for its too long context, it's recycled, and
+// the textIn is asked again (once) in a new session. The backends refuse
+// it before responding anything, so no delta is repeated.
+func (p *SessionClientsPool) chatSession(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	textOut, err := p.chatSessionOnce(ctx, textIn, onDelta)
+	if IsContextLengthError(err) && ctx.Err() == nil {
+		textOut, err = p.chatSessionOnce(ctx, textIn, onDelta)
+	}
+	return textOut, err
+}
+
+// getSession gets a SessionClient from the current pool.
+// The ones to be recycled (e.g. too old) are closed and skipped.
+func (p *SessionClientsPool) getSession() (*sessionPool, *SessionClient, error) {
+	for {
+		sp := p.currentPool()
+		session, err := sp.get()
+		if errors.Is(err, errPoolRetired) && !p.isClosed() { // SetConfigs just now: try the new pool
+			sp = p.currentPool()
+			session, err = sp.get()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if session == nil {
+			panic("get a nil session from the pool")
+		}
+		if reason := p.Lifecycle.recycleReason(session); reason != "" {
+			p.recycle(sp, session, reason)
+			continue
+		}
+		return sp, session, nil
+	}
+}
+
+func (p *SessionClientsPool) isClosed() bool {
+	p.poolMu.RLock()
+	defer p.poolMu.RUnlock()
+	return p.closed
+}
+
+// recycle closes the SessionClient (deletes the remote session) and
+// releases it from the pool: a new one will be created lazily.
+func (p *SessionClientsPool) recycle(sp *sessionPool, session *SessionClient, reason string) {
+	sessionID := ""
+	if session.session != nil {
+		sessionID = ellipsis.Ending(session.session.SessionID, 10)
+	}
+	err := sp.release(session)
+	slog.Info("[chatbot] SessionClient recycled.",
+		"chatbot", p.Name, "reason", reason, "sessionID", sessionID,
+		"chats", session.Chats(), "age", session.Age().Round(time.Second), "err", err)
+}
+
+// chatSessionOnce gets a SessionClient from the pool, and calls ChatStream on it.
+func (p *SessionClientsPool) chatSessionOnce(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
 	// get a session from the pool
-	session, err := p.pool.Get()
+	sp, session, err := p.getSession()
 	if err != nil {
 		err = fmt.Errorf("%w: err=%w", ErrGetSessionClient, err)
 		return nil, err
 	}
-	if session == nil {
-		panic("get a nil session from the pool")
-	}
 	if session.Name == "" {
 		session.Name = p.Name
 	}
 
 	// call Chat on the client session
-	textOut, err := session.Chat(textIn)
+	textOut, err := session.ChatStream(ctx, textIn, onDelta)
 
 	// put the session back into the pool or release it
 	// and return the result
 	switch {
 	case err == nil:
-		// success: put it back into the pool
-		p.pool.Put(session)
+		// success: put it back into the pool, unless it's time to recycle it
+		if reason := p.Lifecycle.recycleReason(session); reason != "" {
+			p.recycle(sp, session, reason)
+		} else {
+			sp.put(session)
+		}
 
 		return textOut, nil
 
+	case err != nil && IsContextLengthError(err):
+		// the context is too long: the session is useless anymore
+		p.recycle(sp, session, "context length")
+
+		err = fmt.Errorf("%w: serAddr=%v err=%w", ErrChatFailed, session.addr, err)
+		return nil, err
+
 	case err != nil && (session.SuccessiveFailures() >= MaxConsecutiveFailures):
 		// too many failures: won't reuse this session anymore: release it from the pool (close it)
-		p.pool.Release(session)
+		sp.release(session)
 
 		// do not log session: it cantains the CONFIG which may leak OpenAI API key.
 		err = fmt.Errorf("%w: serAddr=%v failures=%v/%v err=%w", ErrChatMaxFailures,
@@ -455,7 +817,7 @@ func (p *SessionClientsPool) chat(textIn *model.TextIn) (*model.TextOut, error)
 
 	case err != nil:
 		// put it back into the pool: try to reuse it
-		p.pool.Put(session)
+		sp.put(session)
 
 		err = fmt.Errorf("%w: serAddr=%v failures=%v/%v err=%w", ErrChatFailed,
 			session.addr, session.SuccessiveFailures(), MaxConsecutiveFailures, err)
@@ -485,7 +847,109 @@ func (p *SessionClientsPool) nextConfig() ChatbotConfig {
 	return cfg
 }
 
+// sessionPool is a pool of the SessionClients created with the same configs.
+//
+// A retired sessionPool (replaced by SetConfigs, or closed) is drained:
+// no more SessionClients are created, got or put back. They are closed
+// instead.
+//
+// Note: do not Close the pool.Pool: it blocks forever (ranging over the
+// entries channel before closing it), and so does Put on a closed pool.
+type sessionPool struct {
+	pool.Pool[*SessionClient]
+
+	mu      sync.Mutex // retire vs. get & put
+	retired atomic.Bool
+	busy    sync.WaitGroup // the SessionClients in use: got and not put back or released yet
+}
+
+var errPoolRetired = errors.New("the session pool is retired")
+
+// SessionPoolCloseTimeout is how long SessionClientsPool.Close waits for
+// the sessions in use.
+var SessionPoolCloseTimeout = 10 * time.Second
+
+func (sp *sessionPool) isRetired() bool {
+	return sp.retired.Load()
+}
+
+// get a SessionClient to use. It should be put back or released.
+func (sp *sessionPool) get() (*SessionClient, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.isRetired() {
+		return nil, errPoolRetired
+	}
+	c, err := sp.Get()
+	if err == nil {
+		sp.busy.Add(1)
+	}
+	return c, err
+}
+
+// put the SessionClient back, or close it if the pool is retired.
+func (sp *sessionPool) put(c *SessionClient) {
+	sp.mu.Lock()
+	retired := sp.isRetired()
+	if !retired {
+		sp.Put(c)
+		sp.busy.Done()
+	}
+	sp.mu.Unlock()
+
+	if retired {
+		if err := sp.release(c); err != nil {
+			slog.Warn("[chatbot] close SessionClient of a retired pool failed.", "chatbot", c.Name, "err", err)
+		}
+	}
+}
+
+// release closes the SessionClient and removes it from the pool.
+func (sp *sessionPool) release(c *SessionClient) error {
+	defer sp.busy.Done()
+	return sp.Release(c)
+}
+
+// retire the pool and close the idle SessionClients.
+// Returns the number of SessionClients closed, and the errors closing them.
+func (sp *sessionPool) retire() (closed int, err error) {
+	sp.mu.Lock()
+	sp.retired.Store(true)
+	sp.mu.Unlock()
+
+	// Get returns the idle ones, then fails (errPoolRetired) instead of creating
+	var errs []error
+	for {
+		c, err := sp.Get()
+		if err != nil {
+			return closed, errors.Join(errs...)
+		}
+		if err := sp.Release(c); err != nil {
+			slog.Warn("[chatbot] close SessionClient of a retired pool failed.", "chatbot", c.Name, "err", err)
+			errs = append(errs, err)
+		}
+		closed++
+	}
+}
+
+// wait for the SessionClients in use to be done (closed, as the pool is
+// retired), at most timeout. Reports whether they are all done.
+func (sp *sessionPool) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		sp.busy.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 var ErrGetSessionClient = errors.New("failed to get a SessionClient from the pool")
 var ErrChatFailed = errors.New("Chat() failed. The SessionClient will be released if successive failures")
 var ErrChatMaxFailures = errors.New("Chat() failed. The SessionClient was removed from the pool due to too many consecutive failures")
 var ErrUnexpectedCase = errors.New("PROGRAM REACHED A UNREACHABLE CASE")
+var ErrPoolClosed = errors.New("the SessionClientsPool is closed")
@@ -0,0 +1,219 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	chatbotv2 "muvtuberdriver/chatbot/proto"
+	"muvtuberdriver/model"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeChatbotServer is an in-process ChatbotServiceServer.
+// It echoes the prompt (streaming rune by rune in ChatStream),
+// or fails if broken is set, or with a context length error in the
+// session tooLong.
+type fakeChatbotServer struct {
+	chatbotv2.UnimplementedChatbotServiceServer
+
+	broken   atomic.Bool
+	sessions atomic.Int64 // sessions created
+	chats    atomic.Int64 // Chat RPCs received
+	deleted  atomic.Int64 // sessions deleted
+
+	initialPrompt atomic.Value // string: of the last session created
+	tooLong       atomic.Value // string: the session whose context is too long
+}
+
+func (s *fakeChatbotServer) NewSession(ctx context.Context, req *chatbotv2.NewSessionRequest) (*chatbotv2.NewSessionResponse, error) {
+	s.initialPrompt.Store(req.GetInitialPrompt())
+	n := s.sessions.Add(1)
+	return &chatbotv2.NewSessionResponse{SessionId: string(rune('a' + n))}, nil
+}
+
+func (s *fakeChatbotServer) Chat(ctx context.Context, req *chatbotv2.ChatRequest) (*chatbotv2.ChatResponse, error) {
+	s.chats.Add(1)
+	if s.broken.Load() {
+		return nil, status.Error(codes.Internal, "broken")
+	}
+	if s.tooLong.Load() == req.GetSessionId() {
+		return nil, status.Error(codes.InvalidArgument, "This model's maximum context length is 4097 tokens.")
+	}
+	return &chatbotv2.ChatResponse{Response: "echo: " + req.GetPrompt()}, nil
+}
+
+// ChatStream echoes the prompt rune by rune.
+func (s *fakeChatbotServer) ChatStream(req *chatbotv2.ChatRequest, stream chatbotv2.ChatbotService_ChatStreamServer) error {
+	s.chats.Add(1)
+	if s.broken.Load() {
+		return status.Error(codes.Internal, "broken")
+	}
+	for _, r := range "echo: " + req.GetPrompt() {
+		if err := stream.Send(&chatbotv2.ChatResponse{Response: string(r)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeChatbotServer) DeleteSession(ctx context.Context, req *chatbotv2.DeleteSessionRequest) (*chatbotv2.DeleteSessionResponse, error) {
+	s.deleted.Add(1)
+	return &chatbotv2.DeleteSessionResponse{}, nil
+}
+
+// startFakeChatbotServer serves srv on a random local port,
+// with the health service if withHealth. Stopped on test cleanup.
+func startFakeChatbotServer(t *testing.T, srv chatbotv2.ChatbotServiceServer, withHealth bool) (addr string, stop func()) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	chatbotv2.RegisterChatbotServiceServer(s, srv)
+	if withHealth {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), s.Stop
+}
+
+func TestSessionClientsPool_CircuitBreaker(t *testing.T) {
+	srv := &fakeChatbotServer{}
+	addr, _ := startFakeChatbotServer(t, srv, false)
+
+	p, err := NewSessionClientsPool(addr, NoChatbotConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	textIn := model.NewTextIn(model.SourceDm, "a", "hi", 0)
+
+	textOut, err := p.Chat(textIn)
+	if err != nil || textOut.Content != "echo: hi" {
+		t.Fatalf("Chat() = %v, %v", textOut, err)
+	}
+
+	srv.broken.Store(true)
+	for i := 0; i < MaxConsecutiveFailures; i++ {
+		if _, err := p.Chat(textIn); err == nil {
+			t.Fatal("Chat() to a broken server: want error")
+		}
+	}
+	if p.Available() {
+		t.Error("Available() = true after too many failures")
+	}
+
+	chats := srv.chats.Load()
+	if _, err := p.Chat(textIn); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Chat() err = %v, want ErrCircuitOpen", err)
+	}
+	if srv.chats.Load() != chats {
+		t.Error("Chat() with an open circuit should not call the server")
+	}
+}
+
+func TestSessionClientsPool_Lifecycle(t *testing.T) {
+	srv := &fakeChatbotServer{}
+	addr, _ := startFakeChatbotServer(t, srv, false)
+
+	p, err := NewSessionClientsPool(addr, NoChatbotConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Lifecycle = SessionLifecycle{MaxChats: 2}
+	textIn := model.NewTextIn(model.SourceDm, "a", "hi", 0)
+	chat := func() {
+		t.Helper()
+		if _, err := p.Chat(textIn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, sessions, deleted int64) {
+		t.Helper()
+		if s, d := srv.sessions.Load(), srv.deleted.Load(); s != sessions || d != deleted {
+			t.Errorf("%s: sessions created = %v, deleted = %v; want %v, %v", step, s, d, sessions, deleted)
+		}
+	}
+
+	chat()
+	chat()
+	chat()
+	check("max chats", 2, 1)
+
+	// the context of the current session is too long: recycled, and asked again in a new one
+	srv.tooLong.Store(string(rune('a' + srv.sessions.Load())))
+	chat()
+	check("context length", 3, 2)
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check("close", 3, 3)
+	if _, err := p.Chat(textIn); !errors.Is(err, ErrGetSessionClient) {
+		t.Errorf("Chat() after Close: err = %v, want ErrGetSessionClient", err)
+	}
+}
+
+func TestChatGPTChatbot_SetPrompt(t *testing.T) {
+	srv := &fakeChatbotServer{}
+	addr, _ := startFakeChatbotServer(t, srv, false)
+
+	bot, err := NewChatGPTChatbot(addr, nil, SessionLifecycle{}, ChatGPTConfig{InitialPrompt: "you are muli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := func() {
+		t.Helper()
+		if _, err := bot.Chat(model.NewTextIn(model.SourceDm, "a", "hi", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, prompt := range []string{"", "你是一只猫娘", ""} {
+		if prompt != "" || i > 0 {
+			if _, err := SetPrompt(bot, prompt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chat()
+		chat() // the same session
+
+		want := prompt
+		if want == "" {
+			want = "you are muli"
+		}
+		if got := srv.initialPrompt.Load(); got != want {
+			t.Errorf("#%d initial prompt = %q, want %q", i, got, want)
+		}
+		if sessions, deleted := srv.sessions.Load(), srv.deleted.Load(); sessions != int64(i+1) || deleted != int64(i) {
+			t.Errorf("#%d sessions created = %v, deleted = %v; want %v, %v", i, sessions, deleted, i+1, i)
+		}
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	withHealth, _ := startFakeChatbotServer(t, &fakeChatbotServer{}, true)
+	withoutHealth, _ := startFakeChatbotServer(t, &fakeChatbotServer{}, false)
+	down, stop := startFakeChatbotServer(t, &fakeChatbotServer{}, true)
+	stop()
+
+	ctx := context.Background()
+	if err := ProbeHealth(ctx, withHealth); err != nil {
+		t.Errorf("ProbeHealth(withHealth) = %v", err)
+	}
+	if err := ProbeHealth(ctx, withoutHealth); err != nil {
+		t.Errorf("ProbeHealth(withoutHealth) = %v", err)
+	}
+	if err := ProbeHealth(ctx, down); err == nil {
+		t.Error("ProbeHealth(down) = nil, want error")
+	}
+}
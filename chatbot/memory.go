@@ -0,0 +1,520 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"muvtuberdriver/model"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// region MemoryChatbot
+
+// MemoryChatbot wraps a Chatbot with conversation memory.
+//
+// The wrapped Chatbot only sees the prompt. MemoryChatbot keeps a rolling
+// transcript of the room (all viewers) and of each author, and rewrites the
+// prompt as:
+//
+//	[最近的对话]
+//	A：你好
+//	你：你好呀
+//	[关于 B]
+//	B 来过 3 次。之前 B 说：……
+//	[现在]
+//	B 说：在吗
+//
+// The context block is compacted to fit the budget (in runes): older lines
+// are dropped first, the current message is always kept.
+//
+// The memory can be persisted to a JSON file, so regulars are remembered
+// across restarts.
+//
+// A stateful backend (e.g. a ChatGPT session) keeps the conversation
+// itself: see WithStatefulBackend.
+type MemoryChatbot struct {
+	Chatbot
+	memory *conversationMemory
+
+	budget       int    // max runes of the prompt
+	lineRunes    int    // max runes of each line in the context block
+	stateful     bool   // the backend keeps the conversation: see WithStatefulBackend
+	file         string // persistence file, "" to disable
+	saveInterval time.Duration
+
+	stop chan struct{}
+}
+
+type MemoryOption func(m *MemoryChatbot)
+
+// WithMemoryBudget sets the max runes of the prompt. Default: 600.
+func WithMemoryBudget(runes int) MemoryOption {
+	return func(m *MemoryChatbot) {
+		if runes > 0 {
+			m.budget = runes
+		}
+	}
+}
+
+// WithMemoryLimits sets how many turns of the room and of each author are
+// kept, and how many authors are remembered (the least recently seen ones
+// are forgotten first). Zero values keep the defaults: 10, 5, 1000.
+func WithMemoryLimits(roomTurns, authorTurns, maxAuthors int) MemoryOption {
+	return func(m *MemoryChatbot) {
+		if roomTurns > 0 {
+			m.memory.roomTurns = roomTurns
+		}
+		if authorTurns > 0 {
+			m.memory.authorTurns = authorTurns
+		}
+		if maxAuthors > 0 {
+			m.memory.maxAuthors = maxAuthors
+		}
+	}
+}
+
+// WithStatefulBackend tells the wrapped Chatbot keeps the conversation
+// itself (e.g. a ChatGPT session): the transcripts, already in its history,
+// are not injected again, which would only fill its context sooner. The
+// prompt has the framing and the line about the author only.
+func WithStatefulBackend() MemoryOption {
+	return func(m *MemoryChatbot) {
+		m.stateful = true
+	}
+}
+
+// WithMemoryFile persists the memory to the JSON file:
+// it's loaded on NewMemoryChatbot, and saved every interval if changed
+// (and on Close). Default interval: 1 minute.
+func WithMemoryFile(file string, interval time.Duration) MemoryOption {
+	return func(m *MemoryChatbot) {
+		m.file = file
+		if interval > 0 {
+			m.saveInterval = interval
+		}
+	}
+}
+
+// NewMemoryChatbot wraps the chatbot with memory.
+//
+// If a memory file is set and exists, it's loaded.
+// A missing file is not an error.
+func NewMemoryChatbot(chatbot Chatbot, opts ...MemoryOption) (*MemoryChatbot, error) {
+	m := &MemoryChatbot{
+		Chatbot:      chatbot,
+		memory:       newConversationMemory(),
+		budget:       600,
+		lineRunes:    60,
+		saveInterval: time.Minute,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.file != "" {
+		if err := m.memory.load(m.file); err != nil {
+			return nil, fmt.Errorf("load memory: %w", err)
+		}
+		slog.Info("[MemoryChatbot] memory loaded.",
+			"file", m.file, "authors", len(m.memory.Authors), "room", len(m.memory.Room))
+		go m.autosave()
+	}
+
+	return m, nil
+}
+
+// Chat frames the textIn with memory, chats with the wrapped Chatbot,
+// and remembers the turn if succeeded.
+//
+// The returned TextOut replies to the original textIn.
+func (m *MemoryChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return m.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface. See Chat.
+func (m *MemoryChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, nil
+	}
+
+	framed := *textIn
+	framed.Content = m.Prompt(textIn)
+
+	textOut, err := WithContext(m.Chatbot).ChatContext(ctx, &framed)
+	if err != nil || textOut == nil {
+		return textOut, err
+	}
+	textOut.ReplyTo = textIn
+
+	m.memory.remember(textIn, textOut.Content)
+	return textOut, nil
+}
+
+// ChatStream implements the StreamChatbot interface. See Chat.
+// The deltas are passed through as is; the turn is remembered at the end.
+func (m *MemoryChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, nil
+	}
+
+	framed := *textIn
+	framed.Content = m.Prompt(textIn)
+
+	textOut, err := WithStream(m.Chatbot).ChatStream(ctx, &framed, func(delta *model.TextOut) {
+		delta.ReplyTo = textIn
+		onDelta(delta)
+	})
+	if err != nil || textOut == nil {
+		return textOut, err
+	}
+	textOut.ReplyTo = textIn
+
+	m.memory.remember(textIn, textOut.Content)
+	return textOut, nil
+}
+
+// Available reports whether the wrapped Chatbot is available. See IsAvailable.
+func (m *MemoryChatbot) Available() bool {
+	return IsAvailable(m.Chatbot)
+}
+
+// SetPrompt sets the prompt of the wrapped Chatbot (see PromptSetter),
+// and forgets the turns: the replies are in the voice of the old prompt.
+// What it knows about the authors (times chatted, first seen) is kept.
+func (m *MemoryChatbot) SetPrompt(prompt string) error {
+	ok, err := SetPrompt(m.Chatbot, prompt)
+	if ok && err == nil {
+		n := m.memory.forgetTurns()
+		slog.Info("[MemoryChatbot] prompt changed, turns forgotten.", "turns", n)
+	}
+	return err
+}
+
+// Prompt builds the prompt for the textIn: the compacted context block
+// followed by the "author said X" framing of the textIn.
+func (m *MemoryChatbot) Prompt(textIn *model.TextIn) string {
+	current := textIn.Content
+	if textIn.Author != "" {
+		current = fmt.Sprintf("%s 说：%s", textIn.Author, textIn.Content)
+	}
+
+	room, author, about := m.memory.recall(textIn)
+	if m.stateful {
+		room, author = nil, nil
+	}
+	if len(room) == 0 && len(author) == 0 && about == "" {
+		return current
+	}
+
+	clip := func(lines []string) []string {
+		for i := range lines {
+			lines[i] = clipRunes(lines[i], m.lineRunes)
+		}
+		return lines
+	}
+	room, author = clip(room), clip(author)
+
+	// 超出预算：先丢最早的房间对话，再丢最早的作者记忆
+	build := func() string {
+		var sb strings.Builder
+		if len(room) > 0 {
+			sb.WriteString("[最近的对话]\n")
+			for _, l := range room {
+				sb.WriteString(l)
+				sb.WriteByte('\n')
+			}
+		}
+		if about != "" || len(author) > 0 {
+			sb.WriteString(fmt.Sprintf("[关于 %s]\n", textIn.Author))
+			if about != "" {
+				sb.WriteString(about)
+				sb.WriteByte('\n')
+			}
+			for _, l := range author {
+				sb.WriteString(l)
+				sb.WriteByte('\n')
+			}
+		}
+		sb.WriteString("[现在]\n")
+		sb.WriteString(current)
+		return sb.String()
+	}
+	prompt := build()
+	for len([]rune(prompt)) > m.budget && (len(room) > 0 || len(author) > 0) {
+		if len(room) > 0 {
+			room = room[1:]
+		} else {
+			author = author[1:]
+		}
+		prompt = build()
+	}
+	return prompt
+}
+
+// Remember records a turn answered without the wrapped Chatbot,
+// e.g. from the cache of a CacheChatbot wrapping this one.
+func (m *MemoryChatbot) Remember(textIn *model.TextIn, textOut *model.TextOut) {
+	if textIn == nil || textOut == nil {
+		return
+	}
+	m.memory.remember(textIn, textOut.Content)
+}
+
+// rememberer is implemented by the chatbots keeping a memory of the turns
+// (MemoryChatbot). See MemoryChatbot.Remember.
+type rememberer interface {
+	Remember(textIn *model.TextIn, textOut *model.TextOut)
+}
+
+// Save writes the memory to the file (if set).
+func (m *MemoryChatbot) Save() error {
+	if m.file == "" {
+		return nil
+	}
+	return m.memory.save(m.file)
+}
+
+// Close stops the autosave, saves the memory and closes the wrapped Chatbot.
+func (m *MemoryChatbot) Close() error {
+	select {
+	case <-m.stop:
+		return nil // already closed
+	default:
+		close(m.stop)
+	}
+
+	errs := []error{m.Save()}
+	if closer, ok := m.Chatbot.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MemoryChatbot) autosave() {
+	ticker := time.NewTicker(m.saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if !m.memory.isDirty() {
+				continue
+			}
+			if err := m.Save(); err != nil {
+				slog.Warn("[MemoryChatbot] save memory failed.", "file", m.file, "err", err)
+			}
+		}
+	}
+}
+
+// clipRunes cuts s to at most n runes, with an ellipsis if cut.
+func clipRunes(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// endregion MemoryChatbot
+
+// region conversationMemory
+
+// Turn is a round of conversation: a viewer said Content, the chatbot replied Reply.
+type Turn struct {
+	Author  string    `json:"author"`
+	Content string    `json:"content"`
+	Reply   string    `json:"reply"`
+	Time    time.Time `json:"time"`
+}
+
+// authorMemory is what we remember about a viewer.
+type authorMemory struct {
+	Name      string    `json:"name"`
+	Count     int       `json:"count"` // times chatted
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Turns     []Turn    `json:"turns"`
+}
+
+// conversationMemory is the memory of the room and authors.
+// The exported fields are persisted.
+type conversationMemory struct {
+	mu sync.Mutex
+
+	Room    []Turn                   `json:"room"`
+	Authors map[string]*authorMemory `json:"authors"` // memoryKey -> memory
+
+	roomTurns   int
+	authorTurns int
+	maxAuthors  int
+	dirty       dirtyTracker
+}
+
+func newConversationMemory() *conversationMemory {
+	return &conversationMemory{
+		Authors:     map[string]*authorMemory{},
+		roomTurns:   10,
+		authorTurns: 5,
+		maxAuthors:  1000,
+	}
+}
+
+// memoryKey identifies the author: AuthorID if known, else the name.
+func memoryKey(t *model.Text) string {
+	if t.AuthorID != "" {
+		return t.AuthorID
+	}
+	return t.Author
+}
+
+func (c *conversationMemory) remember(textIn *model.TextIn, reply string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	turn := Turn{Author: textIn.Author, Content: textIn.Content, Reply: reply, Time: now}
+
+	c.Room = appendBounded(c.Room, turn, c.roomTurns)
+
+	if key := memoryKey(textIn); key != "" {
+		a, ok := c.Authors[key]
+		if !ok {
+			a = &authorMemory{FirstSeen: now}
+			c.Authors[key] = a
+		}
+		a.Name = textIn.Author // may be renamed
+		a.Count++
+		a.LastSeen = now
+		a.Turns = appendBounded(a.Turns, turn, c.authorTurns)
+
+		c.forget()
+	}
+
+	c.dirty.changed()
+}
+
+// forget the least recently seen authors beyond maxAuthors. c.mu must be held.
+func (c *conversationMemory) forget() {
+	if len(c.Authors) <= c.maxAuthors {
+		return
+	}
+	keys := make([]string, 0, len(c.Authors))
+	for k := range c.Authors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.Authors[keys[i]].LastSeen.Before(c.Authors[keys[j]].LastSeen)
+	})
+	for _, k := range keys[:len(keys)-c.maxAuthors] {
+		delete(c.Authors, k)
+	}
+}
+
+// forgetTurns forgets the turns of the room and the authors, keeping the
+// authors. Returns the number of the room turns forgotten.
+func (c *conversationMemory) forgetTurns() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.Room)
+	c.Room = nil
+	for _, a := range c.Authors {
+		a.Turns = nil
+	}
+	c.dirty.changed()
+	return n
+}
+
+func appendBounded(turns []Turn, turn Turn, max int) []Turn {
+	turns = append(turns, turn)
+	if len(turns) > max {
+		turns = append(turns[:0], turns[len(turns)-max:]...)
+	}
+	return turns
+}
+
+// recall returns the lines of the recent room transcript,
+// the lines of the author's earlier turns (not in the room lines),
+// and a line about the author.
+func (c *conversationMemory) recall(textIn *model.TextIn) (room, author []string, about string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inRoom := make(map[Turn]bool, len(c.Room))
+	for _, t := range c.Room {
+		inRoom[t] = true
+		room = append(room, turnLines(t)...)
+	}
+
+	a, ok := c.Authors[memoryKey(textIn)]
+	if !ok || memoryKey(textIn) == "" {
+		return room, nil, ""
+	}
+
+	about = fmt.Sprintf("%s 来过 %d 次，第一次是 %s。", textIn.Author, a.Count, a.FirstSeen.Format("2006-01-02"))
+	for _, t := range a.Turns {
+		if !inRoom[t] {
+			author = append(author, turnLines(t)...)
+		}
+	}
+	return room, author, about
+}
+
+func turnLines(t Turn) []string {
+	said := t.Content
+	if t.Author != "" {
+		said = t.Author + "：" + t.Content
+	}
+	return []string{said, "你：" + t.Reply}
+}
+
+func (c *conversationMemory) isDirty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dirty.unsaved()
+}
+
+// load reads the memory from the JSON file. A missing file is ignored.
+func (c *conversationMemory) load(file string) error {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return err
+	}
+	if c.Authors == nil {
+		c.Authors = map[string]*authorMemory{}
+	}
+	for k, a := range c.Authors {
+		if a == nil {
+			delete(c.Authors, k)
+		}
+	}
+	return nil
+}
+
+// save writes the memory to the JSON file atomically. See saveJSON.
+func (c *conversationMemory) save(file string) error {
+	return saveJSON(file, &c.mu, c, &c.dirty)
+}
+
+// endregion conversationMemory
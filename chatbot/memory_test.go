@@ -0,0 +1,149 @@
+package chatbot
+
+import (
+	"muvtuberdriver/model"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// echoChatbot replies the prompt it received.
+type echoChatbot struct{ prompts []string }
+
+func (e *echoChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	e.prompts = append(e.prompts, textIn.Content)
+	return textIn.Reply("echo", "收到"), nil
+}
+
+func TestMemoryChatbot_Chat(t *testing.T) {
+	echo := &echoChatbot{}
+	m, err := NewMemoryChatbot(echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := model.NewTextIn(model.SourceDm, "alice", "你好", model.PriorityLow)
+	out, err := m.Chat(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ReplyTo != first {
+		t.Error("TextOut should reply to the original textIn")
+	}
+	if echo.prompts[0] != "alice 说：你好" {
+		t.Errorf("1st prompt = %q", echo.prompts[0])
+	}
+
+	m.Chat(model.NewTextIn(model.SourceDm, "bob", "在吗", model.PriorityLow))
+	m.Chat(model.NewTextIn(model.SourceDm, "alice", "我又来了", model.PriorityLow))
+
+	prompt := echo.prompts[2]
+	for _, want := range []string{"[最近的对话]", "alice：你好", "bob：在吗", "你：收到", "[关于 alice]", "来过 1 次", "[现在]\nalice 说：我又来了"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestMemoryChatbot_Budget(t *testing.T) {
+	echo := &echoChatbot{}
+	m, _ := NewMemoryChatbot(echo, WithMemoryBudget(50))
+
+	for i := 0; i < 10; i++ {
+		m.Chat(model.NewTextIn(model.SourceDm, "someone", strings.Repeat("话", 20), model.PriorityLow))
+	}
+	current := "bob 说：" + strings.Repeat("长", 60)
+	prompt := m.Prompt(model.NewTextIn(model.SourceDm, "bob", strings.Repeat("长", 60), model.PriorityLow))
+	if !strings.HasSuffix(prompt, current) {
+		t.Errorf("the current message should always be kept: %q", prompt)
+	}
+	if n := len([]rune(prompt)); n > 50+len([]rune(current))+20 {
+		t.Errorf("prompt too long: %d runes", n)
+	}
+}
+
+func TestMemoryChatbot_Persistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "memory.json")
+
+	m, err := NewMemoryChatbot(&echoChatbot{}, WithMemoryFile(file, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	textIn := model.NewTextIn(model.SourceDm, "alice", "记住我", model.PriorityLow)
+	textIn.AuthorID = "42"
+	m.Chat(textIn)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewMemoryChatbot(&echoChatbot{}, WithMemoryFile(file, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+
+	again := model.NewTextIn(model.SourceDm, "alice_renamed", "还记得我吗", model.PriorityLow)
+	again.AuthorID = "42"
+	if prompt := m2.Prompt(again); !strings.Contains(prompt, "来过 1 次") {
+		t.Errorf("regular not remembered after restart:\n%s", prompt)
+	}
+}
+
+// promptEchoChatbot is an echoChatbot that takes prompts.
+type promptEchoChatbot struct{ echoChatbot }
+
+func (e *promptEchoChatbot) SetPrompt(prompt string) error { return nil }
+
+func TestMemoryChatbot_SetPrompt(t *testing.T) {
+	echo := &promptEchoChatbot{}
+	m, _ := NewMemoryChatbot(echo)
+
+	m.Chat(model.NewTextIn(model.SourceDm, "alice", "你好", model.PriorityLow))
+	if err := m.SetPrompt("new persona"); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := m.Prompt(model.NewTextIn(model.SourceDm, "alice", "我又来了", model.PriorityLow))
+	if strings.Contains(prompt, "你好") {
+		t.Errorf("the turns before SetPrompt should be forgotten:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "来过 1 次") {
+		t.Errorf("the authors should be kept:\n%s", prompt)
+	}
+}
+
+func TestMemoryChatbot_StatefulBackend(t *testing.T) {
+	echo := &echoChatbot{}
+	m, _ := NewMemoryChatbot(echo, WithStatefulBackend())
+
+	m.Chat(model.NewTextIn(model.SourceDm, "alice", "你好", model.PriorityLow))
+	m.Chat(model.NewTextIn(model.SourceDm, "alice", "我又来了", model.PriorityLow))
+
+	// the session has seen "你好": only the line about alice
+	if want := "[关于 alice]\nalice 来过 1 次"; !strings.HasPrefix(echo.prompts[1], want) || strings.Contains(echo.prompts[1], "你好") {
+		t.Errorf("prompt to a stateful backend:\n%s", echo.prompts[1])
+	}
+}
+
+func TestMemoryChatbot_CacheHit(t *testing.T) {
+	echo := &echoChatbot{}
+	m, _ := NewMemoryChatbot(echo)
+	c, err := NewCacheChatbot(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Chat(model.NewTextIn(model.SourceDm, "alice", "你是谁", model.PriorityLow))
+	out, _ := c.Chat(model.NewTextIn(model.SourceDm, "bob", "你是谁", model.PriorityLow))
+	if hit, _ := out.Meta(model.MetaCacheHit).(bool); !hit {
+		t.Fatal("the 2nd question should hit the cache")
+	}
+
+	c.Chat(model.NewTextIn(model.SourceDm, "bob", "再见", model.PriorityLow))
+	prompt := echo.prompts[len(echo.prompts)-1]
+	for _, want := range []string{"bob：你是谁", "[关于 bob]"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("the turn answered from the cache is not remembered: %q not in\n%s", want, prompt)
+		}
+	}
+}
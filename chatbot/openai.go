@@ -0,0 +1,294 @@
+package chatbot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/ratelimit"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// OpenAIConfig is the config to an OpenAI-compatible chat completions API
+// (POST {BaseURL}/chat/completions): OpenAI itself, or local servers like
+// llama.cpp (http://localhost:8080/v1) and Ollama (http://localhost:11434/v1).
+type OpenAIConfig struct {
+	BaseURL      string  // e.g. https://api.openai.com/v1
+	Model        string  // e.g. gpt-3.5-turbo
+	ApiKey       string  // sent as "Authorization: Bearer ApiKey". Can be empty for local servers.
+	SystemPrompt string  // the system message: who the chatbot is
+	Temperature  float64 // 0 to use the server's default
+	MaxTokens    int     // 0 to use the server's default
+}
+
+// OpenAIChatbot is a Chatbot that talks to an OpenAI-compatible
+// chat completions API directly over HTTP: no chatbot server needed.
+//
+// It's stateless: each Chat sends the system prompt and the textIn only.
+// Wrap it with MemoryChatbot to give it a context.
+//
+// OpenAIChatbot implements the StreamChatbot interface (server-sent events).
+type OpenAIChatbot struct {
+	config  OpenAIConfig
+	client  *http.Client
+	breaker *CircuitBreaker
+
+	limiter *ratelimit.Limiter // nil for no limit
+
+	prompt   string // the system prompt set by SetPrompt, "" for config.SystemPrompt
+	promptMu sync.RWMutex
+
+	Timeout time.Duration // of each request: DefaultRPCTimeout by default
+	Name    string        // the author name of the TextOut: "OpenAIChatbot" by default
+}
+
+// NewOpenAIChatbot creates an OpenAIChatbot rate limited by the limiter.
+// A nil limiter means no limit.
+func NewOpenAIChatbot(config OpenAIConfig, limiter *ratelimit.Limiter) (*OpenAIChatbot, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("openai chatbot: base url is empty")
+	}
+	if config.Model == "" {
+		return nil, errors.New("openai chatbot: model is empty")
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	c := &OpenAIChatbot{
+		config: config,
+		client: &http.Client{},
+		// not registered in circuitBreakers: WatchHealth speaks gRPC only.
+		// The breaker recovers by its backoff.
+		breaker: NewCircuitBreaker(config.BaseURL),
+		limiter: limiter,
+		Timeout: DefaultRPCTimeout,
+		Name:    "OpenAIChatbot",
+	}
+	return c, nil
+}
+
+// region OpenAI API
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"` // stream: false
+		Delta   openAIMessage `json:"delta"`   // stream: true
+	} `json:"choices"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// endregion OpenAI API
+
+func (c *OpenAIChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatContext(context.Background(), textIn)
+}
+
+// ChatContext implements the ContextChatbot interface.
+func (c *OpenAIChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatStream(ctx, textIn, nil)
+}
+
+// ChatStream implements the StreamChatbot interface.
+// A nil onDelta means not streaming.
+func (c *OpenAIChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, errors.New("textIn is nil")
+	}
+	if err := takeToken(c.limiter); err != nil {
+		return nil, err
+	}
+	if !c.breaker.Allow() {
+		return nil, fmt.Errorf("%w: baseURL=%v", ErrCircuitOpen, c.config.BaseURL)
+	}
+
+	content, err := c.chat(ctx, textIn, onDelta)
+	if err == nil && content == "" {
+		err = errors.New("empty response")
+	}
+	switch {
+	case err == nil:
+		c.breaker.Success()
+	case ctx.Err() != nil:
+		c.breaker.Release()
+	default:
+		c.breaker.Failure()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.Name, err)
+	}
+
+	slog.Info("[chatbot] OpenAIChatbot Chat success.",
+		"model", c.config.Model,
+		"textin", ellipsis.Centering(textIn.Content, 11),
+		"textout", ellipsis.Centering(content, 11))
+
+	return textIn.Reply(c.Name, content), nil
+}
+
+// Available reports whether the API can be called right now:
+// false if its circuit is open.
+func (c *OpenAIChatbot) Available() bool {
+	return c.breaker.Ready()
+}
+
+// SetPrompt sets the system prompt. See PromptSetter.
+func (c *OpenAIChatbot) SetPrompt(prompt string) error {
+	c.promptMu.Lock()
+	defer c.promptMu.Unlock()
+	c.prompt = prompt
+	return nil
+}
+
+func (c *OpenAIChatbot) systemPrompt() string {
+	c.promptMu.RLock()
+	defer c.promptMu.RUnlock()
+	if c.prompt != "" {
+		return c.prompt
+	}
+	return c.config.SystemPrompt
+}
+
+// chat does the request, and returns the content of the response.
+func (c *OpenAIChatbot) chat(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (string, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	resp, err := c.post(ctx, textIn.Content, onDelta != nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if onDelta == nil {
+		var r openAIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return "", fmt.Errorf("bad response: %w", err)
+		}
+		if len(r.Choices) == 0 {
+			return "", errors.New("bad response: no choices")
+		}
+		return strings.TrimSpace(r.Choices[0].Message.Content), nil
+	}
+
+	return readOpenAIStream(resp.Body, func(piece string) {
+		onDelta(textIn.Reply(c.Name, piece))
+	})
+}
+
+// post sends the chat completions request. The response status is checked.
+func (c *OpenAIChatbot) post(ctx context.Context, prompt string, stream bool) (*http.Response, error) {
+	var messages []openAIMessage
+	if systemPrompt := c.systemPrompt(); systemPrompt != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: systemPrompt})
+	}
+	messages = append(messages, openAIMessage{Role: "user", Content: prompt})
+
+	body, err := json.Marshal(openAIRequest{
+		Model:       c.config.Model,
+		Messages:    messages,
+		Temperature: c.config.Temperature,
+		MaxTokens:   c.config.MaxTokens,
+		Stream:      stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.config.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.ApiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e openAIErrorResponse
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(b, &e) == nil && e.Error.Message != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, ellipsis.Ending(string(b), 100))
+	}
+	return resp, nil
+}
+
+// readOpenAIStream reads the server-sent events of a streaming response:
+//
+//	data: {"choices":[{"delta":{"content":"Hel"}}]}
+//
+//	data: {"choices":[{"delta":{"content":"lo"}}]}
+//
+//	data: [DONE]
+//
+// onPiece is called with each non-empty piece. Returns the whole content.
+func readOpenAIStream(body io.Reader, onPiece func(piece string)) (string, error) {
+	var sb strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // blank lines, comments, event: ...
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return strings.TrimSpace(sb.String()), nil
+		}
+
+		var r openAIResponse
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return "", fmt.Errorf("bad stream event %q: %w", ellipsis.Ending(data, 100), err)
+		}
+		if len(r.Choices) == 0 || r.Choices[0].Delta.Content == "" {
+			continue
+		}
+		piece := r.Choices[0].Delta.Content
+		sb.WriteString(piece)
+		onPiece(piece)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	// some servers just close the stream without [DONE]
+	return strings.TrimSpace(sb.String()), nil
+}
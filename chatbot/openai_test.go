@@ -0,0 +1,102 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"muvtuberdriver/model"
+)
+
+// fakeOpenAIServer echoes the last message of the request, streaming it
+// word by word if asked. The requests are recorded.
+func fakeOpenAIServer(t *testing.T, requests *[]openAIRequest) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "bad key", "type": "invalid_request_error"}}`)
+			return
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		*requests = append(*requests, req)
+		reply := "echo: " + req.Messages[len(req.Messages)-1].Content
+
+		if !req.Stream {
+			fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": %q}}]}`, reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range strings.SplitAfter(reply, " ") {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIChatbot(t *testing.T) {
+	var requests []openAIRequest
+	srv := fakeOpenAIServer(t, &requests)
+
+	bot, err := NewOpenAIChatbot(OpenAIConfig{
+		BaseURL:      srv.URL + "/v1/",
+		Model:        "test-model",
+		ApiKey:       "sk-test",
+		SystemPrompt: "you are muli",
+		MaxTokens:    100,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textIn := model.NewTextIn(model.SourceDm, "a", "hello world", 0)
+
+	textOut, err := bot.Chat(textIn)
+	if err != nil || textOut.Content != "echo: hello world" {
+		t.Fatalf("Chat() = %v, %v", textOut, err)
+	}
+	want := openAIRequest{
+		Model: "test-model",
+		Messages: []openAIMessage{
+			{Role: "system", Content: "you are muli"},
+			{Role: "user", Content: "hello world"},
+		},
+		MaxTokens: 100,
+	}
+	if !reflect.DeepEqual(requests[0], want) {
+		t.Errorf("request = %+v, want %+v", requests[0], want)
+	}
+
+	var deltas []string
+	textOut, err = bot.ChatStream(context.Background(), textIn, func(delta *model.TextOut) {
+		deltas = append(deltas, delta.Content)
+	})
+	if err != nil || textOut.Content != "echo: hello world" {
+		t.Fatalf("ChatStream() = %v, %v", textOut, err)
+	}
+	if want := []string{"echo: ", "hello ", "world"}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("ChatStream() deltas = %q, want %q", deltas, want)
+	}
+	if !requests[1].Stream {
+		t.Error("ChatStream() should request stream: true")
+	}
+}
+
+func TestOpenAIChatbot_Error(t *testing.T) {
+	var requests []openAIRequest
+	srv := fakeOpenAIServer(t, &requests)
+
+	bot, _ := NewOpenAIChatbot(OpenAIConfig{BaseURL: srv.URL + "/v1", Model: "m", ApiKey: "wrong"}, nil)
+	_, err := bot.Chat(model.NewTextIn(model.SourceDm, "a", "hi", 0))
+	if err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("Chat() err = %v, want the error message from the server", err)
+	}
+}
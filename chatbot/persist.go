@@ -0,0 +1,64 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// dirtyTracker tells whether the changes of a persisted value (the
+// conversationMemory, the responseCache) are saved. It's guarded by the
+// mutex of its owner.
+type dirtyTracker struct {
+	changes uint64 // counts the changes
+	saved   uint64 // changes when the last successful save marshaled
+}
+
+// changed marks a change.
+func (d *dirtyTracker) changed() { d.changes++ }
+
+// unsaved reports whether there are changes not saved yet.
+func (d *dirtyTracker) unsaved() bool { return d.changes != d.saved }
+
+// saveJSON writes v (marshaled with mu held) to the JSON file atomically
+// (write & rename). The changes are marked saved only after the rename
+// succeeded: a failed save is retried by the next autosave, and the
+// changes made while writing are saved next time.
+func saveJSON(file string, mu sync.Locker, v any, dirty *dirtyTracker) error {
+	mu.Lock()
+	b, err := json.Marshal(v)
+	changes := dirty.changes
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(file, b); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	dirty.saved = changes
+	mu.Unlock()
+	return nil
+}
+
+// writeFileAtomic writes the data to a temp file next to the file,
+// and renames it to the file.
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
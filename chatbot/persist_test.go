@@ -0,0 +1,27 @@
+package chatbot
+
+import (
+	"muvtuberdriver/model"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveJSON_Dirty(t *testing.T) {
+	dir := t.TempDir()
+	c := newConversationMemory()
+	c.remember(model.NewTextIn(model.SourceDm, "alice", "你好", model.PriorityLow), "你好呀")
+
+	if err := c.save(filepath.Join(dir, "missing", "memory.json")); err == nil {
+		t.Fatal("save to a missing dir: want error")
+	}
+	if !c.isDirty() {
+		t.Error("a failed save should keep the changes unsaved")
+	}
+
+	if err := c.save(filepath.Join(dir, "memory.json")); err != nil {
+		t.Fatal(err)
+	}
+	if c.isDirty() {
+		t.Error("isDirty after a successful save, want false")
+	}
+}
@@ -0,0 +1,20 @@
+package chatbot
+
+// PromptSetter is implemented by the chatbots whose prompt (who the
+// chatbot is: the initial prompt or the system prompt) can be changed at
+// runtime, e.g. to switch the persona.
+//
+// An empty prompt restores the one the chatbot is created with.
+type PromptSetter interface {
+	SetPrompt(prompt string) error
+}
+
+// SetPrompt sets the prompt of the chatbot if it's a PromptSetter.
+// It reports whether the chatbot is a PromptSetter.
+func SetPrompt(chatbot Chatbot, prompt string) (bool, error) {
+	s, ok := chatbot.(PromptSetter)
+	if !ok {
+		return false, nil
+	}
+	return true, s.SetPrompt(prompt)
+}
@@ -298,6 +298,7 @@ type ChatResponse struct {
 	unknownFields protoimpl.UnknownFields
 
 	// response is the Chatbot's response.
+	// For ChatStream, it's a piece of the response.
 	Response string `protobuf:"bytes,2,opt,name=response,proto3" json:"response,omitempty"`
 }
 
@@ -371,7 +372,7 @@ var file_muvtuber_chatbot_v2_chatbot_proto_rawDesc = []byte{
 	0x6d, 0x70, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x72, 0x6f, 0x6d, 0x70,
 	0x74, 0x22, 0x2a, 0x0a, 0x0c, 0x43, 0x68, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
 	0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xa4, 0x02,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xf9, 0x02,
 	0x0a, 0x0e, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
 	0x12, 0x5d, 0x0a, 0x0a, 0x4e, 0x65, 0x77, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x26,
 	0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f,
@@ -390,20 +391,25 @@ var file_muvtuber_chatbot_v2_chatbot_proto_rawDesc = []byte{
 	0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x2a, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75,
 	0x62, 0x65, 0x72, 0x2e, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2e, 0x76, 0x32, 0x2e, 0x44,
 	0x65, 0x6c, 0x65, 0x74, 0x65, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x42, 0xc7, 0x01, 0x0a, 0x17, 0x63, 0x6f, 0x6d, 0x2e, 0x6d, 0x75, 0x76,
-	0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2e, 0x76, 0x32,
-	0x42, 0x0c, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x50, 0x01,
-	0x5a, 0x30, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72,
-	0x2f, 0x67, 0x65, 0x6e, 0x2f, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2f, 0x63, 0x68,
-	0x61, 0x74, 0x62, 0x6f, 0x74, 0x2f, 0x76, 0x32, 0x3b, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74,
-	0x76, 0x32, 0xa2, 0x02, 0x03, 0x4d, 0x43, 0x58, 0xaa, 0x02, 0x13, 0x4d, 0x75, 0x76, 0x74, 0x75,
-	0x62, 0x65, 0x72, 0x2e, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2e, 0x56, 0x32, 0xca, 0x02,
-	0x13, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x5c, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f,
-	0x74, 0x5c, 0x56, 0x32, 0xe2, 0x02, 0x1f, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x5c,
-	0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x5c, 0x56, 0x32, 0x5c, 0x47, 0x50, 0x42, 0x4d, 0x65,
-	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0xea, 0x02, 0x15, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65,
-	0x72, 0x3a, 0x3a, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x3a, 0x3a, 0x56, 0x32, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x53, 0x0a, 0x0a, 0x43, 0x68, 0x61, 0x74, 0x53, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x12, 0x20, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x63, 0x68,
+	0x61, 0x74, 0x62, 0x6f, 0x74, 0x2e, 0x76, 0x32, 0x2e, 0x43, 0x68, 0x61, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e,
+	0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2e, 0x76, 0x32, 0x2e, 0x43, 0x68, 0x61, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x42, 0xc7, 0x01, 0x0a, 0x17, 0x63, 0x6f,
+	0x6d, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x63, 0x68, 0x61, 0x74, 0x62,
+	0x6f, 0x74, 0x2e, 0x76, 0x32, 0x42, 0x0c, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x50, 0x72,
+	0x6f, 0x74, 0x6f, 0x50, 0x01, 0x5a, 0x30, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x64,
+	0x72, 0x69, 0x76, 0x65, 0x72, 0x2f, 0x67, 0x65, 0x6e, 0x2f, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62,
+	0x65, 0x72, 0x2f, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2f, 0x76, 0x32, 0x3b, 0x63, 0x68,
+	0x61, 0x74, 0x62, 0x6f, 0x74, 0x76, 0x32, 0xa2, 0x02, 0x03, 0x4d, 0x43, 0x58, 0xaa, 0x02, 0x13,
+	0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74,
+	0x2e, 0x56, 0x32, 0xca, 0x02, 0x13, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x5c, 0x43,
+	0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x5c, 0x56, 0x32, 0xe2, 0x02, 0x1f, 0x4d, 0x75, 0x76, 0x74,
+	0x75, 0x62, 0x65, 0x72, 0x5c, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x5c, 0x56, 0x32, 0x5c,
+	0x47, 0x50, 0x42, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0xea, 0x02, 0x15, 0x4d, 0x75,
+	0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x3a, 0x3a, 0x43, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x3a,
+	0x3a, 0x56, 0x32, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -431,11 +437,13 @@ var file_muvtuber_chatbot_v2_chatbot_proto_depIdxs = []int32{
 	0, // 0: muvtuber.chatbot.v2.ChatbotService.NewSession:input_type -> muvtuber.chatbot.v2.NewSessionRequest
 	4, // 1: muvtuber.chatbot.v2.ChatbotService.Chat:input_type -> muvtuber.chatbot.v2.ChatRequest
 	2, // 2: muvtuber.chatbot.v2.ChatbotService.DeleteSession:input_type -> muvtuber.chatbot.v2.DeleteSessionRequest
-	1, // 3: muvtuber.chatbot.v2.ChatbotService.NewSession:output_type -> muvtuber.chatbot.v2.NewSessionResponse
-	5, // 4: muvtuber.chatbot.v2.ChatbotService.Chat:output_type -> muvtuber.chatbot.v2.ChatResponse
-	3, // 5: muvtuber.chatbot.v2.ChatbotService.DeleteSession:output_type -> muvtuber.chatbot.v2.DeleteSessionResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
+	4, // 3: muvtuber.chatbot.v2.ChatbotService.ChatStream:input_type -> muvtuber.chatbot.v2.ChatRequest
+	1, // 4: muvtuber.chatbot.v2.ChatbotService.NewSession:output_type -> muvtuber.chatbot.v2.NewSessionResponse
+	5, // 5: muvtuber.chatbot.v2.ChatbotService.Chat:output_type -> muvtuber.chatbot.v2.ChatResponse
+	3, // 6: muvtuber.chatbot.v2.ChatbotService.DeleteSession:output_type -> muvtuber.chatbot.v2.DeleteSessionResponse
+	5, // 7: muvtuber.chatbot.v2.ChatbotService.ChatStream:output_type -> muvtuber.chatbot.v2.ChatResponse
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
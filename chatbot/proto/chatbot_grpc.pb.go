@@ -24,6 +24,7 @@ const (
 	ChatbotService_NewSession_FullMethodName    = "/muvtuber.chatbot.v2.ChatbotService/NewSession"
 	ChatbotService_Chat_FullMethodName          = "/muvtuber.chatbot.v2.ChatbotService/Chat"
 	ChatbotService_DeleteSession_FullMethodName = "/muvtuber.chatbot.v2.ChatbotService/DeleteSession"
+	ChatbotService_ChatStream_FullMethodName    = "/muvtuber.chatbot.v2.ChatbotService/ChatStream"
 )
 
 // ChatbotServiceClient is the client API for ChatbotService service.
@@ -42,6 +43,11 @@ type ChatbotServiceClient interface {
 	// Input: session_id (string).
 	// Output: session_id (string).
 	DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error)
+	// ChatStream is like Chat, but streams the response as it's generated.
+	// Input: session_id (string) and prompt (string).
+	// Output: a stream of response (string) pieces, whose concatenation
+	// is the whole response.
+	ChatStream(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (ChatbotService_ChatStreamClient, error)
 }
 
 type chatbotServiceClient struct {
@@ -79,6 +85,38 @@ func (c *chatbotServiceClient) DeleteSession(ctx context.Context, in *DeleteSess
 	return out, nil
 }
 
+func (c *chatbotServiceClient) ChatStream(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (ChatbotService_ChatStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatbotService_ServiceDesc.Streams[0], ChatbotService_ChatStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatbotServiceChatStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatbotService_ChatStreamClient interface {
+	Recv() (*ChatResponse, error)
+	grpc.ClientStream
+}
+
+type chatbotServiceChatStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatbotServiceChatStreamClient) Recv() (*ChatResponse, error) {
+	m := new(ChatResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ChatbotServiceServer is the server API for ChatbotService service.
 // All implementations must embed UnimplementedChatbotServiceServer
 // for forward compatibility
@@ -95,6 +133,11 @@ type ChatbotServiceServer interface {
 	// Input: session_id (string).
 	// Output: session_id (string).
 	DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error)
+	// ChatStream is like Chat, but streams the response as it's generated.
+	// Input: session_id (string) and prompt (string).
+	// Output: a stream of response (string) pieces, whose concatenation
+	// is the whole response.
+	ChatStream(*ChatRequest, ChatbotService_ChatStreamServer) error
 	mustEmbedUnimplementedChatbotServiceServer()
 }
 
@@ -111,6 +154,9 @@ func (UnimplementedChatbotServiceServer) Chat(context.Context, *ChatRequest) (*C
 func (UnimplementedChatbotServiceServer) DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteSession not implemented")
 }
+func (UnimplementedChatbotServiceServer) ChatStream(*ChatRequest, ChatbotService_ChatStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ChatStream not implemented")
+}
 func (UnimplementedChatbotServiceServer) mustEmbedUnimplementedChatbotServiceServer() {}
 
 // UnsafeChatbotServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -178,6 +224,27 @@ func _ChatbotService_DeleteSession_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ChatbotService_ChatStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatbotServiceServer).ChatStream(m, &chatbotServiceChatStreamServer{stream})
+}
+
+type ChatbotService_ChatStreamServer interface {
+	Send(*ChatResponse) error
+	grpc.ServerStream
+}
+
+type chatbotServiceChatStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatbotServiceChatStreamServer) Send(m *ChatResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ChatbotService_ServiceDesc is the grpc.ServiceDesc for ChatbotService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -198,6 +265,12 @@ var ChatbotService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ChatbotService_DeleteSession_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ChatStream",
+			Handler:       _ChatbotService_ChatStream_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "muvtuber/chatbot/v2/chatbot.proto",
 }
@@ -0,0 +1,97 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"muvtuberdriver/model"
+)
+
+// TextInQueue is where the chatbot stage pulls TextIns from when it is ready.
+// See muvtuberdriver/queue.PriorityQueue.
+type TextInQueue interface {
+	// Pop blocks until there is a TextIn or ctx is done.
+	Pop(ctx context.Context) (*model.TextIn, error)
+	// Requeue puts back a TextIn that failed to be answered.
+	// Returns false if the queue decides to drop it.
+	Requeue(textIn *model.TextIn) bool
+}
+
+// TextOutFromQueue is the pull version of TextOutFromChatbot:
+// it takes the next TextIn from the queue only when a worker is free,
+// instead of receiving from a channel pushed by the filters.
+// See TextOutFromChatbot for the options.
+//
+// A failed TextIn is requeued, so is a TextIn answered by a stopgap (see
+// IsDegraded): a protected one (e.g. super chat) deserves a real answer
+// later rather than a canned reply now. If the queue drops it instead,
+// the stopgap is sent.
+//
+// It returns when ctx is done.
+func TextOutFromQueue(ctx context.Context, chatbot Chatbot, queue TextInQueue, textOutChan chan<- *model.TextOut, opts ...WorkerOption) {
+	runWorkers(ctx, "TextOutFromQueue", queueSource("TextOutFromQueue", queue), chatOrRequeue(WithContext(chatbot), queue),
+		textOutChan, newWorkerOptions(opts))
+}
+
+// queueSource pops the TextIns from the queue.
+func queueSource(name string, queue TextInQueue) source {
+	return func(ctx context.Context) (*model.TextIn, bool) {
+		textIn, err := queue.Pop(ctx)
+		if err != nil {
+			log.Printf("INFO [%s] stop: %v", name, err)
+			return nil, false
+		}
+		return textIn, true
+	}
+}
+
+// chatOrRequeue is the handler of TextOutFromQueue.
+func chatOrRequeue(chatbot ContextChatbot, queue TextInQueue) handler {
+	return func(ctx context.Context, textIn *model.TextIn, emit func(out *model.TextOut)) {
+		textOut, err := chatbot.ChatContext(ctx, textIn)
+		if err != nil {
+			log.Printf("ERROR chatbot.Chat(%v) failed: %v", textIn, err)
+			if ctx.Err() == nil && queue.Requeue(textIn) {
+				log.Printf("INFO [TextOutFromQueue] requeued (%s): %q", textIn.Author, textIn.Content)
+			}
+			return
+		}
+		if textOut == nil {
+			return
+		}
+		if IsDegraded(textOut) && queue.Requeue(textIn) {
+			log.Printf("INFO [TextOutFromQueue] requeued instead of the %v reply (%s): %q", textOut.Meta(model.MetaDegraded), textIn.Author, textIn.Content)
+			return
+		}
+		emit(textOut)
+	}
+}
+
+// errRequeued is returned by requeueDegraded.ChatStream if the TextIn is
+// requeued instead of answered by a stopgap.
+var errRequeued = errors.New("requeued instead of a degraded reply")
+
+// requeueDegraded requeues the TextIn answered by a stopgap (see IsDegraded)
+// before the stopgap is delivered: a stopgap comes as one whole delta.
+type requeueDegraded struct {
+	StreamChatbot
+	queue TextInQueue
+}
+
+func (r requeueDegraded) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	requeued := false
+	textOut, err := r.StreamChatbot.ChatStream(ctx, textIn, func(delta *model.TextOut) {
+		if requeued {
+			return
+		}
+		if IsDegraded(delta) && r.queue.Requeue(textIn) {
+			requeued = true
+			return
+		}
+		onDelta(delta)
+	})
+	if requeued {
+		return nil, errRequeued
+	}
+	return textOut, err
+}
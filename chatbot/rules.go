@@ -0,0 +1,237 @@
+package chatbot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"muvtuberdriver/model"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleChatbot is an in-process Chatbot driven by rules (see Rule),
+// usually loaded from a YAML file:
+//
+//	rules:
+//	    - name: greeting
+//	      keywords: [你好, hello]
+//	      replies:
+//	          - 你好呀，{author}！
+//	          - text: 欢迎 {author}！
+//	            weight: 3
+//	    - name: night
+//	      hours: 23-5
+//	      regex: 晚安|睡
+//	      replies: [早点睡哦，{author}。]
+//	    - name: catch-all
+//	      replies: [嗯嗯。, 是这样的吗？]
+//
+// The first matching rule wins, and one of its replies is picked at random
+// by weight. It needs no network, so it's the last resort when all the
+// other chatbots are down.
+type RuleChatbot struct {
+	rules []*Rule
+
+	mu   sync.Mutex // for rand
+	rand *rand.Rand
+	now  func() time.Time // for testing
+
+	Name string // the author name of the TextOut: "RuleChatbot" by default
+}
+
+// Rule is a rule of RuleChatbot.
+//
+// A rule matches a TextIn if any of its Keywords is in the content
+// (case-insensitive) or its Regex matches the content, and the current hour
+// is in Hours. A rule without Keywords and Regex matches any content:
+// a catch-all (or a time-of-day greeting with Hours).
+type Rule struct {
+	Name     string
+	Keywords []string
+	Regex    string
+	Hours    string  // "from-to" in 24h, e.g. "6-11", "22-2" (across midnight). Empty for all day.
+	Replies  []Reply // {author} and {content} are replaced by the TextIn's
+
+	regex    *regexp.Regexp
+	from, to int // hours
+}
+
+// Reply is a reply of a Rule. In YAML, it's either a string (weight 1)
+// or {text, weight}. A reply of weight 0 is never picked
+// (unless all the replies are of weight 0).
+type Reply struct {
+	Text   string
+	Weight int
+}
+
+func (r *Reply) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.Weight = 1
+		return value.Decode(&r.Text)
+	}
+	var reply struct {
+		Text   string
+		Weight *int // 1 if missing, 0 to disable the reply
+	}
+	if err := value.Decode(&reply); err != nil {
+		return err
+	}
+	r.Text, r.Weight = reply.Text, 1
+	if reply.Weight != nil {
+		r.Weight = *reply.Weight
+	}
+	return nil
+}
+
+// ErrNoRuleMatched is returned by RuleChatbot if no rule matches
+// (there is no catch-all rule).
+var ErrNoRuleMatched = errors.New("no rule matched")
+
+// NewRuleChatbot creates a RuleChatbot with the rules, which are checked
+// (see Rule) and compiled.
+func NewRuleChatbot(rules []*Rule) (*RuleChatbot, error) {
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Name, err)
+		}
+	}
+	return &RuleChatbot{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:   time.Now,
+		Name:  "RuleChatbot",
+	}, nil
+}
+
+// LoadRuleChatbot creates a RuleChatbot from the YAML rule file.
+func LoadRuleChatbot(file string) (*RuleChatbot, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := ReadRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("read rules from %s: %w", file, err)
+	}
+	return NewRuleChatbot(rules)
+}
+
+// ReadRules reads the rules in YAML: {rules: [...]}.
+func ReadRules(r io.Reader) ([]*Rule, error) {
+	var file struct {
+		Rules []*Rule
+	}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.Replies) == 0 {
+		return errors.New("no replies")
+	}
+	for _, reply := range r.Replies {
+		if reply.Weight < 0 {
+			return fmt.Errorf("negative weight: %q", reply.Text)
+		}
+	}
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.regex = regex
+	}
+	r.from, r.to = 0, 24
+	if r.Hours != "" {
+		from, to, ok := strings.Cut(r.Hours, "-")
+		var errFrom, errTo error
+		r.from, errFrom = strconv.Atoi(strings.TrimSpace(from))
+		r.to, errTo = strconv.Atoi(strings.TrimSpace(to))
+		if !ok || errFrom != nil || errTo != nil ||
+			r.from < 0 || r.from > 23 || r.to < 0 || r.to > 24 {
+			return fmt.Errorf("bad hours %q: want from-to, e.g. 6-11", r.Hours)
+		}
+	}
+	return nil
+}
+
+// match reports whether the rule matches the content at the hour.
+func (r *Rule) match(content string, hour int) bool {
+	if !r.inHours(hour) {
+		return false
+	}
+	if len(r.Keywords) == 0 && r.regex == nil {
+		return true
+	}
+	lower := strings.ToLower(content)
+	for _, k := range r.Keywords {
+		if k != "" && strings.Contains(lower, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return r.regex != nil && r.regex.MatchString(content)
+}
+
+// inHours reports whether hour is in [from, to), across midnight if from > to.
+func (r *Rule) inHours(hour int) bool {
+	if r.from <= r.to {
+		return r.from <= hour && hour < r.to
+	}
+	return hour >= r.from || hour < r.to
+}
+
+func (c *RuleChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	if textIn == nil {
+		return nil, errors.New("textIn is nil")
+	}
+
+	hour := c.now().Hour()
+	for _, rule := range c.rules {
+		if !rule.match(textIn.Content, hour) {
+			continue
+		}
+		reply := c.pick(rule.Replies)
+		content := strings.NewReplacer(
+			"{author}", textIn.Author,
+			"{content}", textIn.Content,
+		).Replace(reply)
+		return textIn.Reply(c.Name, content), nil
+	}
+	return nil, ErrNoRuleMatched
+}
+
+// pick picks a reply at random by weight.
+func (c *RuleChatbot) pick(replies []Reply) string {
+	total := 0
+	for _, r := range replies {
+		total += r.Weight
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if total == 0 { // all weights are 0: equally
+		return replies[c.rand.Intn(len(replies))].Text
+	}
+	n := c.rand.Intn(total)
+	for _, r := range replies {
+		if n < r.Weight {
+			return r.Text
+		}
+		n -= r.Weight
+	}
+	return replies[len(replies)-1].Text // unreachable
+}
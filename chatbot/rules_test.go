@@ -0,0 +1,91 @@
+package chatbot
+
+import (
+	"errors"
+	"math/rand"
+	"muvtuberdriver/model"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `
+rules:
+    - name: greeting
+      keywords: [Hello, 你好]
+      replies: ["hi, {author}"]
+    - name: night
+      hours: 22-2
+      regex: 晚安|睡
+      replies:
+          - text: 晚安，{author}
+            weight: 1
+          - text: never
+            weight: 0
+    - name: morning
+      hours: 6-11
+      replies: [早上好]
+`
+
+func TestRuleChatbot(t *testing.T) {
+	rules, err := ReadRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot, err := NewRuleChatbot(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.rand = rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		content string
+		hour    int
+		want    string
+		wantErr error
+	}{
+		{"HELLO there", 12, "hi, a", nil},
+		{"我去睡了", 23, "晚安，a", nil},
+		{"我去睡了", 1, "晚安，a", nil},             // across midnight
+		{"我去睡了", 8, "早上好", nil},              // not night: the morning catch-all
+		{"随便说点什么", 13, "", ErrNoRuleMatched}, // no catch-all in the afternoon
+	}
+	for _, tt := range tests {
+		bot.now = func() time.Time { return time.Date(2023, 5, 1, tt.hour, 30, 0, 0, time.Local) }
+		for i := 0; i < 10; i++ { // weight 0 is never picked
+			textOut, err := bot.Chat(model.NewTextIn(model.SourceDm, "a", tt.content, 0))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Chat(%q at %d:30) err = %v, want %v", tt.content, tt.hour, err, tt.wantErr)
+			}
+			if err == nil && textOut.Content != tt.want {
+				t.Fatalf("Chat(%q at %d:30) = %q, want %q", tt.content, tt.hour, textOut.Content, tt.want)
+			}
+		}
+	}
+}
+
+func TestRuleChatbot_BadRules(t *testing.T) {
+	for _, rules := range []string{
+		"rules: [{name: a}]",                           // no replies
+		"rules: [{name: a, regex: '(', replies: [x]}]", // bad regex
+		"rules: [{name: a, hours: 6, replies: [x]}]",   // bad hours
+	} {
+		parsed, err := ReadRules(strings.NewReader(rules))
+		if err == nil {
+			_, err = NewRuleChatbot(parsed)
+		}
+		if err == nil {
+			t.Errorf("rules %q: want error", rules)
+		}
+	}
+}
+
+func TestLoadRuleChatbot_Example(t *testing.T) {
+	if _, err := os.Stat("../config/example-rules.yaml"); err != nil {
+		t.Skip(err)
+	}
+	if _, err := LoadRuleChatbot("../config/example-rules.yaml"); err != nil {
+		t.Errorf("example rules: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/sentence"
+)
+
+// StreamChatbot is a Chatbot that can stream the response:
+// ChatStream calls onDelta with each piece of the response as soon as it
+// arrives (the Content of a delta is the piece), and returns the whole
+// response at the end, like ChatContext.
+//
+// onDelta is called in order, and before ChatStream returns.
+type StreamChatbot interface {
+	ContextChatbot
+	ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error)
+}
+
+// WithStream adapts a Chatbot to a StreamChatbot.
+//
+// If the chatbot is already a StreamChatbot, it's returned as is.
+// Otherwise, the whole response is delivered as one delta.
+func WithStream(chatbot Chatbot) StreamChatbot {
+	if s, ok := chatbot.(StreamChatbot); ok {
+		return s
+	}
+	return streamAdapter{WithContext(chatbot)}
+}
+
+type streamAdapter struct {
+	ContextChatbot
+}
+
+func (a streamAdapter) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	textOut, err := a.ChatContext(ctx, textIn)
+	if err == nil && textOut != nil {
+		onDelta(textOut)
+	}
+	return textOut, err
+}
+
+// ChatSentences chats with the chatbot in streaming, and sends each
+// sentence of the response to textOutChan as soon as it's complete,
+// so that the sayer can start speaking before the whole response is ready.
+//
+// The sentences are TextOuts replying to the textIn, marked as the chunks
+// (model.MetaChunkOf, model.MetaChunkIndex) of the response, so that the
+// TextOut filters keep them together. A stopgap response (see IsDegraded)
+// makes degraded chunks.
+//
+// It returns the number of sentences sent. A failed stream may have sent
+// some sentences before the error: the unfinished one is dropped.
+func ChatSentences(ctx context.Context, chatbot Chatbot, textIn *model.TextIn, textOutChan chan<- *model.TextOut) (int, error) {
+	sent := 0
+	_, err := chatSentences(ctx, chatbot, textIn, func(chunk *model.TextOut) {
+		select {
+		case textOutChan <- chunk:
+			sent++
+		case <-ctx.Done():
+		}
+	})
+	return sent, err
+}
+
+// chatSentences is ChatSentences emitting the sentences to emit.
+// It returns the number of sentences emitted.
+func chatSentences(ctx context.Context, chatbot Chatbot, textIn *model.TextIn, emit func(chunk *model.TextOut)) (int, error) {
+	replyID := model.NewID()
+	var acc sentence.Accumulator
+	var author string
+	var degraded any
+	emitted := 0
+
+	send := func(content string) {
+		chunk := textIn.Reply(author, content)
+		chunk.SetMeta(model.MetaChunkOf, replyID)
+		chunk.SetMeta(model.MetaChunkIndex, emitted)
+		if degraded != nil {
+			chunk.SetMeta(model.MetaDegraded, degraded)
+		}
+		emit(chunk)
+		emitted++
+	}
+
+	_, err := WithStream(chatbot).ChatStream(ctx, textIn, func(delta *model.TextOut) {
+		author = delta.Author
+		degraded = delta.Meta(model.MetaDegraded)
+		for _, s := range acc.Write(delta.Content) {
+			send(s)
+		}
+	})
+	if err != nil {
+		return emitted, err
+	}
+	if rest := acc.Flush(); rest != "" {
+		send(rest)
+	}
+	return emitted, nil
+}
+
+// TextOutFromChatbotStream is the streaming version of TextOutFromChatbot:
+// the responses are sent to textOutChan sentence by sentence.
+// See ChatSentences, and TextOutFromChatbot for the options: with several
+// workers, the sentences of a response are held until it's its turn.
+//
+// It returns when ctx is done (or textInChan is closed and the in-flight
+// TextIns are done).
+func TextOutFromChatbotStream(ctx context.Context, chatbot Chatbot, textInChan <-chan *model.TextIn, textOutChan chan<- *model.TextOut, opts ...WorkerOption) {
+	runWorkers(ctx, "TextOutFromChatbotStream", chanSource(textInChan), chatStream(chatbot),
+		textOutChan, newWorkerOptions(opts))
+}
+
+// chatStream is the handler of TextOutFromChatbotStream.
+func chatStream(chatbot Chatbot) handler {
+	return func(ctx context.Context, textIn *model.TextIn, emit func(out *model.TextOut)) {
+		if emitted, err := chatSentences(ctx, chatbot, textIn, emit); err != nil {
+			log.Printf("ERROR chatbot.ChatStream(%v) failed after %d sentences: %v", textIn, emitted, err)
+		}
+	}
+}
+
+// TextOutFromQueueStream is the streaming version of TextOutFromQueue.
+// See TextOutFromChatbotStream.
+//
+// A failed TextIn is requeued only if nothing of its response was sent:
+// the viewers should not hear the first half of an answer twice.
+// A TextIn answered by a stopgap is requeued as well (see TextOutFromQueue).
+func TextOutFromQueueStream(ctx context.Context, chatbot Chatbot, queue TextInQueue, textOutChan chan<- *model.TextOut, opts ...WorkerOption) {
+	runWorkers(ctx, "TextOutFromQueueStream", queueSource("TextOutFromQueueStream", queue),
+		chatStreamOrRequeue(requeueDegraded{WithStream(chatbot), queue}, queue),
+		textOutChan, newWorkerOptions(opts))
+}
+
+// chatStreamOrRequeue is the handler of TextOutFromQueueStream.
+func chatStreamOrRequeue(chatbot Chatbot, queue TextInQueue) handler {
+	return func(ctx context.Context, textIn *model.TextIn, emit func(out *model.TextOut)) {
+		emitted, err := chatSentences(ctx, chatbot, textIn, emit)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errRequeued) {
+			log.Printf("INFO [TextOutFromQueueStream] requeued instead of a degraded reply (%s): %q", textIn.Author, textIn.Content)
+			return
+		}
+		log.Printf("ERROR chatbot.ChatStream(%v) failed after %d sentences: %v", textIn, emitted, err)
+		if ctx.Err() == nil && emitted == 0 && queue.Requeue(textIn) {
+			log.Printf("INFO [TextOutFromQueueStream] requeued (%s): %q", textIn.Author, textIn.Content)
+		}
+	}
+}
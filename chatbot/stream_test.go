@@ -0,0 +1,204 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	chatbotv2 "muvtuberdriver/chatbot/proto"
+	"muvtuberdriver/model"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unaryOnlyServer is an old server that does not implement ChatStream.
+type unaryOnlyServer struct {
+	*fakeChatbotServer
+}
+
+func (s unaryOnlyServer) ChatStream(*chatbotv2.ChatRequest, chatbotv2.ChatbotService_ChatStreamServer) error {
+	return status.Error(codes.Unimplemented, "method ChatStream not implemented")
+}
+
+func TestSessionClientsPool_ChatStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		srv        chatbotv2.ChatbotServiceServer
+		wantDeltas int
+	}{
+		{"stream", &fakeChatbotServer{}, len([]rune("echo: hi。"))},
+		{"fallback to unary", unaryOnlyServer{&fakeChatbotServer{}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := startFakeChatbotServer(t, tt.srv, false)
+			p, err := NewSessionClientsPool(addr, NoChatbotConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			textIn := model.NewTextIn(model.SourceDm, "a", "hi。", 0)
+
+			for i := 0; i < 2; i++ { // the 2nd time: the fallback is remembered
+				var deltas []string
+				textOut, err := p.ChatStream(context.Background(), textIn, func(delta *model.TextOut) {
+					deltas = append(deltas, delta.Content)
+				})
+				if err != nil || textOut.Content != "echo: hi。" {
+					t.Fatalf("ChatStream() = %v, %v", textOut, err)
+				}
+				if len(deltas) != tt.wantDeltas {
+					t.Errorf("ChatStream() deltas = %q", deltas)
+				}
+			}
+		})
+	}
+}
+
+// piecesChatbot streams the pieces, then fails with err (if not nil).
+type piecesChatbot struct {
+	pieces []string
+	err    error
+}
+
+func (c *piecesChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatContext(context.Background(), textIn)
+}
+
+func (c *piecesChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatStream(ctx, textIn, func(*model.TextOut) {})
+}
+
+func (c *piecesChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	content := ""
+	for _, p := range c.pieces {
+		content += p
+		onDelta(textIn.Reply("pieces", p))
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return textIn.Reply("pieces", content), nil
+}
+
+func TestChatSentences(t *testing.T) {
+	bot := &piecesChatbot{pieces: []string{"你好", "。今天天气", "不错！我们", "去玩吧"}}
+	textIn := model.NewTextIn(model.SourceDm, "a", "hi", 0)
+	out := make(chan *model.TextOut, 10)
+
+	sent, err := ChatSentences(context.Background(), bot, textIn, out)
+	if err != nil || sent != 3 {
+		t.Fatalf("ChatSentences() = %v, %v, want 3, nil", sent, err)
+	}
+	close(out)
+
+	var got []string
+	var chunkOf any
+	for chunk := range out {
+		got = append(got, chunk.Content)
+		if chunk.Author != "pieces" || chunk.ReplyTo != textIn {
+			t.Errorf("chunk %q: author=%q replyTo=%v", chunk.Content, chunk.Author, chunk.ReplyTo)
+		}
+		if chunkOf == nil {
+			chunkOf = chunk.Meta(model.MetaChunkOf)
+		}
+		if chunk.Meta(model.MetaChunkOf) != chunkOf || chunk.Meta(model.MetaChunkIndex) != len(got)-1 {
+			t.Errorf("chunk %q: meta=%v", chunk.Content, chunk.Metadata)
+		}
+	}
+	if want := []string{"你好。", "今天天气不错！", "我们去玩吧"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sentences = %q, want %q", got, want)
+	}
+}
+
+func TestPrioritizedChatbot_ChatStream(t *testing.T) {
+	errBroken := errors.New("broken")
+	textIn := model.NewTextIn(model.SourceDm, "a", "hi", 1)
+
+	chat := func(p *PrioritizedChatbot) (string, []string, error) {
+		var deltas []string
+		textOut, err := p.ChatStream(context.Background(), textIn, func(delta *model.TextOut) {
+			deltas = append(deltas, delta.Content)
+		})
+		if textOut == nil {
+			return "", deltas, err
+		}
+		return textOut.Content, deltas, err
+	}
+
+	// failed before speaking: next level
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{
+		0: &fakeChatbot{name: "low"},
+		1: &piecesChatbot{err: errBroken},
+	})
+	if got, deltas, err := chat(p); err != nil || got != "low" || !reflect.DeepEqual(deltas, []string{"low"}) {
+		t.Errorf("ChatStream() = %q, %q, %v, want low from level 0", got, deltas, err)
+	}
+
+	// failed halfway: no next level, no canned reply
+	p = NewPrioritizedChatbot(map[model.Priority]Chatbot{
+		0: &fakeChatbot{name: "low"},
+		1: &piecesChatbot{pieces: []string{"一半"}, err: errBroken},
+	}, WithCannedReplies("canned"))
+	if _, deltas, err := chat(p); !errors.Is(err, errBroken) || !reflect.DeepEqual(deltas, []string{"一半"}) {
+		t.Errorf("ChatStream() = %q, %v, want the halfway error", deltas, err)
+	}
+}
+
+// sliceQueue pops the textIns in order, and requeues the super chats
+// (to requeued, not back to the queue).
+type sliceQueue struct {
+	textIns  chan *model.TextIn
+	requeued []*model.TextIn
+}
+
+func (q *sliceQueue) Pop(ctx context.Context) (*model.TextIn, error) {
+	select {
+	case textIn := <-q.textIns:
+		return textIn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *sliceQueue) Requeue(textIn *model.TextIn) bool {
+	if textIn.Source != model.SourceSuperChat {
+		return false
+	}
+	q.requeued = append(q.requeued, textIn)
+	return true
+}
+
+func TestTextOutFromQueue_Degraded(t *testing.T) {
+	broken := &fakeChatbot{name: "broken", err: errors.New("broken")}
+	p := NewPrioritizedChatbot(map[model.Priority]Chatbot{0: broken}, WithCannedReplies("canned。"))
+
+	stages := map[string]func(context.Context, Chatbot, TextInQueue, chan<- *model.TextOut, ...WorkerOption){
+		"unary":  TextOutFromQueue,
+		"stream": TextOutFromQueueStream,
+	}
+	for name, stage := range stages {
+		t.Run(name, func(t *testing.T) {
+			q := &sliceQueue{textIns: make(chan *model.TextIn, 2)}
+			sc := model.NewTextIn(model.SourceSuperChat, "rich", "sc", 0)
+			q.textIns <- sc
+			q.textIns <- model.NewTextIn(model.SourceDm, "a", "dm", 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			textOutChan := make(chan *model.TextOut, 2)
+			go stage(ctx, p, q, textOutChan)
+
+			// the super chat is requeued, the dm gets the canned reply
+			textOut := <-textOutChan
+			if textOut.ReplyTo.Content != "dm" || !IsDegraded(textOut) {
+				t.Errorf("got %+v, want the canned reply to dm", textOut)
+			}
+			cancel()
+			if len(q.requeued) != 1 || q.requeued[0] != sc {
+				t.Errorf("requeued = %v, want the super chat", q.requeued)
+			}
+		})
+	}
+}
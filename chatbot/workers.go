@@ -0,0 +1,318 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"muvtuberdriver/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cdfmlr/ellipsis"
+)
+
+// Order is the order in which TextOutFromChatbot (and the queue and stream
+// versions) outputs the answers when several TextIns are handled in
+// parallel (WithWorkers).
+type Order int
+
+const (
+	// OrderArrival: the answers are output in the order their TextIns
+	// arrived. A slow answer holds the later ones back until it's done.
+	OrderArrival Order = iota
+	// OrderPriority: an answer waits only for the earlier TextIns of the
+	// same or a higher priority. E.g. a super chat is not held back by
+	// a slow danmaku before it, but danmaku are still in arrival order.
+	OrderPriority
+)
+
+// ParseOrder parses "arrival" (or "") and "priority".
+func ParseOrder(s string) (Order, error) {
+	switch strings.ToLower(s) {
+	case "", "arrival":
+		return OrderArrival, nil
+	case "priority":
+		return OrderPriority, nil
+	}
+	return 0, fmt.Errorf("unknown order %q (want arrival or priority)", s)
+}
+
+func (o Order) String() string {
+	switch o {
+	case OrderArrival:
+		return "arrival"
+	case OrderPriority:
+		return "priority"
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+type workerOptions struct {
+	workers int
+	order   Order
+	maxAge  time.Duration
+}
+
+// WorkerOption configures TextOutFromChatbot, TextOutFromChatbotStream,
+// TextOutFromQueue and TextOutFromQueueStream.
+type WorkerOption func(o *workerOptions)
+
+func newWorkerOptions(opts []WorkerOption) workerOptions {
+	o := workerOptions{workers: 1, order: OrderArrival}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithWorkers sets how many TextIns are handled in parallel. Default: 1.
+//
+// It's no use to set it larger than the sessions the chatbots can serve
+// at the same time (e.g. DefaultClientPoolSize of a SessionClientsPool).
+func WithWorkers(n int) WorkerOption {
+	return func(o *workerOptions) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// WithOrder sets the output order of the answers. Default: OrderArrival.
+func WithOrder(order Order) WorkerOption {
+	return func(o *workerOptions) {
+		o.order = order
+	}
+}
+
+// WithMaxAge drops the answers whose TextIn (question) is older than d:
+// nobody remembers the question anymore. The TextIns already older than d
+// when a worker takes them are dropped without chatting.
+// Default: 0, never drop.
+func WithMaxAge(d time.Duration) WorkerOption {
+	return func(o *workerOptions) {
+		o.maxAge = d
+	}
+}
+
+// job is a TextIn handled by a worker.
+type job struct {
+	textIn *model.TextIn
+	outs   []*model.TextOut // emitted by the handler, not output yet
+	sent   int              // outs output
+	stale  bool             // too old when its first out was ready: drop all its outs
+	done   bool
+}
+
+// jobEvent is from a worker: an out of the job, or the job is done.
+type jobEvent struct {
+	job  *job
+	out  *model.TextOut
+	done bool
+}
+
+// source takes the next TextIn for a worker: ok is false if there is no
+// more (closed or ctx done).
+type source func(ctx context.Context) (textIn *model.TextIn, ok bool)
+
+// handler answers the textIn in a worker: it emits the TextOuts of the
+// answer in order (one, or the sentences of a stream), and returns when
+// it's done.
+type handler func(ctx context.Context, textIn *model.TextIn, emit func(out *model.TextOut))
+
+// chanSource takes the TextIns from the channel.
+func chanSource(textInChan <-chan *model.TextIn) source {
+	return func(ctx context.Context) (*model.TextIn, bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, false
+			case textIn, ok := <-textInChan:
+				if !ok {
+					return nil, false
+				}
+				if textIn != nil {
+					return textIn, true
+				}
+			}
+		}
+	}
+}
+
+// runWorkers: source -> workers (handler) -> (reorder) -> textOutChan
+//
+// A worker takes the next TextIn only when it is free. The TextIns are
+// taken one at a time, so the loop gets the jobs in the arrival order.
+// The loop owns the pending jobs: it outputs the outs once they can be in
+// the order (see waiting). The outs of a job (e.g. the sentences of a
+// stream) are output as soon as they arrive if the job is the next one,
+// and the outs of two jobs never interleave.
+//
+// name is for the logs.
+func runWorkers(ctx context.Context, name string, next source, handle handler, textOutChan chan<- *model.TextOut, o workerOptions) {
+	started := make(chan *job)
+	events := make(chan jobEvent)
+
+	var takeMu sync.Mutex // takes the TextIns one at a time, in order
+	take := func() (*job, bool) {
+		takeMu.Lock()
+		defer takeMu.Unlock()
+		textIn, ok := next(ctx)
+		if !ok {
+			return nil, false
+		}
+		j := &job{textIn: textIn}
+		select {
+		case started <- j:
+			return j, true
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	send := func(e jobEvent) bool {
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				j, ok := take()
+				if !ok {
+					return
+				}
+				if age, old := tooOld(j.textIn, o.maxAge); old {
+					log.Printf("INFO [%s] drop stale question (%v old) from (%s): %q",
+						name, age.Round(time.Second), j.textIn.Author, ellipsis.Ending(j.textIn.Content, 20))
+				} else {
+					handle(ctx, j.textIn, func(out *model.TextOut) {
+						send(jobEvent{job: j, out: out})
+					})
+				}
+				if !send(jobEvent{job: j, done: true}) {
+					return
+				}
+			}
+		}()
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+	defer wg.Wait()
+
+	var pending []*job // in the arrival order
+	var speaking *job  // the job whose outs are being output
+	output := func() bool {
+		for {
+			if speaking == nil {
+				for i, j := range pending {
+					if (len(j.outs) > 0 || j.done) && !waiting(pending[:i], j, o.order) {
+						speaking = j
+						break
+					}
+				}
+			}
+			if speaking == nil {
+				return true
+			}
+			for _, out := range speaking.outs {
+				if speaking.sent == 0 && !speaking.stale {
+					if age, old := tooOld(speaking.textIn, o.maxAge); old {
+						log.Printf("INFO [%s] drop stale answer (%v old) to (%s): %q",
+							name, age.Round(time.Second), speaking.textIn.Author, ellipsis.Ending(speaking.textIn.Content, 20))
+						speaking.stale = true
+					}
+				}
+				if speaking.stale {
+					continue
+				}
+				select {
+				case textOutChan <- out:
+					speaking.sent++
+				case <-ctx.Done():
+					return false
+				}
+			}
+			speaking.outs = nil
+			if !speaking.done {
+				return true // more outs to come
+			}
+			for i, j := range pending {
+				if j == speaking {
+					pending = append(pending[:i], pending[i+1:]...)
+					break
+				}
+			}
+			speaking = nil
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("INFO [%s] stop: %v", name, ctx.Err())
+			return
+		case <-workersDone:
+			return // no more TextIns, and all done
+		case j := <-started:
+			pending = append(pending, j)
+		case e := <-events:
+			if e.done {
+				e.job.done = true
+			} else {
+				e.job.outs = append(e.job.outs, e.out)
+			}
+			if !output() {
+				return
+			}
+		}
+	}
+}
+
+// chat is the handler of TextOutFromChatbot: the answer of the chatbot,
+// nothing if failed.
+func chat(chatbot ContextChatbot) handler {
+	return func(ctx context.Context, textIn *model.TextIn, emit func(out *model.TextOut)) {
+		textOut, err := chatbot.ChatContext(ctx, textIn)
+		if err != nil {
+			log.Printf("ERROR chatbot.Chat(%v) failed: %v", textIn, err)
+			return
+		}
+		if textOut != nil {
+			emit(textOut)
+		}
+	}
+}
+
+// tooOld reports whether the textIn is older than maxAge (0 for never).
+func tooOld(textIn *model.TextIn, maxAge time.Duration) (age time.Duration, old bool) {
+	if maxAge <= 0 || textIn.Timestamp.IsZero() {
+		return 0, false
+	}
+	age = time.Since(textIn.Timestamp)
+	return age, age > maxAge
+}
+
+// waiting reports whether j should wait for any job still running in before:
+// any job for OrderArrival, the jobs of the same or a higher priority for
+// OrderPriority.
+func waiting(before []*job, j *job, order Order) bool {
+	for _, b := range before {
+		if b.done {
+			continue
+		}
+		if order == OrderArrival || b.textIn.Priority >= j.textIn.Priority {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package chatbot
+
+import (
+	"context"
+	"muvtuberdriver/model"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sleepChatbot sleeps for the milliseconds in the content, and echoes it.
+// It counts the peak of the concurrent Chats.
+type sleepChatbot struct {
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *sleepChatbot) Chat(textIn *model.TextIn) (*model.TextOut, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for peak := c.peak.Load(); n > peak && !c.peak.CompareAndSwap(peak, n); peak = c.peak.Load() {
+	}
+
+	ms, _ := strconv.Atoi(textIn.Content)
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return textIn.Reply("sleep", textIn.Content), nil
+}
+
+func TestTextOutFromChatbot_Workers(t *testing.T) {
+	ins := []*model.TextIn{
+		model.NewTextIn(model.SourceDm, "a", "200", model.PriorityLow),
+		model.NewTextIn(model.SourceDm, "b", "10", model.PriorityLow),
+		model.NewTextIn(model.SourceSuperChat, "c", "50", model.PriorityHigh),
+	}
+	stale := model.NewTextIn(model.SourceDm, "d", "10", model.PriorityLow)
+	stale.Timestamp = time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		opts []WorkerOption
+		want []string
+	}{
+		{"arrival", []WorkerOption{WithWorkers(3)}, []string{"200", "10", "50", "10"}},
+		{"priority", []WorkerOption{WithWorkers(3), WithOrder(OrderPriority)}, []string{"50", "200", "10", "10"}},
+		{"maxAge", []WorkerOption{WithWorkers(3), WithMaxAge(time.Minute)}, []string{"200", "10", "50"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textInChan := make(chan *model.TextIn, len(ins)+1)
+			textOutChan := make(chan *model.TextOut, len(ins)+1)
+			for _, in := range ins {
+				textInChan <- in
+			}
+			textInChan <- stale
+			close(textInChan)
+
+			chatbot := &sleepChatbot{}
+			TextOutFromChatbot(context.Background(), chatbot, textInChan, textOutChan, tt.opts...)
+			close(textOutChan)
+
+			// the others are answered while the 200ms one is sleeping
+			if peak := chatbot.peak.Load(); peak < 2 {
+				t.Errorf("peak concurrent Chats = %v, want the TextIns handled in parallel", peak)
+			}
+			var got []string
+			for out := range textOutChan {
+				got = append(got, out.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sleepStreamChatbot streams two sentences, sleeping half of the
+// milliseconds in the content before each.
+type sleepStreamChatbot struct{ sleepChatbot }
+
+func (c *sleepStreamChatbot) ChatContext(ctx context.Context, textIn *model.TextIn) (*model.TextOut, error) {
+	return c.ChatStream(ctx, textIn, func(*model.TextOut) {})
+}
+
+func (c *sleepStreamChatbot) ChatStream(ctx context.Context, textIn *model.TextIn, onDelta func(delta *model.TextOut)) (*model.TextOut, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for peak := c.peak.Load(); n > peak && !c.peak.CompareAndSwap(peak, n); peak = c.peak.Load() {
+	}
+
+	ms, _ := strconv.Atoi(textIn.Content)
+	for _, s := range []string{"a。", "b。"} {
+		time.Sleep(time.Duration(ms/2) * time.Millisecond)
+		onDelta(textIn.Reply("sleep", textIn.Content+s))
+	}
+	return textIn.Reply("sleep", textIn.Content+"a。b。"), nil
+}
+
+func TestTextOutFromChatbotStream_Workers(t *testing.T) {
+	tests := []struct {
+		name  string
+		order Order
+		want  []string
+	}{
+		{"arrival", OrderArrival, []string{"200a。", "200b。", "20a。", "20b。"}},
+		{"priority", OrderPriority, []string{"20a。", "20b。", "200a。", "200b。"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textInChan := make(chan *model.TextIn, 2)
+			textOutChan := make(chan *model.TextOut, 4)
+			textInChan <- model.NewTextIn(model.SourceDm, "a", "200", model.PriorityLow)
+			textInChan <- model.NewTextIn(model.SourceSuperChat, "b", "20", model.PriorityHigh)
+			close(textInChan)
+
+			chatbot := &sleepStreamChatbot{}
+			TextOutFromChatbotStream(context.Background(), chatbot, textInChan, textOutChan,
+				WithWorkers(2), WithOrder(tt.order))
+			close(textOutChan)
+
+			if peak := chatbot.peak.Load(); peak < 2 {
+				t.Errorf("peak concurrent ChatStreams = %v, want the TextIns handled in parallel", peak)
+			}
+			// the sentences of a reply are not interleaved with another's
+			var got []string
+			for out := range textOutChan {
+				got = append(got, out.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
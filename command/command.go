@@ -0,0 +1,339 @@
+// Package command routes the viewer commands (danmaku like "!motion wave")
+// to their handlers before the messages reach the chatbot.
+//
+// A Handler is registered to a Router with its permission and cooldowns:
+//
+//	r := command.NewRouter()
+//	r.Register("motion", command.MotionHandler(live2d, nil),
+//	    command.WithCooldown(10*time.Second))
+//	r.Register("ask", command.AskHandler(1),
+//	    command.WithPermission(command.PermissionMedal), command.WithMinMedalLevel(5))
+//
+//	forward, handled := r.Route(textIn)
+//
+// Anything that is not a registered command passes through untouched,
+// so an excited "!!!" is still chat.
+package command
+
+import (
+	"errors"
+	"fmt"
+	"muvtuberdriver/model"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// Command is a parsed viewer command:
+//
+//	"!bgm  next song" -> {Name: "bgm", Args: ["next", "song"], ArgText: "next song"}
+type Command struct {
+	Name    string   // lower case, without the prefix
+	Args    []string // split by spaces
+	ArgText string   // everything after the name, trimmed
+	TextIn  *model.TextIn
+}
+
+// Handler handles a command.
+//
+// Handle returns the TextIn to forward down the chain (to the chatbot),
+// or nil if the command is done. A returned error is logged, and the
+// command is dropped.
+type Handler interface {
+	Handle(cmd *Command) (forward *model.TextIn, err error)
+}
+
+// HandlerFunc is a function implementing the Handler interface.
+type HandlerFunc func(cmd *Command) (*model.TextIn, error)
+
+func (f HandlerFunc) Handle(cmd *Command) (*model.TextIn, error) {
+	return f(cmd)
+}
+
+// Permission is who can use a command.
+type Permission int
+
+const (
+	PermissionAnyone    Permission = iota
+	PermissionMedal                // fan medal (粉丝牌) level >= MinMedalLevel, or a moderator
+	PermissionModerator            // room admins (房管) and the streamer
+)
+
+// ParsePermission parses "anyone" (or ""), "medal" and "moderator".
+func ParsePermission(s string) (Permission, error) {
+	switch strings.ToLower(s) {
+	case "", "anyone":
+		return PermissionAnyone, nil
+	case "medal":
+		return PermissionMedal, nil
+	case "moderator":
+		return PermissionModerator, nil
+	}
+	return 0, fmt.Errorf("unknown permission %q (want anyone, medal or moderator)", s)
+}
+
+// author types in model.MetaAuthorType
+const (
+	authorTypeAdmin    = 2
+	authorTypeStreamer = 3
+)
+
+// IsModerator reports whether the author of textIn is a room admin or the streamer.
+func IsModerator(textIn *model.TextIn) bool {
+	t, _ := textIn.MetaInt(model.MetaAuthorType)
+	return t == authorTypeAdmin || t == authorTypeStreamer
+}
+
+// region Router
+
+// Router recognizes the commands and routes them to the handlers.
+// It is safe for concurrent use.
+type Router struct {
+	prefixes []string
+
+	mu       sync.Mutex
+	commands map[string]*route // name or alias -> route
+
+	now func() time.Time // for testing
+}
+
+type route struct {
+	name    string
+	handler Handler
+
+	permission     Permission
+	minMedalLevel  int
+	cooldown       time.Duration // global: anyone
+	authorCooldown time.Duration // per author
+	aliases        []string
+
+	lastUsed       time.Time
+	authorLastUsed map[string]time.Time
+}
+
+// DefaultPrefixes are the command prefixes by default: half and full width.
+var DefaultPrefixes = []string{"!", "！"}
+
+// NewRouter creates a Router recognizing the prefixes
+// (DefaultPrefixes if none).
+func NewRouter(prefixes ...string) *Router {
+	if len(prefixes) == 0 {
+		prefixes = DefaultPrefixes
+	}
+	return &Router{
+		prefixes: prefixes,
+		commands: map[string]*route{},
+		now:      time.Now,
+	}
+}
+
+type RouteOption func(r *route)
+
+// WithPermission sets who can use the command. Default: PermissionAnyone.
+func WithPermission(p Permission) RouteOption {
+	return func(r *route) {
+		r.permission = p
+	}
+}
+
+// WithMinMedalLevel sets the min fan medal level for PermissionMedal.
+func WithMinMedalLevel(level int) RouteOption {
+	return func(r *route) {
+		r.minMedalLevel = level
+	}
+}
+
+// WithCooldown sets the cooldown of the command for everyone:
+// after it's used, nobody can use it again within d.
+func WithCooldown(d time.Duration) RouteOption {
+	return func(r *route) {
+		r.cooldown = d
+	}
+}
+
+// WithAuthorCooldown sets the cooldown of the command for each author.
+func WithAuthorCooldown(d time.Duration) RouteOption {
+	return func(r *route) {
+		r.authorCooldown = d
+	}
+}
+
+// WithAliases sets other names of the command.
+func WithAliases(aliases ...string) RouteOption {
+	return func(r *route) {
+		r.aliases = aliases
+	}
+}
+
+// Register registers the handler to the command name (case-insensitive).
+// Moderators are not limited by the cooldowns.
+func (r *Router) Register(name string, handler Handler, opts ...RouteOption) error {
+	rt := &route{
+		name:           strings.ToLower(name),
+		handler:        handler,
+		authorLastUsed: map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := append([]string{rt.name}, rt.aliases...)
+	for _, n := range names {
+		n = strings.ToLower(n)
+		if !isName(n) {
+			return fmt.Errorf("bad command name %q", n)
+		}
+		if _, ok := r.commands[n]; ok {
+			return fmt.Errorf("duplicate command name %q", n)
+		}
+	}
+	for _, n := range names {
+		r.commands[strings.ToLower(n)] = rt
+	}
+	return nil
+}
+
+// Parse parses the content as a command: a prefix followed by a name
+// (letters, digits, '_' and '-', starting with a letter).
+// The name is not checked against the registered ones.
+func (r *Router) Parse(content string) (*Command, bool) {
+	content = strings.TrimSpace(content)
+	for _, prefix := range r.prefixes {
+		if !strings.HasPrefix(content, prefix) {
+			continue
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(content, prefix))
+		fields := strings.Fields(rest)
+		if len(fields) == 0 || !isName(strings.ToLower(fields[0])) {
+			return nil, false
+		}
+		name := fields[0]
+		return &Command{
+			Name:    strings.ToLower(name),
+			Args:    fields[1:],
+			ArgText: strings.TrimSpace(strings.TrimPrefix(rest, name)),
+		}, true
+	}
+	return nil, false
+}
+
+func isName(s string) bool {
+	for i, c := range s {
+		switch {
+		case i == 0 && !unicode.IsLetter(c):
+			return false
+		case unicode.IsLetter(c), unicode.IsDigit(c), c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Route routes the textIn:
+//
+//   - not a registered command: (textIn, false), pass it through.
+//   - a command: (forward, true), where forward is what the handler wants
+//     to pass down (nil for nothing). A command not permitted or cooling
+//     down is dropped (nil, true).
+func (r *Router) Route(textIn *model.TextIn) (forward *model.TextIn, handled bool) {
+	if textIn == nil {
+		return nil, false
+	}
+	cmd, ok := r.Parse(textIn.Content)
+	if !ok {
+		return textIn, false
+	}
+
+	r.mu.Lock()
+	rt, ok := r.commands[cmd.Name]
+	r.mu.Unlock()
+	if !ok {
+		return textIn, false
+	}
+	cmd.Name = rt.name // alias -> name
+	cmd.TextIn = textIn
+
+	logger := slog.With("command", cmd.Name, "author", textIn.Author, "args", ellipsis.Ending(cmd.ArgText, 20))
+
+	if err := rt.check(textIn); err != nil {
+		logger.Info("[command] denied.", "reason", err)
+		return nil, true
+	}
+	if err := r.tryCooldown(rt, textIn); err != nil {
+		logger.Info("[command] denied.", "reason", err)
+		return nil, true
+	}
+
+	forward, err := rt.handler.Handle(cmd)
+	if err != nil {
+		logger.Warn("[command] failed.", "err", err)
+		return nil, true
+	}
+	logger.Info("[command] handled.", "forward", forward != nil)
+	return forward, true
+}
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrCoolingDown      = errors.New("cooling down")
+)
+
+// check checks the permission.
+func (rt *route) check(textIn *model.TextIn) error {
+	if rt.permission == PermissionAnyone || IsModerator(textIn) {
+		return nil
+	}
+	if rt.permission == PermissionMedal {
+		level, _ := textIn.MetaInt(model.MetaMedalLevel)
+		if level >= rt.minMedalLevel {
+			return nil
+		}
+		return fmt.Errorf("%w: medal level %d < %d", ErrPermissionDenied, level, rt.minMedalLevel)
+	}
+	return fmt.Errorf("%w: moderators only", ErrPermissionDenied)
+}
+
+// tryCooldown checks the cooldowns, and starts them if passed.
+// Moderators are not limited.
+func (r *Router) tryCooldown(rt *route, textIn *model.TextIn) error {
+	if IsModerator(textIn) {
+		return nil
+	}
+	author := textIn.AuthorID
+	if author == "" {
+		author = textIn.Author
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if left := rt.lastUsed.Add(rt.cooldown).Sub(now); rt.cooldown > 0 && left > 0 {
+		return fmt.Errorf("%w: %v left", ErrCoolingDown, left.Round(time.Second))
+	}
+	if left := rt.authorLastUsed[author].Add(rt.authorCooldown).Sub(now); rt.authorCooldown > 0 && left > 0 {
+		return fmt.Errorf("%w: %v left for %s", ErrCoolingDown, left.Round(time.Second), textIn.Author)
+	}
+
+	rt.lastUsed = now
+	if rt.authorCooldown > 0 {
+		rt.authorLastUsed[author] = now
+		// forget the authors cooled down, so the map does not grow forever
+		for a, t := range rt.authorLastUsed {
+			if now.Sub(t) >= rt.authorCooldown {
+				delete(rt.authorLastUsed, a)
+			}
+		}
+	}
+	return nil
+}
+
+// endregion Router
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"muvtuberdriver/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRouter_Parse(t *testing.T) {
+	r := NewRouter()
+	tests := []struct {
+		content string
+		want    *Command
+	}{
+		{"!bgm  next song", &Command{Name: "bgm", Args: []string{"next", "song"}, ArgText: "next song"}},
+		{"！Motion wave", &Command{Name: "motion", Args: []string{"wave"}, ArgText: "wave"}},
+		{"! ask 今天 吃什么", &Command{Name: "ask", Args: []string{"今天", "吃什么"}, ArgText: "今天 吃什么"}},
+		{"!!!", nil},
+		{"!1st", nil},
+		{"hello !bgm", nil},
+	}
+	for _, tt := range tests {
+		got, ok := r.Parse(tt.content)
+		if ok != (tt.want != nil) || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v", tt.content, got, ok, tt.want)
+		}
+	}
+}
+
+func newTextIn(author, content string, authorType, medalLevel int) *model.TextIn {
+	textIn := model.NewTextIn(model.SourceDm, author, content, model.PriorityLow)
+	textIn.AuthorID = author
+	textIn.SetMeta(model.MetaAuthorType, authorType)
+	textIn.SetMeta(model.MetaMedalLevel, medalLevel)
+	return textIn
+}
+
+func TestRouter_Route(t *testing.T) {
+	var handled []string
+	record := HandlerFunc(func(cmd *Command) (*model.TextIn, error) {
+		handled = append(handled, cmd.Name+":"+cmd.TextIn.Author)
+		return nil, nil
+	})
+
+	r := NewRouter()
+	now := time.Unix(0, 0)
+	r.now = func() time.Time { return now }
+
+	must(t, r.Register("wave", record, WithAliases("hi"), WithAuthorCooldown(10*time.Second)))
+	must(t, r.Register("ban", record, WithPermission(PermissionModerator)))
+	must(t, r.Register("vip", record, WithPermission(PermissionMedal), WithMinMedalLevel(5)))
+	must(t, r.Register("ask", AskHandler(1), WithCooldown(time.Minute)))
+
+	if err := r.Register("HI", record); err == nil {
+		t.Error("Register duplicate alias: want error")
+	}
+
+	// not a registered command: pass through
+	textIn := newTextIn("a", "!!! 好耶", 0, 0)
+	if forward, ok := r.Route(textIn); ok || forward != textIn {
+		t.Errorf("Route(not a command) = %v, %v; want pass through", forward, ok)
+	}
+	if forward, ok := r.Route(newTextIn("a", "!unknown", 0, 0)); ok || forward == nil {
+		t.Errorf("Route(unknown command) = %v, %v; want pass through", forward, ok)
+	}
+
+	r.Route(newTextIn("a", "!wave", 0, 0))
+	r.Route(newTextIn("a", "!hi", 0, 0))    // a: cooling down
+	r.Route(newTextIn("b", "!hi", 0, 0))    // b: ok
+	r.Route(newTextIn("a", "!ban x", 0, 0)) // not a moderator
+	r.Route(newTextIn("m", "!ban x", 2, 0))
+	r.Route(newTextIn("a", "!vip", 0, 4))
+	r.Route(newTextIn("c", "!vip", 0, 5))
+	now = now.Add(10 * time.Second)
+	r.Route(newTextIn("a", "!wave", 0, 0)) // cooled down
+
+	want := []string{"wave:a", "wave:b", "ban:m", "vip:c", "wave:a"}
+	if !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled = %v, want %v", handled, want)
+	}
+
+	// ask: forward the question with priority boosted
+	forward, ok := r.Route(newTextIn("a", "!ask 今天吃什么", 0, 0))
+	if !ok || forward == nil || forward.Content != "今天吃什么" || forward.Priority != model.PriorityNormal {
+		t.Errorf("Route(ask) = %+v, %v", forward, ok)
+	}
+	if forward, ok := r.Route(newTextIn("b", "!ask 明天呢", 0, 0)); !ok || forward != nil {
+		t.Errorf("Route(ask cooling down) = %+v, %v; want dropped", forward, ok)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"muvtuberdriver/audio"
+	"muvtuberdriver/live2d"
+	"muvtuberdriver/model"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MotionHandler: "!motion wave" plays the live2d motion.
+//
+// motions maps what viewers type to the motion names of the model
+// (e.g. {"wave": "tap_body"}); only the listed ones are allowed.
+// If motions is empty, the arg is used as the motion name directly.
+func MotionHandler(driver live2d.Driver, motions map[string]string) Handler {
+	return HandlerFunc(func(cmd *Command) (*model.TextIn, error) {
+		if len(cmd.Args) == 0 {
+			return nil, errors.New("motion: which motion?")
+		}
+		motion := cmd.Args[0]
+		if len(motions) > 0 {
+			m, ok := motions[strings.ToLower(motion)]
+			if !ok {
+				return nil, fmt.Errorf("motion: unknown motion %q", motion)
+			}
+			motion = m
+		}
+		driver.Live2dToMotion(motion)
+		return nil, nil
+	})
+}
+
+// AskHandler: "!ask 今天吃什么" forwards "今天吃什么" to the chatbot,
+// with the priority raised by boost (e.g. to let fans reach a better
+// chatbot).
+func AskHandler(boost model.Priority) Handler {
+	return HandlerFunc(func(cmd *Command) (*model.TextIn, error) {
+		if cmd.ArgText == "" {
+			return nil, errors.New("ask: nothing to ask")
+		}
+		forward := *cmd.TextIn
+		forward.Content = cmd.ArgText
+		forward.Priority += boost
+		if forward.Priority > model.PriorityHighest {
+			forward.Priority = model.PriorityHighest
+		}
+		return &forward, nil
+	})
+}
+
+// TrackHandler plays the named audio tracks (name -> src) by play,
+// e.g. controller.PlayBgm:
+//
+//	!bgm           the next track (in the order of the names)
+//	!bgm next      the next track
+//	!bgm random    a random track
+//	!bgm <name>    the named track
+func TrackHandler(play func(track *audio.Track) error, tracks map[string]string) Handler {
+	srcs := make(map[string]string, len(tracks)) // lower case name -> src
+	names := make([]string, 0, len(tracks))
+	for name, src := range tracks {
+		name = strings.ToLower(name)
+		srcs[name] = src
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mu sync.Mutex
+	next := 0
+
+	return HandlerFunc(func(cmd *Command) (*model.TextIn, error) {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%s: no tracks", cmd.Name)
+		}
+
+		mu.Lock()
+		var name string
+		switch arg := strings.ToLower(cmd.ArgText); arg {
+		case "", "next":
+			name = names[next%len(names)]
+			next++
+		case "random":
+			name = names[rand.Intn(len(names))]
+		default:
+			if _, ok := srcs[arg]; !ok {
+				mu.Unlock()
+				return nil, fmt.Errorf("%s: unknown track %q", cmd.Name, arg)
+			}
+			name = arg
+		}
+		mu.Unlock()
+
+		track := &audio.Track{
+			ID:       model.NewID(),
+			Src:      srcs[name],
+			PlayMode: string(audio.PlayAtNow),
+		}
+		if err := play(track); err != nil {
+			return nil, fmt.Errorf("%s: play %q: %w", cmd.Name, name, err)
+		}
+		return nil, nil
+	})
+}
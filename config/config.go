@@ -24,18 +24,35 @@ type config struct {
 	Chatbot     ChatbotConfig     // 聊天机器人
 	Sayer       SayerConfig       // 文本语音合成
 	Listen      ListenConfig      // 这个程序会监听的一些地址
+	Filters     FiltersConfig     // 过滤器链
+	Queue       QueueConfig       // 优先队列: chatbot 从队列中拉取消息
+	Transcript  TranscriptConfig  // 对话记录 (JSONL): 用于分析和收集训练数据
+	Persona     PersonaConfig     // 人设: 运行时通过管理接口切换
 
-	// ⬇️ 杂项
+	// ⬇️ 杂项: 旧版的过滤器配置。仅在 Filters 为空时使用，见 GetFilters
 
-	ReadDm         bool          // 复读评论
-	ReduceDuration int           // 评论筛选时间间隔 (秒)
-	TooLong        TooLongConfig // 文本太长了，弃之，随机抱怨
+	ReadDm         bool          `yaml:",omitempty"` // 复读评论
+	ReduceDuration int           `yaml:",omitempty"` // 评论筛选时间间隔 (秒)
+	TooLong        TooLongConfig `yaml:",omitempty"` // 文本太长了，弃之，随机抱怨
 }
 
 // BlivedmConfig 获取弹幕的配置
 type BlivedmConfig struct {
-	Server string // blivedm server address
-	Roomid int    // bilibili live room id
+	Protocol string // blivechat (默认，经过 blivechat 代理) | bilibili (直连 bilibili 弹幕服务器，见 Bilibili)
+	Server   string // blivedm server address
+	Roomid   int    // bilibili live room id
+
+	Bilibili BilibiliDmConfig // protocol=bilibili 时使用，代替 Server 和 Roomid
+
+	GiftTemplate   string // 收到礼物时 vtuber 看到的消息: {author} {gift} {num} {coin}。留空则忽略礼物
+	GiftMinCoin    int64  // 忽略总价值 (金瓜子, 1000 = 1 CNY) 低于此值的礼物
+	MemberTemplate string // 有人上舰时 vtuber 看到的消息: {author} {guard}。留空则忽略上舰
+}
+
+// BilibiliDmConfig 直连 bilibili 弹幕服务器的配置
+type BilibiliDmConfig struct {
+	RoomID int    `yaml:"room_id"` // bilibili live room id
+	Server string // 弹幕服务器 (wss://.../sub)，留空则自动获取
 }
 
 // TextOutHttpConfig 文本输出发送给 http 服务器
@@ -54,14 +71,44 @@ type Live2dConfig struct {
 type ChatbotConfig struct {
 	Musharing MusharingChatbotConfig // chatterbot 配置
 	Chatgpt   ChatgptChatbotConfig
+	OpenAI    OpenAIChatbotConfig // 直接调用 OpenAI 兼容的 HTTP API (/v1/chat/completions)
+	Rules     RulesChatbotConfig  // 本地的规则 chatbot：所有 chatbot 都失败时兜底
+
+	HedgeDelay    int      // 高优先级的 chatbot 这么多秒还没回复，就同时问低一级的，谁先回复用谁的。0 则不启用，失败或超时了才问下一级
+	CannedReplies []string // 所有 chatbot 都失败时，轮流用这些话兜底。为空则不回复
+
+	HealthCheckInterval int // 每隔多少秒检查一次断路 (连续失败) 的 chatbot 服务是否恢复。0 则不检查，只等断路器退避时间到
+
+	Stream bool // 流式回复：chatbot 边生成边说，每凑够一句就交给 sayer，不等整个回复。超时 (Timeout) 变为等第一句的时间，且不再 hedge
+
+	Workers int    // 同时处理几条消息。0 或 1 则一条一条来。不宜超过 chatbot 的会话池大小 (10)。Stream 时一条回复说完才轮到下一条
+	Order   string // Workers > 1 时回复的输出顺序: arrival (默认，按消息到达的顺序) | priority (高优先级的回复不用等前面低优先级的)
+	MaxAge  int    // 消息收到超过这么多秒还没回复，就不回了 (没人记得问过什么了)。0 则不限
+}
+
+func (c ChatbotConfig) GetHedgeDelay() time.Duration {
+	return time.Duration(c.HedgeDelay) * time.Second
+}
+
+func (c ChatbotConfig) GetHealthCheckInterval() time.Duration {
+	return time.Duration(c.HealthCheckInterval) * time.Second
+}
+
+func (c ChatbotConfig) GetMaxAge() time.Duration {
+	return time.Duration(c.MaxAge) * time.Second
 }
 
 // MusharingChatbotConfig chatterbot 配置
 type MusharingChatbotConfig struct {
 	Server   string // musharing chatbot api server (gRPC) address
+	Timeout  int    // 超时 (秒)，超时则交给更低一级的 chatbot。0 则不限
 	Disabled bool   // 是否禁用
 }
 
+func (c *MusharingChatbotConfig) GetTimeout() time.Duration {
+	return time.Duration(c.Timeout) * time.Second
+}
+
 // IsEnabled 检查是否启用 & 可用
 //
 // 返回值: 是否启用（true 则启用） & 是否可用 (err == nil 时可用)
@@ -79,10 +126,74 @@ func (c *MusharingChatbotConfig) IsEnabledAndValid() (enabled bool, err error) {
 
 // ChatgptChatbotConfig chatgpt 配置
 type ChatgptChatbotConfig struct {
-	Server   string                   // chatgpt api server (gRPC) address
-	Configs  []chatbot2.ChatGPTConfig // chatgpt configs in json: [{"version": 3, "api_key": "sk_xxx", "initial_prompt": "hello"}, ...]
-	Cooldown int                      // chatgpt cooldown time (seconds)
-	Disabled bool                     // 是否禁用
+	Server    string                   // chatgpt api server (gRPC) address
+	Configs   []chatbot2.ChatGPTConfig // chatgpt configs in json: [{"version": 3, "api_key": "sk_xxx", "initial_prompt": "hello"}, ...]
+	Cooldown  int                      // chatgpt cooldown time (seconds): 限流，平均每这么多秒调用一次。0 则不限
+	RateLimit RateLimitConfig          // 限流：突发和每日额度
+	Timeout   int                      // 超时 (秒)，超时则交给更低一级的 chatbot。0 则不限
+	Disabled  bool                     // 是否禁用
+	Memory    MemoryConfig             // 对话记忆：会话自己记得聊过的话，prompt 里只加称呼和关于观众的一行，不加对话记录
+	Cache     CacheConfig              // 回复缓存
+	Session   SessionConfig            // 会话的生命周期
+}
+
+func (c *ChatgptChatbotConfig) GetTimeout() time.Duration {
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// RateLimitConfig 限流 (令牌桶)：每 Cooldown 秒攒一次调用的机会，最多攒 Burst 次，
+// 空闲一阵之后可以连着回复几条；每天 (本地时间 0 点重置) 最多调用 DailyQuota 次，省 API 额度。
+type RateLimitConfig struct {
+	Burst      int // 最多攒几次。0 或 1 则每 Cooldown 秒只能调用一次 (冷却)
+	DailyQuota int // 每天最多调用几次。0 则不限
+}
+
+// SessionConfig 会话的生命周期：ChatGPT 的会话越聊上下文越长，直到后端报错。
+// 聊够次数或者存在够久的会话就删掉 (DeleteSession)，需要时再开新的。
+// 上下文超长报错的会话总是会被换掉。都为 0 则会话一直用到连续失败为止。
+type SessionConfig struct {
+	MaxChats int // 一个会话最多聊几次。0 则不限
+	MaxAge   int // 一个会话最多用多少秒。0 则不限
+}
+
+func (c SessionConfig) GetMaxAge() time.Duration {
+	return time.Duration(c.MaxAge) * time.Second
+}
+
+// MemoryConfig 对话记忆：记住直播间最近的对话和每个观众聊过的话，
+// 加到 prompt 里，并保存到文件，重启后还记得老观众。
+type MemoryConfig struct {
+	Enabled      bool   // 是否启用
+	File         string // 保存记忆的 JSON 文件，留空则不保存
+	SaveInterval int    // 保存间隔 (秒)
+	Budget       int    // prompt 的最大长度 (字符数)
+	RoomTurns    int    // 记住直播间最近几轮对话
+	AuthorTurns  int    // 每个观众记住几轮对话
+	MaxAuthors   int    // 最多记住多少个观众
+}
+
+func (c MemoryConfig) GetSaveInterval() time.Duration {
+	return time.Duration(c.SaveInterval) * time.Second
+}
+
+// CacheConfig 回复缓存：观众反复问的问题 ("你是谁"、"多大了") 直接用缓存的回复，
+// 不再每次都问 chatbot，省下冷却时间和额度。
+type CacheConfig struct {
+	Enabled      bool    // 是否启用
+	TTL          int     // 回复缓存多少秒后过期
+	MaxSize      int     // 最多缓存多少个问题
+	Variety      int     // 每个问题缓存几个不同的回复，轮流使用
+	Similarity   float64 // 模糊匹配：和缓存的问题相似度 (0~1) 达到这个值就算命中。0 则只匹配 (忽略标点空格大小写后) 相同的问题
+	File         string  // 保存缓存的 JSON 文件，留空则不保存
+	SaveInterval int     // 保存间隔 (秒)
+}
+
+func (c CacheConfig) GetTTL() time.Duration {
+	return time.Duration(c.TTL) * time.Second
+}
+
+func (c CacheConfig) GetSaveInterval() time.Duration {
+	return time.Duration(c.SaveInterval) * time.Second
 }
 
 func (c *ChatgptChatbotConfig) IsEnabledAndValid() (enabled bool, err error) {
@@ -104,6 +215,61 @@ func (c *ChatgptChatbotConfig) GetCooldownDuraton() time.Duration {
 	return time.Duration(c.Cooldown) * time.Second
 }
 
+// OpenAIChatbotConfig 直接调用 OpenAI 兼容的 chat completions API，
+// 不需要 chatgpt_chatbot 服务。也可以用于 llama.cpp、Ollama 等本地服务。
+type OpenAIChatbotConfig struct {
+	chatbot2.OpenAIConfig `yaml:",inline"` // baseurl, model, apikey, systemprompt, temperature, maxtokens
+
+	Cooldown  int             // 冷却时间 (秒)：限流，平均每这么多秒调用一次。0 则不限
+	RateLimit RateLimitConfig // 限流：突发和每日额度
+	Timeout   int             // 超时 (秒)，超时则交给更低一级的 chatbot。0 则不限
+	Disabled  bool            // 是否禁用
+	Memory    MemoryConfig    // 对话记忆
+	Cache     CacheConfig     // 回复缓存
+}
+
+func (c *OpenAIChatbotConfig) GetTimeout() time.Duration {
+	return time.Duration(c.Timeout) * time.Second
+}
+
+func (c *OpenAIChatbotConfig) GetCooldownDuraton() time.Duration {
+	return time.Duration(c.Cooldown) * time.Second
+}
+
+func (c *OpenAIChatbotConfig) IsEnabledAndValid() (enabled bool, err error) {
+	if c.Disabled {
+		enabled = false
+		return enabled, nil
+	}
+	enabled = true
+	if c.BaseURL == "" {
+		err = errors.New("openai chatbot base url is empty")
+	}
+	if c.Model == "" {
+		err = errors.New("openai chatbot model is empty")
+	}
+	return enabled, err
+}
+
+// RulesChatbotConfig 本地的规则 chatbot：按 YAML 规则文件里的关键词、正则、时间段回复。
+// 不需要网络，在所有 chatbot 都失败时 (不论消息的优先级) 兜底，然后才轮到 CannedReplies。
+type RulesChatbotConfig struct {
+	File     string // YAML 规则文件，格式见 chatbot.RuleChatbot
+	Disabled bool   // 是否禁用
+}
+
+func (c *RulesChatbotConfig) IsEnabledAndValid() (enabled bool, err error) {
+	if c.Disabled {
+		enabled = false
+		return enabled, nil
+	}
+	enabled = true
+	if c.File == "" {
+		err = errors.New("rules chatbot file is empty")
+	}
+	return enabled, err
+}
+
 // SayerConfig 文本语音合成配置
 type SayerConfig struct {
 	Server          string // sayer gRPC server address
@@ -130,6 +296,8 @@ func (c SayerConfig) GetLipsyncStrategy() sayer.LipsyncStrategy {
 type ListenConfig struct {
 	TextInHttp        string // textIn http server address: 从 http 接收文本输入
 	AudioControllerWs string // audio controller ws server address: audioview 通过 websocket 与这个程序通信
+	Admin             string // admin http server address (e.g. 127.0.0.1:51082): 运行时管理 (例如切换人设)。留空则不开启，开启时请设置 AdminToken
+	AdminToken        string // admin 接口的 token (Authorization: Bearer AdminToken)。留空则不校验
 }
 
 // TooLongConfig 文本太长了，弃之，随机抱怨
@@ -138,6 +306,92 @@ type TooLongConfig struct {
 	Quibbles []string // 文本太长了，随机回复的话
 }
 
+// FiltersConfig 过滤器链配置
+type FiltersConfig struct {
+	In  []FilterConfig // TextIn 过滤器链 (按顺序): dm -> In -> chatbot
+	Out []FilterConfig // TextOut 过滤器链 (按顺序): chatbot -> Out -> say
+}
+
+// FilterConfig 过滤器链中的一个过滤器
+type FilterConfig struct {
+	Name     string         // 过滤器名称: chinese, priority_reduce, too_long, read_dm, ...
+	Options  map[string]any `yaml:",omitempty"` // 过滤器选项，例如 priority_reduce 的 {duration: 5s}
+	Disabled bool           `yaml:",omitempty"` // 是否禁用
+}
+
+// DesensitizedOptions returns a copy of the Options with the values of
+// the "api_key"s (at any depth) ellipsized, for logging.
+func (f FilterConfig) DesensitizedOptions() map[string]any {
+	if f.Options == nil {
+		return nil
+	}
+	return desensitize(f.Options).(map[string]any)
+}
+
+func desensitize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			if s, ok := value.(string); ok && key == "api_key" {
+				m[key] = ellipsis.Centering(s, 9)
+			} else {
+				m[key] = desensitize(value)
+			}
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, value := range v {
+			l[i] = desensitize(value)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// QueueConfig 有界优先队列：In 过滤器链的输出进入队列，
+// chatbot 准备好了才从队列中取出下一条消息。
+//
+// 等待越久的消息优先级越高，超过 TTL 的消息被丢弃，但 SC 在回复之前不会被丢弃。
+// 启用时，Filters.In 中一般不再需要 priority_reduce。
+type QueueConfig struct {
+	Enabled       bool // 是否启用 (默认不启用：In 过滤器链直接推送给 chatbot)
+	Capacity      int  // 队列容量 (不含 SC)
+	AgingInterval int  // 每等待 AgingInterval 秒，优先级 +1。0 则不提升
+	TTL           int  // 消息最多等待 TTL 秒。0 则永不过期
+}
+
+func (c QueueConfig) GetAgingInterval() time.Duration {
+	return time.Duration(c.AgingInterval) * time.Second
+}
+
+func (c QueueConfig) GetTTL() time.Duration {
+	return time.Duration(c.TTL) * time.Second
+}
+
+// TranscriptConfig 对话记录：把每条消息经过了哪些过滤器、哪个 chatbot 回复了什么、
+// 耗时多久、最后有没有说出来，按行写到 JSONL 文件里。
+// 用 `muvtuberdriver export -dir ...` 导出为 prompt/response 对，用于微调。
+type TranscriptConfig struct {
+	Enabled bool   // 是否启用
+	Dir     string // 记录文件的目录：每天一个文件 transcript-2006-01-02.jsonl
+	MaxSize int    // 单个文件最大多少 MB，超过了就换新文件 (transcript-2006-01-02.1.jsonl)。0 则不限
+}
+
+func (c TranscriptConfig) GetMaxSizeBytes() int64 {
+	return int64(c.MaxSize) << 20
+}
+
+// PersonaConfig 人设：从目录加载若干人设 (prompt、TTS 角色、live2d 表情、太长了的抱怨)，
+// 通过 admin 接口切换，不用重启。切换时 chatbot 会用新的 prompt 重新创建会话。
+type PersonaConfig struct {
+	Enabled bool   // 是否启用
+	Dir     string // 人设目录：每个 *.yaml 文件一个人设，见 persona 包
+	Default string // 启动时使用的人设。留空则不切换 (使用 chatbot 和 sayer 中的配置)
+}
+
 func (c *config) Read(src io.Reader) error {
 	return yaml.NewDecoder(src).Decode(&c)
 }
@@ -170,6 +424,15 @@ func (c *config) DesensitizedCopy() *config {
 		apiKey := &((*chatgptConfigs)[i].ApiKey) // another shorthand
 		*apiKey = ellipsis.Centering(*apiKey, 9)
 	}
+	cCopy.Chatbot.OpenAI.ApiKey = ellipsis.Centering(cCopy.Chatbot.OpenAI.ApiKey, 9)
+	cCopy.Listen.AdminToken = ellipsis.Centering(cCopy.Listen.AdminToken, 9)
+
+	// api_key in the filter options (e.g. the http moderator)
+	for _, chain := range [][]FilterConfig{cCopy.Filters.In, cCopy.Filters.Out} {
+		for i := range chain {
+			chain[i].Options = chain[i].DesensitizedOptions()
+		}
+	}
 
 	return &cCopy
 }
@@ -205,6 +468,12 @@ func (c *config) Check() error {
 
 	c.Sayer.GetLipsyncStrategy() // check lipsync strategy: failed => panic
 
+	switch c.Blivedm.Protocol {
+	case "", "blivechat", "bilibili":
+	default:
+		panic(errors.New("unknown blivedm protocol: " + c.Blivedm.Protocol))
+	}
+
 	return nil
 }
 
@@ -215,6 +484,41 @@ func (c *config) GetReduceDuration() time.Duration {
 	return time.Duration(c.ReduceDuration) * time.Second
 }
 
+// GetFilters returns the Filters config.
+//
+// For backward compatibility, if Filters is empty, the filter chains
+// are built from the legacy options (ReadDm, ReduceDuration, TooLong):
+//
+//	in:  priority_reduce -> read_dm (if ReadDm)
+//	out: too_long -> priority_reduce
+func (c *config) GetFilters() FiltersConfig {
+	if len(c.Filters.In) > 0 || len(c.Filters.Out) > 0 {
+		return c.Filters
+	}
+
+	reduce := FilterConfig{
+		Name:    "priority_reduce",
+		Options: map[string]any{"duration": c.GetReduceDuration().String()},
+	}
+
+	return FiltersConfig{
+		In: []FilterConfig{
+			reduce,
+			{Name: "read_dm", Disabled: !c.ReadDm},
+		},
+		Out: []FilterConfig{
+			{
+				Name: "too_long",
+				Options: map[string]any{
+					"max_words": c.TooLong.MaxWords,
+					"quibbles":  c.TooLong.Quibbles,
+				},
+			},
+			reduce,
+		},
+	}
+}
+
 var configInstance = config{}
 
 func UseConfig() *config {
@@ -225,8 +529,17 @@ func UseConfig() *config {
 func ExampleConfig() config {
 	c := config{
 		Blivedm: BlivedmConfig{
-			Server: "ws://blivechat:12450/api/chat",
-			Roomid: 26949229,
+			Protocol: "blivechat",
+			Server:   "ws://blivechat:12450/api/chat",
+			Roomid:   26949229,
+			Bilibili: BilibiliDmConfig{
+				RoomID: 26949229,
+				Server: "",
+			},
+
+			GiftTemplate:   "我送给你{num}个{gift}。",
+			GiftMinCoin:    1000,
+			MemberTemplate: "我开通了{guard}。",
 		},
 		TextOutHttp: TextOutHttpConfig{
 			Server:   "",
@@ -238,7 +551,8 @@ func ExampleConfig() config {
 		},
 		Chatbot: ChatbotConfig{
 			Musharing: MusharingChatbotConfig{
-				Server: "musharing_chatbot:50051",
+				Server:  "musharing_chatbot:50051",
+				Timeout: 10,
 			},
 			Chatgpt: ChatgptChatbotConfig{
 				Server: "chatgpt_chatbot:50052",
@@ -250,7 +564,82 @@ func ExampleConfig() config {
 					},
 				},
 				Cooldown: 15,
+				RateLimit: RateLimitConfig{
+					Burst:      3,
+					DailyQuota: 0,
+				},
+				Timeout: 20,
+				Memory: MemoryConfig{
+					Enabled:      false,
+					File:         "/app/data/memory.json",
+					SaveInterval: 60,
+					Budget:       600,
+					RoomTurns:    10,
+					AuthorTurns:  5,
+					MaxAuthors:   1000,
+				},
+				Cache: CacheConfig{
+					Enabled:      false,
+					TTL:          86400,
+					MaxSize:      1000,
+					Variety:      3,
+					Similarity:   0.8,
+					File:         "/app/data/cache.json",
+					SaveInterval: 60,
+				},
+				Session: SessionConfig{
+					MaxChats: 50,
+					MaxAge:   7200,
+				},
+			},
+			OpenAI: OpenAIChatbotConfig{
+				OpenAIConfig: chatbot2.OpenAIConfig{
+					BaseURL:      "http://ollama:11434/v1",
+					Model:        "qwen:7b",
+					SystemPrompt: "你是 muli，一个正在直播的 AI VTuber。回答要简短、口语化。",
+					Temperature:  0.8,
+					MaxTokens:    200,
+				},
+				Cooldown: 0,
+				RateLimit: RateLimitConfig{
+					Burst:      1,
+					DailyQuota: 0,
+				},
+				Timeout:  20,
+				Disabled: true,
+				Memory: MemoryConfig{
+					Enabled:      false,
+					File:         "/app/data/memory-openai.json",
+					SaveInterval: 60,
+					Budget:       600,
+					RoomTurns:    10,
+					AuthorTurns:  5,
+					MaxAuthors:   1000,
+				},
+				Cache: CacheConfig{
+					Enabled:      false,
+					TTL:          86400,
+					MaxSize:      1000,
+					Variety:      3,
+					Similarity:   0.8,
+					File:         "/app/data/cache-openai.json",
+					SaveInterval: 60,
+				},
+			},
+			Rules: RulesChatbotConfig{
+				File:     "/app/config/rules.yaml",
+				Disabled: true,
 			},
+			HedgeDelay:    8,
+			CannedReplies: []string{"让我想想。", "这个问题好难，下次再说吧。"},
+
+			HealthCheckInterval: 10,
+
+			Stream: false,
+
+			Workers: 4,
+			Order:   "arrival",
+			MaxAge:  60,
 		},
 		Sayer: SayerConfig{
 			Server:          "externalsayer:50010",
@@ -260,16 +649,121 @@ func ExampleConfig() config {
 		Listen: ListenConfig{
 			TextInHttp:        "0.0.0.0:51080",
 			AudioControllerWs: "0.0.0.0:51081",
+			Admin:             "",
+			AdminToken:        "",
 		},
-		ReadDm:         true,
-		ReduceDuration: 5,
-		TooLong: TooLongConfig{
-			MaxWords: 500,
-			Quibbles: []string{
-				"太长了，不想说。",
-				"禁則事項です。",
-				"爬。",
+		Filters: FiltersConfig{
+			In: []FilterConfig{
+				{
+					Name: "command",
+					Options: map[string]any{
+						"prefixes": []string{"!", "！"},
+						"commands": map[string]any{
+							"motion": map[string]any{
+								"args":            map[string]string{"wave": "flick_head", "nod": "tap_body"},
+								"author_cooldown": "30s",
+							},
+							"ask": map[string]any{
+								"args":            map[string]string{"boost": "1"},
+								"permission":      "medal",
+								"min_medal_level": 5,
+								"cooldown":        "10s",
+							},
+						},
+					},
+					Disabled: true,
+				},
+				{Name: "chinese", Disabled: true},
+				{
+					Name: "blocklist",
+					Options: map[string]any{
+						"lists":  map[string]string{"insult": "/app/config/blocklist/insult.txt"},
+						"action": "drop",
+					},
+					Disabled: true,
+				},
+				{
+					Name: "spam",
+					Options: map[string]any{
+						"window":               "30s",
+						"similarity_threshold": 0.8,
+						"max_per_author":       5,
+					},
+					Disabled: true,
+				},
+				{
+					Name: "author",
+					Options: map[string]any{
+						"cooldown":      "30s",
+						"blocklist":     []string{},
+						"regulars":      []string{},
+						"regular_boost": 1,
+					},
+					Disabled: true,
+				},
+				{Name: "priority_reduce", Options: map[string]any{"duration": "5s", "strategy": "longest", "count": 1}},
+				{Name: "read_dm"},
 			},
+			Out: []FilterConfig{
+				{
+					// before too_long: the chunks split can not be regenerated
+					Name: "moderation",
+					Options: map[string]any{
+						"moderators": []map[string]any{
+							{"type": "wordlist", "lists": map[string]string{"insult": "/app/config/blocklist/insult.txt"}},
+							{"type": "http", "url": "https://api.openai.com/v1/moderations", "api_key": "sk-xxx"},
+						},
+						"action":         "regenerate",
+						"categories":     map[string]string{"insult": "fallback"},
+						"fallbacks":      []string{"这个话题我们换一个吧。", "嗯……我想想别的。"},
+						"max_regenerate": 2,
+						"on_error":       "allow",
+						"timeout":        "5s",
+					},
+					Disabled: true,
+				},
+				{
+					Name: "too_long",
+					Options: map[string]any{
+						"mode":       "drop",
+						"max_chunks": 3,
+						"cutoff":     "后面的就不念了。",
+						"max_words":  500,
+						"quibbles": []string{
+							"太长了，不想说。",
+							"禁則事項です。",
+							"爬。",
+						},
+					},
+				},
+				{
+					Name: "blocklist",
+					Options: map[string]any{
+						"lists":       map[string]string{"insult": "/app/config/blocklist/insult.txt"},
+						"regexps":     []string{`\d{11}`},
+						"action":      "replace",
+						"replacement": "这个不能说。",
+					},
+					Disabled: true,
+				},
+				{Name: "priority_reduce", Options: map[string]any{"duration": "5s"}},
+			},
+		},
+		Queue: QueueConfig{
+			Enabled:       false,
+			Capacity:      64,
+			AgingInterval: 10,
+			TTL:           60,
+		},
+		Transcript: TranscriptConfig{
+			Enabled: false,
+			Dir:     "/app/data/transcript",
+			MaxSize: 100,
+		},
+		Persona: PersonaConfig{
+			Enabled: false,
+			Dir:     "/app/config/personas",
+			Default: "",
 		},
 	}
 
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"muvtuberdriver/model"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -93,6 +95,43 @@ type superChatMessageData struct {
 	Translation string `json:"translation"`
 }
 
+// giftMessageData is the data of a gift message (blivedmCmdAddGift).
+//
+// The "data" field of the message is map[string]any.
+type giftMessageData struct {
+	Id         string `json:"id"`
+	AvatarUrl  string `json:"avatarUrl"`
+	Timestamp  int64  `json:"timestamp"`
+	AuthorName string `json:"authorName"`
+	TotalCoin  int64  `json:"totalCoin"` // 金瓜子: 1000 = 1 CNY
+	GiftName   string `json:"giftName"`
+	Num        int64  `json:"num"`
+}
+
+// memberMessageData is the data of a member message (blivedmCmdAddMember),
+// that is, someone bought a guard (上舰).
+//
+// The "data" field of the message is map[string]any.
+type memberMessageData struct {
+	Id            string `json:"id"`
+	AvatarUrl     string `json:"avatarUrl"`
+	Timestamp     int64  `json:"timestamp"`
+	AuthorName    string `json:"authorName"`
+	PrivilegeType int64  `json:"privilegeType"` // 1: 总督, 2: 提督, 3: 舰长
+}
+
+// delSuperChatMessageData is the data of a blivedmCmdDelSuperChat message.
+type delSuperChatMessageData struct {
+	Ids []string `json:"ids"`
+}
+
+// guardNames: PrivilegeType -> name
+var guardNames = map[int64]string{
+	1: "总督",
+	2: "提督",
+	3: "舰长",
+}
+
 // heartbeating
 const (
 	blivedmHeartbeatMessage  = `{"cmd":0,"data":{}}`
@@ -106,6 +145,17 @@ var (
 	RecvMsgChanBuf  = 100
 )
 
+// Default templates for the events (gift, member) that are turned into TextIn.
+//
+// Available placeholders:
+//
+//	gift:   {author} {gift} {num} {coin}
+//	member: {author} {guard}
+var (
+	DefaultGiftTemplate   = "我送给你{num}个{gift}。"
+	DefaultMemberTemplate = "我开通了{guard}。"
+)
+
 // blivedmJoinRoomMessage builds a JOIN_ROOM message for blivedm server.
 func blivedmJoinRoomMessage(roomid int) string {
 	msg := blivedmMessage{
@@ -158,14 +208,7 @@ LOOP:
 // newBlivedmClient creates a new websocket connection to blivedm server,
 // joins the room and returns a channel for receiving messages.
 func newBlivedmClient(roomid int, opts ...BlivedmClientOption) (recvMsgCh <-chan string, err error) {
-	o := blivedmClientOptions{
-		BlivedmServer:   BlivedmServer,
-		BlivedmWsOrigin: BlivedmWsOrigin,
-		RecvMsgChanBuf:  RecvMsgChanBuf,
-	}
-	for _, opt := range opts {
-		opt(&o)
-	}
+	o := newBlivedmClientOptions(opts...)
 
 	ws, err := websocket.Dial(o.BlivedmServer, "", o.BlivedmWsOrigin)
 	if err != nil {
@@ -187,10 +230,32 @@ type blivedmClientOptions struct {
 	BlivedmServer   string
 	BlivedmWsOrigin string
 	RecvMsgChanBuf  int
+
+	// ⬇️ events -> TextIn
+
+	BilibiliServer string // for TextInFromBilibili: "" to discover by the api
+
+	GiftTemplate   string // "" to ignore gifts
+	GiftMinCoin    int64  // gifts with TotalCoin < GiftMinCoin are ignored
+	MemberTemplate string // "" to ignore members
 }
 
 type BlivedmClientOption func(*blivedmClientOptions)
 
+func newBlivedmClientOptions(opts ...BlivedmClientOption) blivedmClientOptions {
+	o := blivedmClientOptions{
+		BlivedmServer:   BlivedmServer,
+		BlivedmWsOrigin: BlivedmWsOrigin,
+		RecvMsgChanBuf:  RecvMsgChanBuf,
+		GiftTemplate:    DefaultGiftTemplate,
+		MemberTemplate:  DefaultMemberTemplate,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 func WithBlivedmServer(s string) BlivedmClientOption {
 	return func(o *blivedmClientOptions) {
 		o.BlivedmServer = s
@@ -209,6 +274,37 @@ func WithRecvMsgChanBuf(n int) BlivedmClientOption {
 	}
 }
 
+// WithBilibiliServer sets the bilibili danmaku server (websocket url) for
+// TextInFromBilibili. Empty string "" to discover the server by the api.
+func WithBilibiliServer(s string) BlivedmClientOption {
+	return func(o *blivedmClientOptions) {
+		o.BilibiliServer = s
+	}
+}
+
+// WithGiftTemplate sets the template to build the TextIn from a gift.
+// Empty template "" disables the gift events.
+func WithGiftTemplate(tmpl string) BlivedmClientOption {
+	return func(o *blivedmClientOptions) {
+		o.GiftTemplate = tmpl
+	}
+}
+
+// WithGiftMinCoin ignores the gifts that are cheaper than minCoin (金瓜子).
+func WithGiftMinCoin(minCoin int64) BlivedmClientOption {
+	return func(o *blivedmClientOptions) {
+		o.GiftMinCoin = minCoin
+	}
+}
+
+// WithMemberTemplate sets the template to build the TextIn from a new member (guard).
+// Empty template "" disables the member events.
+func WithMemberTemplate(tmpl string) BlivedmClientOption {
+	return func(o *blivedmClientOptions) {
+		o.MemberTemplate = tmpl
+	}
+}
+
 // deprecated
 //
 // blivedmMessageHandler handles a message from blivedm server.
@@ -225,11 +321,11 @@ func blivedmMessageHandler(msg string) error {
 	case blivedmCmdAddText, blivedmCmdAddSuperChat:
 		textMessageHandler(&message)
 	case blivedmCmdAddGift:
-		// TODO
+		// see TextInFromDm & giftMessageHandler
 	case blivedmCmdAddMember:
-		// TODO
+		// see TextInFromDm & memberMessageHandler
 	case blivedmCmdDelSuperChat:
-		// TODO
+		// see TextInFromDm & delSuperChatMessageHandler
 	case blivedmCmdUpdateTranslation:
 		// TODO: what the fuck is this?
 	}
@@ -259,13 +355,21 @@ func textMessageHandler(message *blivedmMessage) (*model.TextIn, error) {
 
 	// fmt.Println(tmd)
 
-	textIn := &model.TextIn{
-		Author:   tmd.AuthorName,
-		Content:  tmd.Content,
-		Priority: model.PriorityLow,
+	return textMessageToTextIn(tmd), nil
+}
+
+// textMessageToTextIn builds a TextIn from a text message (danmaku).
+func textMessageToTextIn(tmd *textMessageData) *model.TextIn {
+	textIn := model.NewTextIn(model.SourceDm, tmd.AuthorName, tmd.Content, model.PriorityLow)
+
+	textIn.AuthorLevel = int(tmd.AuthorLevel)
+	textIn.SetMeta(model.MetaMedalLevel, int(tmd.MedalLevel))
+	textIn.SetMeta(model.MetaAuthorType, int(tmd.AuthorType))
+	if tmd.Id != "" {
+		textIn.SetMeta(model.MetaPlatformID, tmd.Id)
 	}
 
-	return textIn, nil
+	return textIn
 }
 
 func superChatMessageHandler(message *blivedmMessage) (*model.TextIn, error) {
@@ -278,18 +382,231 @@ func superChatMessageHandler(message *blivedmMessage) (*model.TextIn, error) {
 		return nil, err
 	}
 
-	textIn := &model.TextIn{
-		Author:   sc.AuthorName,
-		Content:  sc.Content,
-		Priority: model.Priority(sc.Price / 10),
+	return superChatToTextIn(&sc), nil
+}
+
+// superChatToTextIn builds a TextIn from a super chat,
+// and remembers it in superChats to handle the deletion.
+func superChatToTextIn(sc *superChatMessageData) *model.TextIn {
+	textIn := model.NewTextIn(model.SourceSuperChat,
+		sc.AuthorName, sc.Content, model.Priority(sc.Price/10))
+	textIn.SetMeta(model.MetaSuperChatID, sc.Id)
+	textIn.SetMeta(model.MetaPlatformID, sc.Id)
+
+	superChats.Add(sc.Id, textIn)
+
+	return textIn
+}
+
+var ErrEventIgnored = errors.New("event ignored")
+
+// giftMessageHandler builds a TextIn from a gift message with the template.
+// See giftToTextIn.
+func giftMessageHandler(message *blivedmMessage, tmpl string, minCoin int64) (*model.TextIn, error) {
+	data, ok := message.Data.(map[string]any)
+	if !ok {
+		return nil, errors.New("data is not an map")
+	}
+	var gift giftMessageData
+	if err := mapstructure.Decode(data, &gift); err != nil {
+		return nil, err
+	}
+
+	return giftToTextIn(&gift, tmpl, minCoin)
+}
+
+// giftToTextIn builds a TextIn from a gift with the template.
+//
+// The priority is derived from the value of the gift, in the same way as
+// the super chat (1 priority per 10 CNY).
+//
+// Returns ErrEventIgnored if the template is empty or the gift is too cheap.
+func giftToTextIn(gift *giftMessageData, tmpl string, minCoin int64) (*model.TextIn, error) {
+	if tmpl == "" || gift.TotalCoin < minCoin {
+		return nil, ErrEventIgnored
+	}
+
+	content := renderDmTemplate(tmpl,
+		"{author}", gift.AuthorName,
+		"{gift}", gift.GiftName,
+		"{num}", fmt.Sprint(gift.Num),
+		"{coin}", fmt.Sprint(gift.TotalCoin))
+
+	textIn := model.NewTextIn(model.SourceGift,
+		gift.AuthorName, content, model.Priority(gift.TotalCoin/1000/10))
+	textIn.SetMeta(model.MetaGiftName, gift.GiftName)
+	textIn.SetMeta(model.MetaGiftCoin, gift.TotalCoin)
+	if gift.Id != "" {
+		textIn.SetMeta(model.MetaPlatformID, gift.Id)
+	}
+
+	return textIn, nil
+}
+
+// memberMessageHandler builds a TextIn from a member (guard) message with the template.
+// See memberToTextIn.
+func memberMessageHandler(message *blivedmMessage, tmpl string) (*model.TextIn, error) {
+	data, ok := message.Data.(map[string]any)
+	if !ok {
+		return nil, errors.New("data is not an map")
+	}
+	var member memberMessageData
+	if err := mapstructure.Decode(data, &member); err != nil {
+		return nil, err
+	}
+
+	return memberToTextIn(&member, tmpl)
+}
+
+// memberToTextIn builds a TextIn from a new member (guard) with the template.
+// New guards are always PriorityHighest.
+//
+// Returns ErrEventIgnored if the template is empty.
+func memberToTextIn(member *memberMessageData, tmpl string) (*model.TextIn, error) {
+	if tmpl == "" {
+		return nil, ErrEventIgnored
+	}
+
+	guard, ok := guardNames[member.PrivilegeType]
+	if !ok {
+		guard = "舰长"
+	}
+
+	content := renderDmTemplate(tmpl,
+		"{author}", member.AuthorName,
+		"{guard}", guard)
+
+	textIn := model.NewTextIn(model.SourceMember,
+		member.AuthorName, content, model.PriorityHighest)
+	textIn.SetMeta(model.MetaGuardLevel, int(member.PrivilegeType))
+	if member.Id != "" {
+		textIn.SetMeta(model.MetaPlatformID, member.Id)
 	}
 
 	return textIn, nil
 }
 
+// delSuperChatMessageHandler revokes the deleted super chats.
+// Returns the number of super chats that are found and revoked.
+func delSuperChatMessageHandler(message *blivedmMessage) (int, error) {
+	data, ok := message.Data.(map[string]any)
+	if !ok {
+		return 0, errors.New("data is not an map")
+	}
+	var del delSuperChatMessageData
+	if err := mapstructure.Decode(data, &del); err != nil {
+		return 0, err
+	}
+
+	return superChats.Delete(del.Ids...), nil
+}
+
+// renderDmTemplate replaces the placeholders in tmpl with the values:
+//
+//	renderDmTemplate("{author} 送了 {gift}", "{author}", "foo", "{gift}", "bar")
+func renderDmTemplate(tmpl string, oldnew ...string) string {
+	return strings.NewReplacer(oldnew...).Replace(tmpl)
+}
+
+// superChatRegistryTTL is how long a super chat is remembered by superChatRegistry.
+const superChatRegistryTTL = 10 * time.Minute
+
+// superChatRegistry remembers the super chats sent to the pipeline,
+// so that they can be revoked when blivedm sends a blivedmCmdDelSuperChat
+// (e.g. the super chat is rejected by bilibili).
+//
+// Stale records (older than superChatRegistryTTL) are cleaned lazily.
+type superChatRegistry struct {
+	mu       sync.Mutex
+	received map[string]*model.TextIn   // id -> textIn
+	deleted  map[*model.TextIn]struct{} // revoked ones
+	addedAt  map[string]time.Time       // id -> time added
+}
+
+func newSuperChatRegistry() *superChatRegistry {
+	return &superChatRegistry{
+		received: map[string]*model.TextIn{},
+		deleted:  map[*model.TextIn]struct{}{},
+		addedAt:  map[string]time.Time{},
+	}
+}
+
+// superChats is the registry for all the super chats received from blivedm.
+var superChats = newSuperChatRegistry()
+
+// Add remembers a super chat.
+func (r *superChatRegistry) Add(id string, textIn *model.TextIn) {
+	if id == "" || textIn == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clean()
+
+	r.received[id] = textIn
+	r.addedAt[id] = time.Now()
+}
+
+// Delete marks the super chats of ids as deleted.
+// Returns the number of super chats found.
+func (r *superChatRegistry) Delete(ids ...string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, id := range ids {
+		if t, ok := r.received[id]; ok {
+			r.deleted[t] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+// IsDeleted reports whether the textIn is a deleted super chat.
+func (r *superChatRegistry) IsDeleted(textIn *model.TextIn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.deleted[textIn]
+	return ok
+}
+
+// clean forgets the stale super chats. The caller should hold the lock.
+func (r *superChatRegistry) clean() {
+	for id, at := range r.addedAt {
+		if time.Since(at) < superChatRegistryTTL {
+			continue
+		}
+		delete(r.deleted, r.received[id])
+		delete(r.received, id)
+		delete(r.addedAt, id)
+	}
+}
+
+// IsSuperChatDeleted reports whether the textIn is a super chat
+// that has been deleted by blivedm (blivedmCmdDelSuperChat).
+func IsSuperChatDeleted(textIn *model.TextIn) bool {
+	return superChats.IsDeleted(textIn)
+}
+
+// DeletedSuperChatFilter drops the super chats that have been deleted.
+var DeletedSuperChatFilter TextInFilter = TextInFilterFunc(func(textIn *model.TextIn) bool {
+	if IsSuperChatDeleted(textIn) {
+		slog.Info("[dm] DeletedSuperChatFilter: drop deleted super chat.",
+			"author", textIn.Author, "content", textIn.Content)
+		return false
+	}
+	return true
+})
+
 // TextInFromDm 从 roomid 的直播间接收弹幕消息，发送到 textIn。
 // Blocks forever.
 func TextInFromDm(roomid int, textIn chan<- *model.TextIn, opts ...BlivedmClientOption) (err error) {
+	o := newBlivedmClientOptions(opts...)
+
 	retryAt, retryInterval := time.Now(), time.Second
 	for {
 		slog.Info("[dm] TextInFromDm: create newBlivedmClient to room.", "roomid", roomid)
@@ -325,6 +642,37 @@ func TextInFromDm(roomid int, textIn chan<- *model.TextIn, opts ...BlivedmClient
 				slog.Info("[dm] TextInFromDm [SC]",
 					"author", t.Author, "priority", t.Priority, "content", t.Content)
 				textIn <- t
+			case blivedmCmdAddGift:
+				t, err := giftMessageHandler(message, o.GiftTemplate, o.GiftMinCoin)
+				if errors.Is(err, ErrEventIgnored) {
+					continue
+				}
+				if err != nil {
+					slog.Error("[dm] giftMessageHandler error.", "msg", msg, "err", err)
+					continue
+				}
+				slog.Info("[dm] TextInFromDm [Gift]",
+					"author", t.Author, "priority", t.Priority, "content", t.Content)
+				textIn <- t
+			case blivedmCmdAddMember:
+				t, err := memberMessageHandler(message, o.MemberTemplate)
+				if errors.Is(err, ErrEventIgnored) {
+					continue
+				}
+				if err != nil {
+					slog.Error("[dm] memberMessageHandler error.", "msg", msg, "err", err)
+					continue
+				}
+				slog.Info("[dm] TextInFromDm [Member]",
+					"author", t.Author, "priority", t.Priority, "content", t.Content)
+				textIn <- t
+			case blivedmCmdDelSuperChat:
+				n, err := delSuperChatMessageHandler(message)
+				if err != nil {
+					slog.Error("[dm] delSuperChatMessageHandler error.", "msg", msg, "err", err)
+					continue
+				}
+				slog.Info("[dm] TextInFromDm [DelSC]", "msg", msg, "revoked", n)
 			}
 		}
 		// recvMsgCh 被 close 掉时会走下面的 RETRY
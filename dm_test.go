@@ -0,0 +1,72 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"testing"
+)
+
+func Test_giftMessageHandler(t *testing.T) {
+	message, err := unmarshalMessage(`{"cmd":3,"data":{"id":"1","avatarUrl":"","timestamp":1680000000,"authorName":"foo","totalCoin":52000,"giftName":"小电视飞船","num":2}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	textIn, err := giftMessageHandler(message, "{author} 送了 {num} 个 {gift}", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textIn.Content != "foo 送了 2 个 小电视飞船" {
+		t.Errorf("Content = %q", textIn.Content)
+	}
+	if textIn.Priority != model.Priority(5) {
+		t.Errorf("Priority = %v, want 5", textIn.Priority)
+	}
+
+	if _, err := giftMessageHandler(message, "{gift}", 100000); err != ErrEventIgnored {
+		t.Errorf("cheap gift: err = %v, want ErrEventIgnored", err)
+	}
+	if _, err := giftMessageHandler(message, "", 0); err != ErrEventIgnored {
+		t.Errorf("empty template: err = %v, want ErrEventIgnored", err)
+	}
+}
+
+func Test_memberMessageHandler(t *testing.T) {
+	message, err := unmarshalMessage(`{"cmd":4,"data":{"id":"2","avatarUrl":"","timestamp":1680000000,"authorName":"bar","privilegeType":2}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	textIn, err := memberMessageHandler(message, "{author} 开通了{guard}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textIn.Content != "bar 开通了提督" {
+		t.Errorf("Content = %q", textIn.Content)
+	}
+	if textIn.Priority != model.PriorityHighest {
+		t.Errorf("Priority = %v, want PriorityHighest", textIn.Priority)
+	}
+}
+
+func Test_delSuperChatMessageHandler(t *testing.T) {
+	add, _ := unmarshalMessage(`{"cmd":5,"data":{"id":"42","avatarUrl":"","timestamp":1680000000,"authorName":"baz","price":30,"content":"hello","translation":""}}`)
+	textIn, err := superChatMessageHandler(add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsSuperChatDeleted(textIn) {
+		t.Fatal("super chat deleted before del message")
+	}
+
+	del, _ := unmarshalMessage(`{"cmd":6,"data":{"ids":["42","not-exist"]}}`)
+	n, err := delSuperChatMessageHandler(del)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("revoked = %v, want 1", n)
+	}
+	if !IsSuperChatDeleted(textIn) {
+		t.Error("super chat not deleted after del message")
+	}
+}
@@ -25,10 +25,17 @@ type TextFilterFunc func(text string) bool
 // filterTextChan 是一个通用的过滤器，可以过滤 TextIn 或 TextOut 或者其他任意可以转化为字符串的东西。
 // key 用于从 chIn 传出的 T 中提取 string，交给 f 进行过滤。
 func filterTextChan[T any](chIn chan T, f TextFilterFunc, key func(T) string) (chOut chan T) {
+	return filterChan(chIn, func(in T) bool {
+		return f(key(in))
+	})
+}
+
+// filterChan 把 chIn 中 keep 返回 true 的元素发送到 chOut。
+func filterChan[T any](chIn chan T, keep func(T) bool) (chOut chan T) {
 	chOut = make(chan T, RecvMsgChanBuf)
 	go func() {
 		for in := range chIn {
-			if f(key(in)) {
+			if keep(in) {
 				chOut <- in
 			}
 		}
@@ -36,6 +43,20 @@ func filterTextChan[T any](chIn chan T, f TextFilterFunc, key func(T) string) (c
 	return chOut
 }
 
+// TextInFilterFunc 对完整的 TextIn 进行过滤，返回 true 表示保留，false 则滤掉。
+//
+// 与 TextFilterFunc 不同，它可以看到 Author、Priority 等字段。
+type TextInFilterFunc func(textIn *model.TextIn) bool
+
+func (f TextInFilterFunc) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	return filterChan(chIn, func(textIn *model.TextIn) bool {
+		if textIn == nil {
+			return false
+		}
+		return f(textIn)
+	})
+}
+
 func (f TextFilterFunc) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
 	return filterTextChan(chIn, f, func(textIn *model.TextIn) string {
 		if textIn == nil {
@@ -79,19 +100,29 @@ var ChineseFilter4TextOut TextOutFilter = TextFilterFunc(chineseFilter)
 
 // PriorityReduceFilter 每 duration 的时间，从收到的消息中选出一些作为输出。
 //
-// 选择的标准是 Priority 最高的。如果最高 Priority 有多条：
-// 1. 如果这些消息的 Priority 为 PriorityHighest 则输出所有这些消息；
-// 2. 否则，输出其中 Content 字数最多的一条；
+//  1. 如果只收到一条消息，提权到 PriorityHighest 并输出；
+//  2. 如果有 Priority 为 PriorityHighest 的消息，则输出所有这些消息；
+//  3. 否则，由 Strategy 从中选出至多 Count 条输出
+//     (默认 LongestStrategy: Priority 最高的里面 Content 字数最多的一条)。
+//     由 TooLongSplitFilter 切出来的段，同一个 TextOut 的会一起输出。
+//
+// 在选择之前，Discard 返回 true 的消息会被丢掉（例如被撤回的 SC）。
 type PriorityReduceFilter struct {
 	temp     []*model.TextIn
 	mu       sync.RWMutex
 	duration time.Duration
+
+	Discard  func(t *model.Text) bool // optional
+	Strategy ReduceStrategy           // optional: longest by default
+	Count    int                      // 每个窗口最多输出几条 (不含 PriorityHighest 的): 1 by default
 }
 
 func NewPriorityReduceFilter(duration time.Duration) *PriorityReduceFilter {
 	return &PriorityReduceFilter{
 		temp:     make([]*model.TextIn, 0, 10),
 		duration: duration,
+		Strategy: ReduceStrategyFunc(selectLongest),
+		Count:    1,
 	}
 }
 
@@ -115,6 +146,7 @@ func (f *PriorityReduceFilter) filter(chIn chan *model.Text) (chOut chan *model.
 				f.temp = append(f.temp, in)
 				f.mu.Unlock()
 			case <-timeout.C:
+				f.discardInTemp()
 				f.outputMaxPriorityOnes(chOut)
 
 				f.mu.Lock()
@@ -127,57 +159,48 @@ func (f *PriorityReduceFilter) filter(chIn chan *model.Text) (chOut chan *model.
 	return chOut
 }
 
-// selectOneInTemp 找出 temp 中最高的 Priority 。
-func (f *PriorityReduceFilter) maxPriorityInTemp() model.Priority {
-	var max model.Priority
+// discardInTemp 从 temp 中移除 Discard 返回 true 的消息。
+func (f *PriorityReduceFilter) discardInTemp() {
+	if f.Discard == nil {
+		return
+	}
 
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
+	kept := f.temp[:0]
 	for _, t := range f.temp {
-		if t == nil {
+		if t == nil || f.Discard(t) {
 			continue
 		}
-		if t.Priority >= max {
-			max = t.Priority
-		}
+		kept = append(kept, t)
 	}
-	return max
+	f.temp = kept
 }
 
-func (f *PriorityReduceFilter) maxContentLengthInTemp() (maxLen int, index int) {
-	var max, idx int
+// takeTemp 取出 temp 中所有非空的消息，并清空 temp。
+func (f *PriorityReduceFilter) takeTemp() []*model.Text {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-
-	for i, t := range f.temp {
-		if len(t.Content) > max {
-			max = len(t.Content)
-			idx = i
+	texts := make([]*model.Text, 0, len(f.temp))
+	for _, t := range f.temp {
+		if t != nil {
+			texts = append(texts, t)
 		}
 	}
-	return max, idx
+	f.temp = f.temp[:0]
+	return texts
 }
 
 func (f *PriorityReduceFilter) outputMaxPriorityOnes(chOut chan<- *model.Text) {
-	f.mu.RLock()
-	switch len(f.temp) {
+	texts := f.takeTemp()
+
+	switch len(texts) {
 	case 0:
-		f.mu.RUnlock()
 		return
 	case 1:
-		t := f.temp[0]
-		f.mu.RUnlock()
-
-		f.mu.Lock()
-		f.temp = f.temp[:0]
-		f.mu.Unlock()
-
-		if t == nil {
-			return
-		}
-
+		t := texts[0]
 		t.Priority = model.PriorityHighest // 消息少，提权，以求高质量 Chatbot 回复
 		slog.Info("[PriorityReduceFilter] outputMaxPriorityOne boost Priority -> Highest",
 			"author", t.Author,
@@ -185,84 +208,84 @@ func (f *PriorityReduceFilter) outputMaxPriorityOnes(chOut chan<- *model.Text) {
 			"priority", t.Priority)
 		chOut <- t
 		return
-	default:
-		f.mu.RUnlock()
 	}
 
-	maxPriority := f.maxPriorityInTemp()
-
-	choosen := make([]*model.Text, 1)
-
-	f.mu.RLock()
-	for _, t := range f.temp {
-		if t == nil {
-			continue
-		}
-		if t.Priority == maxPriority {
-			if t.Priority > model.PriorityHighest {
-				t.Priority = model.PriorityHighest // write
-			}
-			choosen = append(choosen, t)
+	highest := make([]*model.Text, 0)
+	others := make([]*model.Text, 0, len(texts))
+	for _, t := range texts {
+		if t.Priority >= model.PriorityHighest {
+			t.Priority = model.PriorityHighest
+			highest = append(highest, t)
+		} else {
+			others = append(others, t)
 		}
 	}
-	f.mu.RUnlock()
-
-	if maxPriority == model.PriorityHighest {
-		// 如果这些消息的 Priority >= PriorityHighest 则输出所有这些消息；
-		for _, t := range choosen {
-			if t == nil {
-				slog.Warn("[PriorityReduceFilter] outputMaxPriorityOne with PriorityHighest, but t is nil",
-					"wtf", "为什么会空啊，匪夷所思啊",
-					"action", "continue",
-					"choosen", choosen)
-				continue
-			}
+
+	if len(highest) > 0 {
+		// 如果有 Priority >= PriorityHighest 的消息，则输出所有这些消息；
+		for _, t := range highest {
 			slog.Info("[PriorityReduceFilter] outputMaxPriorityOne with PriorityHighest",
 				"author", t.Author, "content", ellipsis.Centering(t.Content, 17), "priority", t.Priority)
 			chOut <- t
 		}
-	} else {
-		// 否则，输出其中 Content 字数最多的一条；
-		maxLen, maxLenIdx := maxLenOfTextInSlice(choosen)
-		if maxLen <= 0 {
-			return
-		}
+		return
+	}
 
-		one := choosen[maxLenIdx]
-		if one == nil {
-			slog.Warn("[PriorityReduceFilter] outputMaxPriorityOne with maxLen, but that one is nil",
-				"wtf", "为什么会空啊，匪夷所思啊",
-				"action", "return",
-				"maxLenIdx", maxLenIdx,
-				"choosen", choosen)
-			return
+	// 否则，由 Strategy 选出至多 Count 条
+	strategy := f.Strategy
+	if strategy == nil {
+		strategy = ReduceStrategyFunc(selectLongest)
+	}
+	count := f.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	for _, t := range withChunkSiblings(strategy.Select(others, count), others) {
+		if t == nil {
+			continue
 		}
-		slog.Info("[PriorityReduceFilter] outputMaxPriorityOne with maxLen",
-			"author", one.Author, "content", ellipsis.Centering(one.Content, 17), "priority", one.Priority)
-		chOut <- one
+		slog.Info("[PriorityReduceFilter] outputMaxPriorityOne with strategy",
+			"author", t.Author, "content", ellipsis.Centering(t.Content, 17), "priority", t.Priority)
+		chOut <- t
 	}
 }
 
-func maxLenOfTextInSlice(slice []*model.Text) (maxLen int, index int) {
-	if len(slice) == 0 {
-		return 0, 0
-	}
-	for i, t := range slice {
+// withChunkSiblings 把 selected 中由 TooLongSplitFilter 切出来的段，
+// 替换为同一个 TextOut 切出来的所有段 (按到达顺序)，让它们一起输出。
+func withChunkSiblings(selected []*model.Text, all []*model.Text) []*model.Text {
+	result := make([]*model.Text, 0, len(selected))
+	added := make(map[*model.Text]bool, len(selected))
+	for _, t := range selected {
 		if t == nil {
 			continue
 		}
-		if len(t.Content) > maxLen {
-			maxLen = len(t.Content)
-			index = i
+		chunkOf, _ := t.MetaString(model.MetaChunkOf)
+		if chunkOf == "" {
+			if !added[t] {
+				added[t] = true
+				result = append(result, t)
+			}
+			continue
+		}
+		for _, sibling := range all {
+			if s, _ := sibling.MetaString(model.MetaChunkOf); s == chunkOf && !added[sibling] {
+				added[sibling] = true
+				result = append(result, sibling)
+			}
 		}
 	}
-	return maxLen, index
+	return result
 }
 
 type TooLongFilter struct {
 	MaxWords     int
 	quibbleIndex int
 	quibbles     []string
+
+	// QuibblesFrom (optional) overrides the quibbles if it returns any:
+	// e.g. the ones of the active persona.
+	QuibblesFrom func() []string
 }
 
 func NewTooLongFilter(maxWords int, quibbles []string) *TooLongFilter {
@@ -283,10 +306,18 @@ func (t TooLongFilter) TextFilterFunc(callback func(text, quibble *string)) Text
 			return true
 		}
 
+		quibbles := t.quibbles
+		if t.QuibblesFrom != nil {
+			if q := t.QuibblesFrom(); len(q) > 0 {
+				quibbles = q
+			}
+		}
+
 		var quibble *string
-		if len(t.quibbles) > 0 {
-			quibble = &t.quibbles[t.quibbleIndex]
-			t.quibbleIndex = (t.quibbleIndex + 1) % len(t.quibbles)
+		if len(quibbles) > 0 {
+			t.quibbleIndex %= len(quibbles) // the quibbles may change
+			quibble = &quibbles[t.quibbleIndex]
+			t.quibbleIndex = (t.quibbleIndex + 1) % len(quibbles)
 		}
 		slog.Warn("[TooLongFilter] text is too long, filtered out",
 			"text", ellipsis.Centering(text, 17),
@@ -310,11 +341,18 @@ func tooLong(text string, maxWords int) bool {
 	if len(text) <= maxWords {
 		return false
 	}
+	return countWords(text, maxWords) > maxWords
+}
 
-	// count the number of words
-	// - English words ( Latin ) are separated by spaces
-	// - Chinese words is counted by the number of chars
-	// - Punctuation is counted as a word
+// countWords counts the number of words in the given text, the way tooLong does:
+//
+//   - English words ( Latin ) are separated by spaces
+//   - Chinese words is counted by the number of chars
+//   - Punctuation is counted as a word
+//
+// It stops counting once the count is greater than limit,
+// and returns that count. A negative limit means no limit.
+func countWords(text string, limit int) int {
 	words := 0
 	lastIsLatin := false
 	for _, r := range text {
@@ -327,13 +365,13 @@ func tooLong(text string, maxWords int) bool {
 		} else {
 			lastIsLatin = true
 		}
-		if words > maxWords {
-			return true
+		if limit >= 0 && words > limit {
+			return words
 		}
 	}
 
 	if lastIsLatin {
 		words++
 	}
-	return words > maxWords
+	return words
 }
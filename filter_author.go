@@ -0,0 +1,161 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/ratelimit"
+	"time"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// AuthorFilter 按作者过滤消息：
+//
+//   - Blocklist 中的作者的消息全部丢弃；
+//   - 若 Allowlist 非空，只保留 Allowlist 中的作者的消息；
+//   - 每个作者每 cooldown 时间内只回答一条消息 (可以攒下几条: ratelimit.WithBurst)，
+//     每天最多回答几条 (ratelimit.WithDailyQuota)。冷却从真正回答了 (ObserveReply)
+//     才开始算：放行了但没被 priority_reduce 选中的作者不受影响；冷却中的作者的消息被丢弃；
+//   - Regulars (常客) 的消息 Priority 提升 RegularBoost。
+//
+// 名单中的条目可以是作者名 (Author) 或作者 ID (AuthorID)。
+// 付费消息 (SC、礼物、上舰) 不受 Allowlist 和限流的限制。
+//
+// 应该放在 PriorityReduceFilter 之前。
+type AuthorFilter struct {
+	Allowlist    map[string]bool
+	Blocklist    map[string]bool
+	Regulars     map[string]bool
+	RegularBoost model.Priority
+
+	limiter *ratelimit.Limiter // per author (authorKey)
+}
+
+// NewAuthorFilter creates an AuthorFilter that answers a message of each
+// author every cooldown, limited further by the opts. cooldown 0 and no
+// daily quota for no limit.
+func NewAuthorFilter(cooldown time.Duration, opts ...ratelimit.Option) *AuthorFilter {
+	return &AuthorFilter{
+		Allowlist:    map[string]bool{},
+		Blocklist:    map[string]bool{},
+		Regulars:     map[string]bool{},
+		RegularBoost: 1,
+		limiter:      ratelimit.New(cooldown, opts...),
+	}
+}
+
+// inList reports whether the author of t is in the list (by name or id).
+func inList(list map[string]bool, t *model.Text) bool {
+	return list[t.Author] || (t.AuthorID != "" && list[t.AuthorID])
+}
+
+// Check returns "" if the textIn passes, or the reason it's dropped.
+// The Priority of the textIn from a regular is boosted.
+func (f *AuthorFilter) Check(textIn *model.TextIn) (reason string) {
+	if inList(f.Blocklist, textIn) {
+		return "blocklist"
+	}
+
+	paid := isPaid(textIn)
+
+	if !paid && len(f.Allowlist) > 0 && !inList(f.Allowlist, textIn) {
+		return "not_in_allowlist"
+	}
+
+	if !paid {
+		if reason := f.limit(authorKey(textIn)); reason != "" {
+			return reason
+		}
+	}
+
+	if inList(f.Regulars, textIn) {
+		textIn.Priority += f.RegularBoost
+	}
+
+	return ""
+}
+
+// limit returns "" if the author is not limited, or the reason their
+// message is dropped: "daily_quota" or "cooldown".
+// The token is taken by ObserveReply.
+func (f *AuthorFilter) limit(author string) (reason string) {
+	if f.limiter.Wait(author) <= 0 {
+		return ""
+	}
+	if f.limiter.Remaining(author) == 0 {
+		return "daily_quota"
+	}
+	return "cooldown"
+}
+
+// ObserveReply starts the cooldown of the author answered by the textOut
+// (ReplyTo). Only the first chunk of a reply counts. See replyObserver.
+func (f *AuthorFilter) ObserveReply(textOut *model.TextOut) {
+	if textOut == nil || textOut.ReplyTo == nil || isPaid(textOut.ReplyTo) {
+		return
+	}
+	if index, _ := textOut.MetaInt(model.MetaChunkIndex); index > 0 {
+		return
+	}
+	f.limiter.Allow(authorKey(textOut.ReplyTo))
+}
+
+// isPaid reports whether t is a paid message: SC, gift or member.
+func isPaid(t *model.Text) bool {
+	switch t.Source {
+	case model.SourceSuperChat, model.SourceGift, model.SourceMember:
+		return true
+	}
+	return false
+}
+
+func (f *AuthorFilter) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	return filterChan(chIn, func(textIn *model.TextIn) bool {
+		if textIn == nil {
+			return false
+		}
+		reason := f.Check(textIn)
+		if reason == "" {
+			return true
+		}
+		slog.Info("[AuthorFilter] drop.",
+			"reason", reason,
+			"author", textIn.Author,
+			"content", ellipsis.Centering(textIn.Content, 17))
+		return false
+	})
+}
+
+type authorOptions struct {
+	Cooldown     time.Duration `mapstructure:"cooldown"`      // 每个作者的冷却时间
+	Burst        int           `mapstructure:"burst"`         // 每个作者最多攒下几条 (每 cooldown 攒一条): 1 by default
+	DailyQuota   int           `mapstructure:"daily_quota"`   // 每个作者每天最多几条: 0 for no limit
+	Allowlist    []string      `mapstructure:"allowlist"`     // 只回复这些作者 (名字或 uid)
+	Blocklist    []string      `mapstructure:"blocklist"`     // 不回复这些作者
+	Regulars     []string      `mapstructure:"regulars"`      // 常客，提升优先级
+	RegularBoost *int          `mapstructure:"regular_boost"` // 常客提升的优先级: 1 by default
+}
+
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+func init() {
+	// author: 按作者过滤: 冷却、黑白名单、常客提权
+	RegisterFilter("author", func(env *filterEnv, o authorOptions) (any, error) {
+		f := NewAuthorFilter(o.Cooldown,
+			ratelimit.WithBurst(o.Burst),
+			ratelimit.WithDailyQuota(o.DailyQuota))
+		f.Allowlist = toSet(o.Allowlist)
+		f.Blocklist = toSet(o.Blocklist)
+		f.Regulars = toSet(o.Regulars)
+		if o.RegularBoost != nil {
+			f.RegularBoost = model.Priority(*o.RegularBoost)
+		}
+		return f, nil
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+func TestAuthorFilter_Check(t *testing.T) {
+	f := NewAuthorFilter(time.Minute)
+	f.Blocklist = toSet([]string{"troll", "10086"})
+	f.Regulars = toSet([]string{"fan"})
+
+	newTextIn := func(source model.Source, author, authorID string) *model.TextIn {
+		textIn := model.NewTextIn(source, author, "hello", model.PriorityLow)
+		textIn.AuthorID = authorID
+		return textIn
+	}
+
+	tests := []struct {
+		name   string
+		textIn *model.TextIn
+		want   string
+	}{
+		{"blockedByName", newTextIn(model.SourceDm, "troll", ""), "blocklist"},
+		{"blockedByID", newTextIn(model.SourceDm, "renamed", "10086"), "blocklist"},
+		{"first", newTextIn(model.SourceDm, "a", ""), ""},
+		{"notAnswered", newTextIn(model.SourceDm, "a", ""), ""},
+		{"regular", newTextIn(model.SourceDm, "fan", ""), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Check(tt.textIn); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the cooldown starts when answered
+	answered := newTextIn(model.SourceDm, "a", "")
+	f.ObserveReply(answered.Reply("chatbot", "hi"))
+	if got := f.Check(newTextIn(model.SourceDm, "a", "")); got != "cooldown" {
+		t.Errorf("answered: Check() = %q, want cooldown", got)
+	}
+	if got := f.Check(newTextIn(model.SourceSuperChat, "a", "")); got != "" {
+		t.Errorf("paid in cooldown: Check() = %q, want passed", got)
+	}
+
+	regular := newTextIn(model.SourceDm, "fan2", "")
+	f.Regulars["fan2"] = true
+	f.Check(regular)
+	if regular.Priority != model.PriorityLow+1 {
+		t.Errorf("regular Priority = %v, want boosted", regular.Priority)
+	}
+
+	f.Allowlist = toSet([]string{"vip"})
+	if got := f.Check(newTextIn(model.SourceDm, "b", "")); got != "not_in_allowlist" {
+		t.Errorf("not in allowlist: Check() = %q", got)
+	}
+	if got := f.Check(newTextIn(model.SourceDm, "vip", "")); got != "" {
+		t.Errorf("in allowlist: Check() = %q", got)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"muvtuberdriver/model"
+	"muvtuberdriver/moderation"
+	"muvtuberdriver/pkg/wordfilter"
+	"regexp"
+
+	"golang.org/x/exp/slog"
+)
+
+// BlocklistAction is what BlocklistFilter does to a text with blocked words.
+type BlocklistAction string
+
+const (
+	BlocklistActionDrop    BlocklistAction = "drop"    // drop the whole message
+	BlocklistActionMask    BlocklistAction = "mask"    // replace the blocked words with '*'
+	BlocklistActionReplace BlocklistAction = "replace" // replace the whole content with the Replacement
+)
+
+// BlocklistFilter 屏蔽含有敏感词的消息。
+//
+// 敏感词用 wordfilter.Matcher (Aho-Corasick) 匹配，能够容忍插入的空格、符号以及全角字符；
+// 另外还支持正则表达式。命中后按 Action 丢弃、打码或替换整条消息。
+//
+// BlocklistFilter 可以同时用作 TextInFilter 和 TextOutFilter。
+// (要对 chatbot 的回答做更完整的审核，见 ModerationFilter。)
+type BlocklistFilter struct {
+	words *moderation.WordList
+
+	Action      BlocklistAction
+	Replacement string // for BlocklistActionReplace
+
+	onReject func(text *model.Text, reason string) // see OnReject
+}
+
+// NewBlocklistFilter creates a BlocklistFilter.
+// The matcher is built here (see moderation.NewWordList); words added
+// later are built on the next match. Both matcher and regexps can be nil.
+func NewBlocklistFilter(matcher *wordfilter.Matcher, regexps []*regexp.Regexp, action BlocklistAction, replacement string) (*BlocklistFilter, error) {
+	switch action {
+	case BlocklistActionDrop, BlocklistActionMask:
+	case BlocklistActionReplace:
+		if replacement == "" {
+			return nil, fmt.Errorf("blocklist: replacement is required for action %q", action)
+		}
+	default:
+		return nil, fmt.Errorf("blocklist: unknown action %q", action)
+	}
+
+	return &BlocklistFilter{
+		words:       moderation.NewWordList(matcher, regexps),
+		Action:      action,
+		Replacement: replacement,
+	}, nil
+}
+
+// Find the blocked words and regexps in the text.
+func (f *BlocklistFilter) Find(text string) []wordfilter.Match {
+	return f.words.Find(text)
+}
+
+// check the text (and modify it for mask or replace).
+// Returns false if the text should be dropped.
+func (f *BlocklistFilter) check(t *model.Text) bool {
+	if t == nil {
+		return false
+	}
+
+	verdict, _ := f.words.Moderate(context.Background(), t.Content)
+	if !verdict.Flagged {
+		return true
+	}
+
+	if f.onReject != nil {
+		f.onReject(t, fmt.Sprintf("%s: %v", f.Action, verdict.Categories))
+	}
+	masked := wordfilter.Mask(t.Content, verdict.Matches, '*')
+	slog.Warn("[BlocklistFilter] blocked words found.",
+		"action", f.Action,
+		"id", t.ID,
+		"author", t.Author,
+		"categories", verdict.Categories,
+		"masked", moderation.Redact(t.Content, verdict))
+
+	switch f.Action {
+	case BlocklistActionMask:
+		t.Content = masked
+	case BlocklistActionReplace:
+		t.Content = f.Replacement
+	default: // BlocklistActionDrop
+		return false
+	}
+	return true
+}
+
+// OnReject sets the fn called with each Text with the blocked words
+// (before it's dropped, masked or replaced) and the reason.
+func (f *BlocklistFilter) OnReject(fn func(text *model.Text, reason string)) {
+	f.onReject = fn
+}
+
+func (f *BlocklistFilter) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	return filterChan(chIn, f.check)
+}
+
+func (f *BlocklistFilter) FilterTextOut(chIn chan *model.TextOut) (chOut chan *model.TextOut) {
+	return filterChan(chIn, f.check)
+}
+
+type blocklistOptions struct {
+	Lists       map[string]string `mapstructure:"lists"`       // category -> word list file (one word per line)
+	Words       []string          `mapstructure:"words"`       // inline words, category "inline"
+	Regexps     []string          `mapstructure:"regexps"`     // regular expressions, category "regexp"
+	Action      string            `mapstructure:"action"`      // drop (default) | mask | replace
+	Replacement string            `mapstructure:"replacement"` // for action replace
+}
+
+func init() {
+	// blocklist: 敏感词过滤
+	RegisterFilter("blocklist", func(env *filterEnv, o blocklistOptions) (any, error) {
+		matcher, regexps, err := loadWordList(o.Lists, o.Words, o.Regexps)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist: %w", err)
+		}
+
+		action := BlocklistAction(o.Action)
+		if action == "" {
+			action = BlocklistActionDrop
+		}
+
+		slog.Info("[BlocklistFilter] loaded.", "words", matcher.Len(), "regexps", len(regexps), "action", action)
+
+		return NewBlocklistFilter(matcher, regexps, action, o.Replacement)
+	})
+}
+
+// loadWordList loads the words (category -> word list file, and the inline
+// words of category "inline") and compiles the regexps,
+// for a BlocklistFilter or a moderation.WordList.
+func loadWordList(lists map[string]string, words []string, exprs []string) (*wordfilter.Matcher, []*regexp.Regexp, error) {
+	matcher := wordfilter.NewMatcher()
+	for category, file := range lists {
+		if err := matcher.AddFile(file, category); err != nil {
+			return nil, nil, fmt.Errorf("load %q: %w", file, err)
+		}
+	}
+	for _, word := range words {
+		matcher.Add(word, "inline")
+	}
+
+	var regexps []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad regexp %q: %w", expr, err)
+		}
+		regexps = append(regexps, re)
+	}
+	return matcher, regexps, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"muvtuberdriver/audio"
+	"muvtuberdriver/command"
+	"muvtuberdriver/model"
+	"sort"
+	"time"
+)
+
+// CommandFilter routes the viewer commands ("!motion wave") to their
+// handlers (see command.Router). The commands are taken out of the chain,
+// except what the handlers forward (e.g. "!ask xxx" -> "xxx").
+// Other messages pass through.
+type CommandFilter struct {
+	Router *command.Router
+}
+
+func (f *CommandFilter) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	chOut = make(chan *model.TextIn, RecvMsgChanBuf)
+	go func() {
+		defer close(chOut)
+		for textIn := range chIn {
+			if forward, _ := f.Router.Route(textIn); forward != nil {
+				chOut <- forward
+			}
+		}
+	}()
+	return chOut
+}
+
+// commandHandlerFactory builds a command.Handler from the args in config.
+type commandHandlerFactory func(env *filterEnv, args map[string]string) (command.Handler, error)
+
+// commandHandlers: handler name -> factory
+var commandHandlers = map[string]commandHandlerFactory{}
+
+// RegisterCommandHandler registers a command handler factory by name,
+// so that it can be used in the options of the command filter:
+//
+//   - name: command
+//     options:
+//     commands:
+//     wave:                 # !wave
+//     handler: motion     # the registered name, the command name by default
+//     args: {"": tap_body}
+func RegisterCommandHandler(name string, factory commandHandlerFactory) {
+	if _, ok := commandHandlers[name]; ok {
+		panic("RegisterCommandHandler: duplicate handler name: " + name)
+	}
+	commandHandlers[name] = factory
+}
+
+// RegisteredCommandHandlers returns the names of all registered command handlers.
+func RegisteredCommandHandlers() []string {
+	names := make([]string, 0, len(commandHandlers))
+	for name := range commandHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type commandFilterOptions struct {
+	Prefixes []string                  `mapstructure:"prefixes"` // "!" and "！" by default
+	Commands map[string]commandOptions `mapstructure:"commands"` // command name -> options
+}
+
+type commandOptions struct {
+	Handler        string            `mapstructure:"handler"`         // registered handler name: the command name by default
+	Args           map[string]string `mapstructure:"args"`            // handler specific, see the handlers
+	Aliases        []string          `mapstructure:"aliases"`         // other names of the command
+	Permission     string            `mapstructure:"permission"`      // anyone (default) | medal | moderator
+	MinMedalLevel  int               `mapstructure:"min_medal_level"` // permission=medal: 粉丝牌等级至少多少
+	Cooldown       time.Duration     `mapstructure:"cooldown"`        // 全局冷却: 用过之后多久内谁都不能再用
+	AuthorCooldown time.Duration     `mapstructure:"author_cooldown"` // 每个观众的冷却
+	Disabled       bool              `mapstructure:"disabled"`
+}
+
+// buildCommandRouter builds the router of the commands in o.
+func buildCommandRouter(env *filterEnv, o commandFilterOptions) (*command.Router, error) {
+	router := command.NewRouter(o.Prefixes...)
+
+	names := make([]string, 0, len(o.Commands))
+	for name := range o.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names) // stable errors
+
+	for _, name := range names {
+		c := o.Commands[name]
+		if c.Disabled {
+			continue
+		}
+		handlerName := c.Handler
+		if handlerName == "" {
+			handlerName = name
+		}
+		factory, ok := commandHandlers[handlerName]
+		if !ok {
+			return nil, fmt.Errorf("command %q: unknown handler %q (registered: %v)",
+				name, handlerName, RegisteredCommandHandlers())
+		}
+		handler, err := factory(env, c.Args)
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", name, err)
+		}
+		permission, err := command.ParsePermission(c.Permission)
+		if err != nil {
+			return nil, fmt.Errorf("command %q: %w", name, err)
+		}
+		err = router.Register(name, handler,
+			command.WithPermission(permission),
+			command.WithMinMedalLevel(c.MinMedalLevel),
+			command.WithCooldown(c.Cooldown),
+			command.WithAuthorCooldown(c.AuthorCooldown),
+			command.WithAliases(c.Aliases...))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// region builtin command handlers
+
+func init() {
+	// command: 观众指令
+	RegisterFilter("command", func(env *filterEnv, o commandFilterOptions) (any, error) {
+		router, err := buildCommandRouter(env, o)
+		if err != nil {
+			return nil, fmt.Errorf("command: %w", err)
+		}
+		return &CommandFilter{Router: router}, nil
+	})
+
+	// motion: !motion wave. args: 观众输入的名字 -> live2d motion，为空则不限
+	RegisterCommandHandler("motion", func(env *filterEnv, args map[string]string) (command.Handler, error) {
+		if env == nil || env.live2d == nil {
+			return nil, fmt.Errorf("motion: live2d is required")
+		}
+		return command.MotionHandler(env.live2d, args), nil
+	})
+
+	// ask: !ask xxx, 把 xxx 交给 chatbot。args: {boost: 提升几级优先级}
+	RegisterCommandHandler("ask", func(env *filterEnv, args map[string]string) (command.Handler, error) {
+		var boost int
+		if b := args["boost"]; b != "" {
+			if _, err := fmt.Sscan(b, &boost); err != nil {
+				return nil, fmt.Errorf("ask: bad boost %q: %w", b, err)
+			}
+		}
+		return command.AskHandler(model.Priority(boost)), nil
+	})
+
+	// bgm, fx, song: !bgm [next|random|<name>]. args: 曲名 -> 音频 URL
+	trackHandlers := map[string]func(env *filterEnv) func(*audio.Track) error{
+		"bgm":  func(env *filterEnv) func(*audio.Track) error { return env.audio.PlayBgm },
+		"fx":   func(env *filterEnv) func(*audio.Track) error { return env.audio.PlayFx },
+		"song": func(env *filterEnv) func(*audio.Track) error { return env.audio.PlaySing },
+	}
+	for name, play := range trackHandlers {
+		name, play := name, play
+		RegisterCommandHandler(name, func(env *filterEnv, args map[string]string) (command.Handler, error) {
+			if env == nil || env.audio == nil {
+				return nil, fmt.Errorf("%s: audio controller is required", name)
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%s: no tracks in args", name)
+			}
+			return command.TrackHandler(play(env), args), nil
+		})
+	}
+}
+
+// endregion builtin command handlers
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"muvtuberdriver/model"
+	"muvtuberdriver/moderation"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// ModerationAction is what ModerationFilter does to a flagged TextOut.
+type ModerationAction string
+
+const (
+	ModerationActionDrop       ModerationAction = "drop"       // drop it silently
+	ModerationActionFallback   ModerationAction = "fallback"   // speak a safe fallback line instead
+	ModerationActionRegenerate ModerationAction = "regenerate" // ask the same chatbot to answer again
+)
+
+// severity of the actions: the most severe one of the categories flagged wins.
+var moderationSeverity = map[ModerationAction]int{
+	ModerationActionRegenerate: 1,
+	ModerationActionFallback:   2,
+	ModerationActionDrop:       3,
+}
+
+// Regenerator answers the TextIn of a rejected TextOut again:
+// *chatbot.PrioritizedChatbot.
+type Regenerator interface {
+	Regenerate(ctx context.Context, rejected *model.TextOut) (*model.TextOut, error)
+}
+
+// ModerationFilter 在说出 chatbot 的回答之前审核它。
+//
+// 被 Moderator 判定违规的回答，按 Action (可以按类别 CategoryActions 覆盖) 处理：
+// 直接丢弃；换成一句安全的 Fallbacks 话术；或者让原来的 chatbot 重新回答，
+// 最多 MaxRegenerate 次，还不行就用 fallback 话术 (没有的话丢弃)。
+// 流式输出或者 too_long 切出来的片段、兜底的回答，都没法重新生成，直接 fallback。
+//
+// 日志中违规的内容会被打码 (moderation.Redact)。
+type ModerationFilter struct {
+	moderator   moderation.Moderator
+	regenerator Regenerator // nil: can not regenerate, fallback instead
+
+	Action          ModerationAction
+	CategoryActions map[string]ModerationAction // overrides Action for the categories
+	Fallbacks       []string                    // the safe lines, used in turn
+	MaxRegenerate   int                         // max regenerations for a TextOut
+	FailOpen        bool                        // let the TextOut go if the moderator fails
+	Timeout         time.Duration               // of each moderation and regeneration, 0 for no timeout
+
+	ctx context.Context // the app context: the moderations and regenerations are canceled on shutdown
+
+	fallbackIndex int
+	fallbackMu    sync.Mutex
+
+	onReject func(text *model.Text, reason string) // see OnReject
+}
+
+// NewModerationFilter creates a ModerationFilter with the default action drop.
+func NewModerationFilter(moderator moderation.Moderator, regenerator Regenerator) *ModerationFilter {
+	return &ModerationFilter{
+		moderator:   moderator,
+		regenerator: regenerator,
+		Action:      ModerationActionDrop,
+		ctx:         context.Background(),
+	}
+}
+
+func (f *ModerationFilter) FilterTextOut(chIn chan *model.TextOut) (chOut chan *model.TextOut) {
+	chOut = make(chan *model.TextOut, RecvMsgChanBuf)
+	go func() {
+		defer close(chOut)
+		for textOut := range chIn {
+			if textOut = f.check(textOut); textOut != nil {
+				chOut <- textOut
+			}
+		}
+	}()
+	return chOut
+}
+
+// check the textOut. Returns the TextOut to speak: textOut itself, a
+// regenerated one or the fallback; nil to drop it.
+func (f *ModerationFilter) check(textOut *model.TextOut) *model.TextOut {
+	for attempt := 0; textOut != nil; attempt++ {
+		verdict, err := f.moderate(textOut.Content)
+		if err != nil {
+			slog.Warn("[ModerationFilter] moderation failed.",
+				"id", textOut.ID, "failOpen", f.FailOpen, "err", err)
+			if f.FailOpen {
+				return textOut
+			}
+			return nil
+		}
+		if !verdict.Flagged {
+			if attempt > 0 {
+				textOut.SetMeta(model.MetaModeration, "regenerated")
+			}
+			return textOut
+		}
+
+		action := f.actionOf(verdict)
+		if f.onReject != nil {
+			f.onReject(textOut, fmt.Sprintf("%s: %v", action, verdict.Categories))
+		}
+		slog.Warn("[ModerationFilter] flagged.",
+			"action", action,
+			"id", textOut.ID,
+			"author", textOut.Author,
+			"attempt", attempt,
+			"moderator", verdict.Moderator,
+			"categories", verdict.Categories,
+			"redacted", moderation.Redact(textOut.Content, verdict))
+
+		switch action {
+		case ModerationActionRegenerate:
+			if attempt >= f.MaxRegenerate {
+				slog.Warn("[ModerationFilter] too many regenerations, fallback.", "id", textOut.ID, "max", f.MaxRegenerate)
+				return f.fallback(textOut)
+			}
+			regenerated, err := f.regenerate(textOut)
+			if err != nil {
+				slog.Warn("[ModerationFilter] regenerate failed, fallback.", "id", textOut.ID, "err", err)
+				return f.fallback(textOut)
+			}
+			textOut = regenerated
+		case ModerationActionFallback:
+			return f.fallback(textOut)
+		default: // ModerationActionDrop
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *ModerationFilter) moderate(text string) (moderation.Verdict, error) {
+	ctx, cancel := f.context()
+	defer cancel()
+	return f.moderator.Moderate(ctx, text)
+}
+
+func (f *ModerationFilter) regenerate(textOut *model.TextOut) (*model.TextOut, error) {
+	if f.regenerator == nil {
+		return nil, errors.New("no regenerator")
+	}
+	ctx, cancel := f.context()
+	defer cancel()
+	return f.regenerator.Regenerate(ctx, textOut)
+}
+
+// context of a moderation or regeneration: the app context bounded by Timeout.
+func (f *ModerationFilter) context() (context.Context, context.CancelFunc) {
+	if f.Timeout > 0 {
+		return context.WithTimeout(f.ctx, f.Timeout)
+	}
+	return context.WithCancel(f.ctx)
+}
+
+// actionOf the verdict: the most severe action of the categories flagged,
+// or the default Action.
+func (f *ModerationFilter) actionOf(verdict moderation.Verdict) ModerationAction {
+	var action ModerationAction
+	for _, category := range verdict.Categories {
+		if a, ok := f.CategoryActions[category]; ok && moderationSeverity[a] > moderationSeverity[action] {
+			action = a
+		}
+	}
+	if action == "" {
+		action = f.Action
+	}
+	return action
+}
+
+// fallback replaces the content of the textOut with the next fallback line.
+// Returns nil (drop) if there is no fallback line.
+func (f *ModerationFilter) fallback(textOut *model.TextOut) *model.TextOut {
+	if len(f.Fallbacks) == 0 {
+		return nil
+	}
+	f.fallbackMu.Lock()
+	line := f.Fallbacks[f.fallbackIndex%len(f.Fallbacks)]
+	f.fallbackIndex++
+	f.fallbackMu.Unlock()
+
+	textOut.Content = line
+	textOut.SetMeta(model.MetaModeration, "fallback")
+	return textOut
+}
+
+// OnReject sets the fn called with each flagged TextOut (before it's
+// dropped, replaced or regenerated) and the reason.
+func (f *ModerationFilter) OnReject(fn func(text *model.Text, reason string)) {
+	f.onReject = fn
+}
+
+// Close closes the moderators (e.g. the gRPC connections).
+func (f *ModerationFilter) Close() error {
+	if closer, ok := f.moderator.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type moderationOptions struct {
+	Moderators    []moderatorOptions `mapstructure:"moderators"`     // checked in order, see moderation.Chain
+	Action        string             `mapstructure:"action"`         // drop (default) | fallback | regenerate
+	Categories    map[string]string  `mapstructure:"categories"`     // category -> action, overrides action
+	Fallbacks     []string           `mapstructure:"fallbacks"`      // safe lines for action fallback
+	MaxRegenerate int                `mapstructure:"max_regenerate"` // for action regenerate: 2 by default
+	OnError       string             `mapstructure:"on_error"`       // allow (default) | drop: if a moderator fails
+	Timeout       time.Duration      `mapstructure:"timeout"`        // of each moderation and regeneration: 5s by default
+}
+
+type moderatorOptions struct {
+	Type string `mapstructure:"type"` // wordlist | http | grpc
+
+	// wordlist: like the blocklist filter
+	Lists   map[string]string `mapstructure:"lists"`   // category -> word list file (one word per line)
+	Words   []string          `mapstructure:"words"`   // inline words, category "inline"
+	Regexps []string          `mapstructure:"regexps"` // regular expressions, category "regexp"
+
+	// http: an OpenAI-compatible moderation endpoint
+	URL    string `mapstructure:"url"`     // e.g. https://api.openai.com/v1/moderations
+	ApiKey string `mapstructure:"api_key"` // optional
+	Model  string `mapstructure:"model"`   // optional
+
+	// grpc: a ModerationService (moderation/proto/moderation.proto)
+	Addr string `mapstructure:"addr"`
+}
+
+// buildModerator builds a moderation.Moderator from the options.
+func buildModerator(o moderatorOptions) (moderation.Moderator, error) {
+	switch o.Type {
+	case "wordlist":
+		matcher, regexps, err := loadWordList(o.Lists, o.Words, o.Regexps)
+		if err != nil {
+			return nil, err
+		}
+		return moderation.NewWordList(matcher, regexps), nil
+	case "http":
+		return moderation.NewHTTPModerator(o.URL, o.ApiKey, o.Model)
+	case "grpc":
+		return moderation.NewGRPCModerator(o.Addr)
+	default:
+		return nil, fmt.Errorf("unknown moderator type %q", o.Type)
+	}
+}
+
+// parseModerationAction parses the action. Empty for the default def.
+func parseModerationAction(s string, def ModerationAction) (ModerationAction, error) {
+	if s == "" {
+		return def, nil
+	}
+	action := ModerationAction(s)
+	if _, ok := moderationSeverity[action]; !ok {
+		return "", fmt.Errorf("unknown action %q", s)
+	}
+	return action, nil
+}
+
+func init() {
+	// moderation: 审核 chatbot 的回答
+	RegisterFilter("moderation", func(env *filterEnv, o moderationOptions) (any, error) {
+		if len(o.Moderators) == 0 {
+			return nil, errors.New("moderation: no moderators")
+		}
+		var chain moderation.Chain
+		for i, mo := range o.Moderators {
+			m, err := buildModerator(mo)
+			if err != nil {
+				chain.Close()
+				return nil, fmt.Errorf("moderation: moderators[%d]: %w", i, err)
+			}
+			chain = append(chain, m)
+		}
+
+		var regenerator Regenerator
+		if env != nil && env.regenerator != nil {
+			regenerator = env.regenerator
+		}
+		f := NewModerationFilter(chain, regenerator)
+		if env != nil && env.ctx != nil {
+			f.ctx = env.ctx
+		}
+
+		var err error
+		if f.Action, err = parseModerationAction(o.Action, ModerationActionDrop); err != nil {
+			return nil, fmt.Errorf("moderation: %w", err)
+		}
+		f.CategoryActions = map[string]ModerationAction{}
+		for category, a := range o.Categories {
+			if f.CategoryActions[category], err = parseModerationAction(a, f.Action); err != nil {
+				return nil, fmt.Errorf("moderation: category %q: %w", category, err)
+			}
+		}
+		f.Fallbacks = o.Fallbacks
+		f.MaxRegenerate = 2
+		if o.MaxRegenerate > 0 {
+			f.MaxRegenerate = o.MaxRegenerate
+		}
+		switch o.OnError {
+		case "", "allow":
+			f.FailOpen = true
+		case "drop":
+			f.FailOpen = false
+		default:
+			return nil, fmt.Errorf("moderation: unknown on_error %q", o.OnError)
+		}
+		f.Timeout = 5 * time.Second
+		if o.Timeout > 0 {
+			f.Timeout = o.Timeout
+		}
+
+		if regenerator == nil && f.usesAction(ModerationActionRegenerate) {
+			slog.Warn("[ModerationFilter] no chatbot to regenerate, fallback instead.")
+		}
+		if len(f.Fallbacks) == 0 && f.usesAction(ModerationActionFallback) {
+			slog.Warn("[ModerationFilter] no fallback lines, the flagged answers are dropped.")
+		}
+		slog.Info("[ModerationFilter] loaded.", "moderators", len(chain), "action", f.Action, "categories", f.CategoryActions)
+		return f, nil
+	})
+}
+
+// usesAction reports whether the action is the default or for a category.
+// A regenerate falls back, so it uses fallback as well.
+func (f *ModerationFilter) usesAction(action ModerationAction) bool {
+	uses := func(a ModerationAction) bool {
+		return a == action || (action == ModerationActionFallback && a == ModerationActionRegenerate)
+	}
+	if uses(f.Action) {
+		return true
+	}
+	for _, a := range f.CategoryActions {
+		if uses(a) {
+			return true
+		}
+	}
+	return false
+}
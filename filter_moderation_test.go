@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"muvtuberdriver/model"
+	"muvtuberdriver/moderation"
+	"muvtuberdriver/pkg/wordfilter"
+	"testing"
+	"time"
+)
+
+// scriptedRegenerator answers the next of its answers on each Regenerate.
+type scriptedRegenerator struct {
+	answers []string
+	calls   int
+}
+
+func (r *scriptedRegenerator) Regenerate(ctx context.Context, rejected *model.TextOut) (*model.TextOut, error) {
+	if r.calls >= len(r.answers) {
+		return nil, errors.New("no more answers")
+	}
+	r.calls++
+	return rejected.ReplyTo.Reply("scripted", r.answers[r.calls-1]), nil
+}
+
+func TestModerationFilter_Check(t *testing.T) {
+	matcher := wordfilter.NewMatcher()
+	matcher.Add("笨蛋", "insult")
+	matcher.Add("打架", "violence")
+	words := moderation.NewWordList(matcher, nil)
+
+	tests := []struct {
+		name     string
+		content  string
+		answers  []string // of the regenerator
+		want     string   // "" for dropped
+		wantMeta any
+	}{
+		{"clean", "你好", nil, "你好", nil},
+		{"regenerated", "你是笨蛋", []string{"还是笨蛋", "你好呀"}, "你好呀", "regenerated"},
+		{"too many regenerations", "你是笨蛋", []string{"笨蛋", "笨蛋", "你好呀"}, "换个话题吧。", "fallback"},
+		{"regenerate failed", "你是笨蛋", nil, "换个话题吧。", "fallback"},
+		{"category drop", "去打架", []string{"你好呀"}, "", nil},
+	}
+	for _, tt := range tests {
+		regenerator := &scriptedRegenerator{answers: tt.answers}
+		f := NewModerationFilter(words, regenerator)
+		f.Action = ModerationActionRegenerate
+		f.CategoryActions = map[string]ModerationAction{"violence": ModerationActionDrop}
+		f.Fallbacks = []string{"换个话题吧。"}
+		f.MaxRegenerate = 2
+
+		textIn := model.NewTextIn(model.SourceDm, "a", "?", 0)
+		got := f.check(textIn.Reply("chatbot", tt.content))
+		if tt.want == "" {
+			if got != nil {
+				t.Errorf("%s: check(%q) = %q, want dropped", tt.name, tt.content, got.Content)
+			}
+			continue
+		}
+		if got == nil || got.Content != tt.want || got.Meta(model.MetaModeration) != tt.wantMeta {
+			t.Errorf("%s: check(%q) = %+v, want %q (%v)", tt.name, tt.content, got, tt.want, tt.wantMeta)
+		}
+	}
+}
+
+// blockingRegenerator blocks until the ctx is done.
+type blockingRegenerator struct{}
+
+func (blockingRegenerator) Regenerate(ctx context.Context, rejected *model.TextOut) (*model.TextOut, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestModerationFilter_RegenerateTimeout(t *testing.T) {
+	matcher := wordfilter.NewMatcher()
+	matcher.Add("笨蛋", "insult")
+	f := NewModerationFilter(moderation.NewWordList(matcher, nil), blockingRegenerator{})
+	f.Action = ModerationActionRegenerate
+	f.Fallbacks = []string{"换个话题吧。"}
+	f.MaxRegenerate = 1
+	f.Timeout = 10 * time.Millisecond
+
+	textIn := model.NewTextIn(model.SourceDm, "a", "?", 0)
+	done := make(chan *model.TextOut, 1)
+	go func() { done <- f.check(textIn.Reply("chatbot", "你是笨蛋")) }()
+	select {
+	case got := <-done:
+		if got == nil || got.Content != "换个话题吧。" {
+			t.Errorf("check() = %+v, want the fallback after the regeneration timed out", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("regeneration not bounded by the Timeout")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"muvtuberdriver/model"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ReduceStrategy 决定 PriorityReduceFilter 在一个时间窗口内从收到的消息中选出哪些输出。
+//
+// Select 从 texts (按到达顺序，非空，且不含 PriorityHighest 的消息)
+// 中选出至多 n 条。实现不应修改 texts 本身。
+type ReduceStrategy interface {
+	Select(texts []*model.Text, n int) []*model.Text
+}
+
+// ReduceStrategyFunc 把一个函数适配成无状态的 ReduceStrategy。
+type ReduceStrategyFunc func(texts []*model.Text, n int) []*model.Text
+
+func (f ReduceStrategyFunc) Select(texts []*model.Text, n int) []*model.Text {
+	return f(texts, n)
+}
+
+// reduceStrategies: name -> constructor.
+// 有状态的策略 (如 round_robin) 每个 filter 需要一个新的实例。
+var reduceStrategies = map[string]func() ReduceStrategy{
+	"longest":         func() ReduceStrategy { return ReduceStrategyFunc(selectLongest) },
+	"newest":          func() ReduceStrategy { return ReduceStrategyFunc(selectNewest) },
+	"oldest":          func() ReduceStrategy { return ReduceStrategyFunc(selectOldest) },
+	"weighted_random": func() ReduceStrategy { return ReduceStrategyFunc(selectWeightedRandom) },
+	"round_robin":     func() ReduceStrategy { return NewRoundRobinStrategy() },
+	"question_first":  func() ReduceStrategy { return ReduceStrategyFunc(selectQuestionFirst) },
+}
+
+// DefaultReduceStrategy 是原来的行为：Priority 最高的里面字数最多的。
+const DefaultReduceStrategy = "longest"
+
+// NewReduceStrategy returns a new ReduceStrategy by name.
+// An empty name means DefaultReduceStrategy.
+func NewReduceStrategy(name string) (ReduceStrategy, error) {
+	if name == "" {
+		name = DefaultReduceStrategy
+	}
+	newStrategy, ok := reduceStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reduce strategy %q", name)
+	}
+	return newStrategy(), nil
+}
+
+// maxPriorityOnes 返回 texts 中 Priority 最高的那些，保持原来的顺序。
+func maxPriorityOnes(texts []*model.Text) []*model.Text {
+	var max model.Priority
+	for _, t := range texts {
+		if t.Priority > max {
+			max = t.Priority
+		}
+	}
+	ones := make([]*model.Text, 0, len(texts))
+	for _, t := range texts {
+		if t.Priority == max {
+			ones = append(ones, t)
+		}
+	}
+	return ones
+}
+
+// firstN returns texts[:n] (or all texts if there are fewer).
+func firstN(texts []*model.Text, n int) []*model.Text {
+	if n < len(texts) {
+		return texts[:n]
+	}
+	return texts
+}
+
+// selectLongest: Priority 最高的里面 Content 最长的 n 条。
+func selectLongest(texts []*model.Text, n int) []*model.Text {
+	ones := maxPriorityOnes(texts)
+	sort.SliceStable(ones, func(i, j int) bool {
+		return len(ones[i].Content) > len(ones[j].Content)
+	})
+	return firstN(ones, n)
+}
+
+// selectNewest: Priority 最高的里面最后到达的 n 条。
+func selectNewest(texts []*model.Text, n int) []*model.Text {
+	ones := maxPriorityOnes(texts)
+	for i, j := 0, len(ones)-1; i < j; i, j = i+1, j-1 {
+		ones[i], ones[j] = ones[j], ones[i]
+	}
+	return firstN(ones, n)
+}
+
+// selectOldest: Priority 最高的里面最先到达的 n 条。
+func selectOldest(texts []*model.Text, n int) []*model.Text {
+	return firstN(maxPriorityOnes(texts), n)
+}
+
+// selectWeightedRandom 从所有消息中随机选出 n 条，
+// 被选中的概率正比于 Priority+1 (所以 PriorityLow 也有机会)。
+func selectWeightedRandom(texts []*model.Text, n int) []*model.Text {
+	rest := make([]*model.Text, len(texts))
+	copy(rest, texts)
+
+	selected := make([]*model.Text, 0, n)
+	for len(selected) < n && len(rest) > 0 {
+		total := 0
+		for _, t := range rest {
+			total += weightOf(t)
+		}
+		r := rand.Intn(total)
+		for i, t := range rest {
+			r -= weightOf(t)
+			if r < 0 {
+				selected = append(selected, t)
+				rest = append(rest[:i], rest[i+1:]...)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func weightOf(t *model.Text) int {
+	if t.Priority < 0 {
+		return 1
+	}
+	return int(t.Priority) + 1
+}
+
+// RoundRobinStrategy 在 Priority 最高的消息中，
+// 优先选择最久没有被选中过的作者的消息，让更多观众得到回复。
+type RoundRobinStrategy struct {
+	mu     sync.Mutex
+	turn   int64
+	served map[string]int64 // authorKey -> last turn served
+}
+
+func NewRoundRobinStrategy() *RoundRobinStrategy {
+	return &RoundRobinStrategy{served: map[string]int64{}}
+}
+
+func (s *RoundRobinStrategy) Select(texts []*model.Text, n int) []*model.Text {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ones := maxPriorityOnes(texts)
+	sort.SliceStable(ones, func(i, j int) bool {
+		return s.served[authorKey(ones[i])] < s.served[authorKey(ones[j])]
+	})
+
+	selected := make([]*model.Text, 0, n)
+	seen := map[string]bool{}
+	for _, t := range ones { // one for each author first
+		if len(selected) >= n {
+			break
+		}
+		if a := authorKey(t); !seen[a] {
+			seen[a] = true
+			selected = append(selected, t)
+		}
+	}
+	for _, t := range ones { // still room: more from the same authors
+		if len(selected) >= n {
+			break
+		}
+		if !containsText(selected, t) {
+			selected = append(selected, t)
+		}
+	}
+
+	s.turn++
+	for _, t := range selected {
+		s.served[authorKey(t)] = s.turn
+	}
+	if len(s.served) > 1024 { // forget the ones served long ago
+		for a, turn := range s.served {
+			if s.turn-turn > 1024 {
+				delete(s.served, a)
+			}
+		}
+	}
+	return selected
+}
+
+func containsText(texts []*model.Text, t *model.Text) bool {
+	for _, x := range texts {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// selectQuestionFirst: Priority 最高的里面优先选问题，
+// 同为问题 (或同不为问题) 的选字数多的。
+func selectQuestionFirst(texts []*model.Text, n int) []*model.Text {
+	ones := maxPriorityOnes(texts)
+	questions := make(map[*model.Text]bool, len(ones))
+	for _, t := range ones {
+		questions[t] = isQuestion(t.Content)
+	}
+	sort.SliceStable(ones, func(i, j int) bool {
+		qi, qj := questions[ones[i]], questions[ones[j]]
+		if qi != qj {
+			return qi
+		}
+		return len(ones[i].Content) > len(ones[j].Content)
+	})
+	return firstN(ones, n)
+}
+
+var (
+	// 中文疑问词 / 句末语气词
+	questionWordsZh = []string{
+		"什么", "怎么", "为什么", "为啥", "咋", "谁", "哪", "几点", "几个", "多少", "如何",
+		"是不是", "能不能", "会不会", "有没有", "要不要", "可不可以",
+	}
+	questionEndingsZh = []string{"吗", "呢", "么", "嘛"}
+	// 英文疑问句开头
+	questionStartsEn = []string{
+		"what", "why", "how", "who", "when", "where", "which",
+		"is", "are", "do", "does", "did", "can", "could", "will", "would", "should",
+	}
+)
+
+// isQuestion 是一个简单的问句检测：
+// 有问号，或含中文疑问词，或以疑问语气词结尾，或以英文疑问词开头。
+func isQuestion(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return false
+	}
+	if strings.ContainsAny(text, "?？") {
+		return true
+	}
+	for _, w := range questionWordsZh {
+		if strings.Contains(text, w) {
+			return true
+		}
+	}
+
+	trimmed := strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r)
+	})
+	for _, e := range questionEndingsZh {
+		if strings.HasSuffix(trimmed, e) {
+			return true
+		}
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) // what's -> what
+	})
+	if len(words) == 0 {
+		return false
+	}
+	first := strings.ToLower(words[0])
+	for _, w := range questionStartsEn {
+		if first == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"testing"
+)
+
+func Test_isQuestion(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"你吃饭了吗", true},
+		{"今天唱什么歌", true},
+		{"what's your name", true},
+		{"你好呀", false},
+		{"hello world", false},
+		{"？？", true},
+		{"", false},
+		{"!!!", false},
+	}
+	for _, tt := range tests {
+		if got := isQuestion(tt.text); got != tt.want {
+			t.Errorf("isQuestion(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestReduceStrategies(t *testing.T) {
+	newText := func(author, content string, priority model.Priority) *model.Text {
+		return model.NewTextIn(model.SourceDm, author, content, priority)
+	}
+	a := newText("a", "短", model.PriorityNormal)
+	b := newText("b", "这是一条很长很长的弹幕", model.PriorityNormal)
+	c := newText("a", "你是谁", model.PriorityNormal)
+	low := newText("d", "低优先级的超级长的一条弹幕啊啊啊啊", model.PriorityLow)
+	texts := []*model.Text{a, b, c, low}
+
+	tests := []struct {
+		strategy string
+		n        int
+		want     []*model.Text
+	}{
+		{"longest", 1, []*model.Text{b}},
+		{"oldest", 2, []*model.Text{a, b}},
+		{"newest", 1, []*model.Text{c}},
+		{"question_first", 2, []*model.Text{c, b}},
+		{"round_robin", 2, []*model.Text{a, b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			s, err := NewReduceStrategy(tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.Select(texts, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Select() got %d texts, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Select()[%d] = %q, want %q", i, got[i].Content, tt.want[i].Content)
+				}
+			}
+		})
+	}
+
+	if _, err := NewReduceStrategy("no_such_strategy"); err == nil {
+		t.Error("NewReduceStrategy(unknown): want error")
+	}
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	s := NewRoundRobinStrategy()
+	a1 := model.NewTextIn(model.SourceDm, "a", "a1", model.PriorityNormal)
+	b1 := model.NewTextIn(model.SourceDm, "b", "b1", model.PriorityNormal)
+
+	if got := s.Select([]*model.Text{a1, b1}, 1); got[0] != a1 {
+		t.Fatalf("1st Select() = %q, want a1", got[0].Content)
+	}
+	// a has just been served, b's turn
+	a2 := model.NewTextIn(model.SourceDm, "a", "a2", model.PriorityNormal)
+	b2 := model.NewTextIn(model.SourceDm, "b", "b2", model.PriorityNormal)
+	if got := s.Select([]*model.Text{a2, b2}, 1); got[0] != b2 {
+		t.Errorf("2nd Select() = %q, want b2", got[0].Content)
+	}
+}
+
+func TestWeightedRandomStrategy(t *testing.T) {
+	texts := []*model.Text{
+		model.NewTextIn(model.SourceDm, "a", "a", model.PriorityLow),
+		model.NewTextIn(model.SourceDm, "b", "b", model.PriorityHigh),
+	}
+	got := selectWeightedRandom(texts, 5)
+	if len(got) != 2 || got[0] == got[1] {
+		t.Errorf("selectWeightedRandom() = %v, want 2 distinct texts", got)
+	}
+	if len(texts) != 2 || texts[0].Author != "a" {
+		t.Errorf("selectWeightedRandom() modified its input")
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"muvtuberdriver/audio"
+	"muvtuberdriver/config"
+	"muvtuberdriver/live2d"
+	"muvtuberdriver/model"
+	"muvtuberdriver/persona"
+	"muvtuberdriver/sayer"
+	"muvtuberdriver/transcript"
+	"sort"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/exp/slog"
+)
+
+// filterEnv holds the runtime dependencies that some filters need
+// (e.g. read_dm says the text).
+type filterEnv struct {
+	ctx context.Context // optional: the app context, canceled on shutdown (moderation)
+
+	sayer  sayer.Sayer
+	live2d live2d.Driver
+	audio  audio.Controller
+
+	regenerator Regenerator      // optional: the chatbot to regenerate the rejected answers (moderation)
+	persona     *persona.Manager // optional: the active persona (too_long quibbles)
+
+	transcript *transcript.Recorder // optional: records the Texts passed each filter
+
+	replyObservers []replyObserver // the TextIn filters told the replies said, see observeReply
+}
+
+// replyObserver is a TextIn filter that wants to know the replies said
+// (e.g. AuthorFilter starts the cooldown of an author when answered).
+type replyObserver interface {
+	ObserveReply(textOut *model.TextOut)
+}
+
+// observeReply tells the replyObservers the textOut is said.
+func (env *filterEnv) observeReply(textOut *model.TextOut) {
+	for _, o := range env.replyObservers {
+		o.ObserveReply(textOut)
+	}
+}
+
+// filterFactory builds a filter from the options in config.
+//
+// The returned filter should implement TextInFilter or TextOutFilter (or both).
+// A new filter is built every time the factory is called, so a stateful
+// filter (e.g. PriorityReduceFilter) can appear in a chain several times.
+type filterFactory func(env *filterEnv, options map[string]any) (any, error)
+
+// filterFactories: name -> factory
+var filterFactories = map[string]filterFactory{}
+
+// RegisterFilter registers a filter factory by name, so that it can be
+// used in the config:
+//
+//	filters:
+//	    in:
+//	        - name: priority_reduce
+//	          options:
+//	            duration: 5s
+//
+// The options in config are decoded into O (use mapstructure tags to name
+// the fields in snake_case). Unknown options are rejected. Strings like
+// "5s" are accepted for time.Duration fields.
+func RegisterFilter[O any](name string, build func(env *filterEnv, options O) (any, error)) {
+	if _, ok := filterFactories[name]; ok {
+		panic("RegisterFilter: duplicate filter name: " + name)
+	}
+
+	filterFactories[name] = func(env *filterEnv, options map[string]any) (any, error) {
+		var o O
+		if err := decodeFilterOptions(options, &o); err != nil {
+			return nil, fmt.Errorf("filter %q: bad options: %w", name, err)
+		}
+		return build(env, o)
+	}
+}
+
+// decodeFilterOptions decodes the options map into the typed options o.
+func decodeFilterOptions(options map[string]any, o any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused: true,
+		Result:      o,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(options)
+}
+
+// RegisteredFilters returns the names of all registered filters.
+func RegisteredFilters() []string {
+	names := make([]string, 0, len(filterFactories))
+	for name := range filterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildFilter builds the filter described by cfg.
+func buildFilter(env *filterEnv, cfg config.FilterConfig) (any, error) {
+	factory, ok := filterFactories[cfg.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q (registered: %v)", cfg.Name, RegisteredFilters())
+	}
+	return factory(env, cfg.Options)
+}
+
+// buildTextInFilters builds the TextIn filter chain in order.
+// Disabled filters are skipped.
+func buildTextInFilters(env *filterEnv, cfgs []config.FilterConfig) ([]TextInFilter, error) {
+	var filters []TextInFilter
+	for _, cfg := range cfgs {
+		if cfg.Disabled {
+			continue
+		}
+		f, err := buildFilter(env, cfg)
+		if err != nil {
+			return nil, err
+		}
+		inFilter, ok := f.(TextInFilter)
+		if !ok {
+			return nil, fmt.Errorf("filter %q can not be used to filter TextIn", cfg.Name)
+		}
+		if o, ok := inFilter.(replyObserver); ok && env != nil {
+			env.replyObservers = append(env.replyObservers, o)
+		}
+		if env != nil && env.transcript != nil {
+			recordRejects(env.transcript, "in", cfg.Name, inFilter)
+			inFilter = recordedTextInFilter{inFilter, cfg.Name, env.transcript}
+		}
+		filters = append(filters, inFilter)
+		slog.Info("[filter] TextIn filter added.", "name", cfg.Name, "options", cfg.DesensitizedOptions())
+	}
+	return filters, nil
+}
+
+// buildTextOutFilters builds the TextOut filter chain in order.
+// Disabled filters are skipped.
+func buildTextOutFilters(env *filterEnv, cfgs []config.FilterConfig) ([]TextOutFilter, error) {
+	var filters []TextOutFilter
+	for _, cfg := range cfgs {
+		if cfg.Disabled {
+			continue
+		}
+		f, err := buildFilter(env, cfg)
+		if err != nil {
+			return nil, err
+		}
+		outFilter, ok := f.(TextOutFilter)
+		if !ok {
+			return nil, fmt.Errorf("filter %q can not be used to filter TextOut", cfg.Name)
+		}
+		if env != nil && env.transcript != nil {
+			recordRejects(env.transcript, "out", cfg.Name, outFilter)
+			outFilter = recordedTextOutFilter{outFilter, cfg.Name, env.transcript}
+		}
+		filters = append(filters, outFilter)
+		slog.Info("[filter] TextOut filter added.", "name", cfg.Name, "options", cfg.DesensitizedOptions())
+	}
+	return filters, nil
+}
+
+// closeFilters closes the filters that are io.Closers
+// (e.g. ModerationFilter closes the gRPC connections of its moderators).
+func closeFilters[F any](filters []F) error {
+	var errs []error
+	for _, f := range filters {
+		if closer, ok := any(f).(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chainTextInFilters connects the filters: ch -> filters[0] -> filters[1] -> ... -> chOut
+func chainTextInFilters(ch chan *model.TextIn, filters ...TextInFilter) (chOut chan *model.TextIn) {
+	for _, f := range filters {
+		ch = f.FilterTextIn(ch)
+	}
+	return ch
+}
+
+// chainTextOutFilters connects the filters: ch -> filters[0] -> filters[1] -> ... -> chOut
+func chainTextOutFilters(ch chan *model.TextOut, filters ...TextOutFilter) (chOut chan *model.TextOut) {
+	for _, f := range filters {
+		ch = f.FilterTextOut(ch)
+	}
+	return ch
+}
+
+// region builtin filters
+
+type noOptions struct{}
+
+type priorityReduceOptions struct {
+	Duration time.Duration `mapstructure:"duration"`
+	Strategy string        `mapstructure:"strategy"` // longest (default), newest, oldest, weighted_random, round_robin, question_first
+	Count    int           `mapstructure:"count"`    // 每个窗口最多输出几条: 1 by default
+}
+
+type tooLongOptions struct {
+	MaxWords int      `mapstructure:"max_words"`
+	Quibbles []string `mapstructure:"quibbles"` // mode=drop: 丢弃后随机说一句
+
+	Mode      string `mapstructure:"mode"`       // drop (默认): 弃之，随机抱怨 | split: 按句子切成若干段输出
+	MaxChunks int    `mapstructure:"max_chunks"` // mode=split: 最多保留几段，0 则不限
+	Cutoff    string `mapstructure:"cutoff"`     // mode=split: 段数超过 max_chunks 被截断时说的话
+}
+
+type readDmOptions struct {
+	Motion string `mapstructure:"motion"` // live2d motion before reading: "flick_head" by default
+}
+
+func init() {
+	// chinese: 只允许包含中文的 text
+	RegisterFilter("chinese", func(env *filterEnv, o noOptions) (any, error) {
+		return TextFilterFunc(chineseFilter), nil
+	})
+
+	// priority_reduce: 每 duration 选出一些消息输出
+	RegisterFilter("priority_reduce", func(env *filterEnv, o priorityReduceOptions) (any, error) {
+		if o.Duration <= 0 {
+			return nil, fmt.Errorf("priority_reduce: duration should be positive, got %v", o.Duration)
+		}
+		strategy, err := NewReduceStrategy(o.Strategy)
+		if err != nil {
+			return nil, fmt.Errorf("priority_reduce: %w", err)
+		}
+		if o.Count < 0 {
+			return nil, fmt.Errorf("priority_reduce: count should not be negative, got %v", o.Count)
+		}
+		f := NewPriorityReduceFilter(o.Duration)
+		f.Discard = IsSuperChatDeleted
+		f.Strategy = strategy
+		if o.Count > 0 {
+			f.Count = o.Count
+		}
+		return f, nil
+	})
+
+	// too_long: 文本太长了，弃之，随机抱怨；或者切成若干段说
+	RegisterFilter("too_long", func(env *filterEnv, o tooLongOptions) (any, error) {
+		switch o.Mode {
+		case "", "drop":
+		case "split":
+			if o.MaxWords <= 0 {
+				return nil, fmt.Errorf("too_long: max_words should be positive in split mode, got %v", o.MaxWords)
+			}
+			return NewTooLongSplitFilter(o.MaxWords, o.MaxChunks, o.Cutoff), nil
+		default:
+			return nil, fmt.Errorf("too_long: unknown mode %q", o.Mode)
+		}
+
+		tooLongFilter := NewTooLongFilter(o.MaxWords, o.Quibbles)
+		if env != nil && env.persona != nil {
+			tooLongFilter.QuibblesFrom = env.persona.Quibbles
+		}
+		return tooLongFilter.TextFilterFunc(func(text, quibble *string) {
+			if env == nil || env.sayer == nil {
+				return
+			}
+			if quibble != nil {
+				env.sayer.Say(*quibble)
+			} else {
+				env.sayer.Say("这是禁止事项。")
+			}
+		}), nil
+	})
+
+	// read_dm: 复读评论
+	RegisterFilter("read_dm", func(env *filterEnv, o readDmOptions) (any, error) {
+		if env == nil || env.sayer == nil || env.live2d == nil {
+			return nil, fmt.Errorf("read_dm: sayer and live2d are required")
+		}
+		if o.Motion == "" {
+			o.Motion = "flick_head"
+		}
+		return TextInFilterFunc(func(textIn *model.TextIn) bool {
+			if IsSuperChatDeleted(textIn) {
+				return true // DeletedSuperChatFilter will drop it
+			}
+			env.live2d.Live2dToMotion(o.Motion) // 准备张嘴说话
+			env.sayer.Say(textIn.Content)
+			return true
+		}), nil
+	})
+}
+
+// endregion builtin filters
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"muvtuberdriver/config"
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+func Test_buildTextInFilters(t *testing.T) {
+	filters, err := buildTextInFilters(nil, []config.FilterConfig{
+		{Name: "chinese"},
+		{Name: "priority_reduce", Options: map[string]any{"duration": "5s"}},
+		{Name: "too_long", Options: map[string]any{"max_words": 10}, Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 2 {
+		t.Fatalf("len(filters) = %d, want 2", len(filters))
+	}
+	reduce, ok := filters[1].(*PriorityReduceFilter)
+	if !ok {
+		t.Fatalf("filters[1] is %T, want *PriorityReduceFilter", filters[1])
+	}
+	if reduce.duration != 5*time.Second {
+		t.Errorf("duration = %v, want 5s", reduce.duration)
+	}
+}
+
+func Test_buildTextInFiltersErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.FilterConfig
+	}{
+		{"unknownFilter", config.FilterConfig{Name: "no_such_filter"}},
+		{"unknownOption", config.FilterConfig{Name: "priority_reduce", Options: map[string]any{"duration": "5s", "foo": 1}}},
+		{"badOption", config.FilterConfig{Name: "priority_reduce", Options: map[string]any{"duration": "five seconds"}}},
+		{"missingOption", config.FilterConfig{Name: "priority_reduce"}},
+		{"missingEnv", config.FilterConfig{Name: "read_dm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildTextInFilters(&filterEnv{}, []config.FilterConfig{tt.cfg}); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
+
+func Test_chainTextInFilters(t *testing.T) {
+	filters, err := buildTextInFilters(nil, []config.FilterConfig{
+		{Name: "chinese"},
+		{Name: "too_long", Options: map[string]any{"max_words": 5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chIn := make(chan *model.TextIn, 3)
+	chOut := chainTextInFilters(chIn, filters...)
+
+	chIn <- model.NewTextIn(model.SourceDm, "a", "hello", 0)    // not chinese
+	chIn <- model.NewTextIn(model.SourceDm, "b", "一二三四五六七八", 0) // too long
+	chIn <- model.NewTextIn(model.SourceDm, "c", "你好", 0)       // ok
+
+	select {
+	case got := <-chOut:
+		if got.Author != "c" {
+			t.Errorf("got %v, want the one from c", got.Author)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func Test_commandFilter(t *testing.T) {
+	filters, err := buildTextInFilters(&filterEnv{}, []config.FilterConfig{
+		{Name: "command", Options: map[string]any{
+			"commands": map[string]any{
+				"ask": map[string]any{"args": map[string]string{"boost": "1"}, "cooldown": "10s"},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chIn := make(chan *model.TextIn, 2)
+	chOut := chainTextInFilters(chIn, filters...)
+
+	chIn <- model.NewTextIn(model.SourceDm, "a", "!ask 你是谁", 0)
+	chIn <- model.NewTextIn(model.SourceDm, "b", "你好", 0)
+
+	for _, want := range []string{"你是谁", "你好"} {
+		select {
+		case got := <-chOut:
+			if got.Content != want {
+				t.Errorf("got %q, want %q", got.Content, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	// motion needs live2d; unknown handler
+	for _, commands := range []map[string]any{
+		{"motion": map[string]any{}},
+		{"dance": map[string]any{}},
+	} {
+		_, err := buildTextInFilters(&filterEnv{}, []config.FilterConfig{
+			{Name: "command", Options: map[string]any{"commands": commands}},
+		})
+		if err == nil {
+			t.Errorf("commands %v: want error, got nil", commands)
+		}
+	}
+}
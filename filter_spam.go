@@ -0,0 +1,191 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/textsim"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// Spam drop reasons
+const (
+	SpamReasonEmpty     = "empty"       // nothing left after normalization
+	SpamReasonDuplicate = "duplicate"   // similar to a recent message
+	SpamReasonRepeated  = "repeated"    // mostly repeated characters: 哈哈哈哈, 666
+	SpamReasonRate      = "author_rate" // the author sends too many messages
+)
+
+// SpamFilter 丢弃刷屏的弹幕。
+//
+// 它记录最近 Window 时间内收到的消息，丢弃:
+//   - 与最近的消息相似 (textsim.Similarity >= SimilarityThreshold) 的;
+//   - 大部分是重复字符 (textsim.RepeatRatio >= MaxRepeatRatio) 的;
+//   - 作者在 Window 内发送超过 MaxPerAuthor 条的。
+//
+// 付费消息 (SC、礼物、上舰) 永远不会被当作刷屏。
+// 丢弃的数量按原因统计，见 Stats。
+type SpamFilter struct {
+	Window              time.Duration
+	SimilarityThreshold float64 // 0 to disable
+	MaxRepeatRatio      float64 // 0 to disable
+	MinRepeatLen        int     // only check RepeatRatio for texts of at least MinRepeatLen runes
+	MaxPerAuthor        int     // 0 to disable
+
+	mu     sync.Mutex
+	recent []spamRecord
+	stats  map[string]int
+}
+
+type spamRecord struct {
+	at         time.Time
+	author     string
+	normalized string
+	shingles   map[string]struct{}
+}
+
+func NewSpamFilter(window time.Duration) *SpamFilter {
+	return &SpamFilter{
+		Window:              window,
+		SimilarityThreshold: 0.8,
+		MaxRepeatRatio:      0.8,
+		MinRepeatLen:        3,
+		MaxPerAuthor:        5,
+		stats:               map[string]int{},
+	}
+}
+
+// Check returns "" if the textIn is not spam.
+// Otherwise, it returns the reason (SpamReason*).
+//
+// All the checked messages (spam or not) are recorded into the window.
+func (f *SpamFilter) Check(textIn *model.TextIn) (reason string) {
+	switch textIn.Source {
+	case model.SourceSuperChat, model.SourceGift, model.SourceMember:
+		return "" // paid
+	}
+
+	normalized := textsim.Normalize(textIn.Content)
+	record := spamRecord{
+		at:         time.Now(),
+		author:     authorKey(textIn),
+		normalized: normalized,
+		shingles:   textsim.Shingles(normalized, 2),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.expire(record.at)
+	defer func() {
+		f.recent = append(f.recent, record)
+		if reason != "" {
+			f.stats[reason]++
+		}
+	}()
+
+	if normalized == "" {
+		return SpamReasonEmpty
+	}
+
+	if f.MaxRepeatRatio > 0 && utf8.RuneCountInString(normalized) >= f.MinRepeatLen &&
+		textsim.RepeatRatio(normalized) >= f.MaxRepeatRatio {
+		return SpamReasonRepeated
+	}
+
+	authorCount := 0
+	for _, r := range f.recent {
+		if r.author == record.author {
+			authorCount++
+		}
+		if f.SimilarityThreshold > 0 && textsim.Jaccard(r.shingles, record.shingles) >= f.SimilarityThreshold {
+			return SpamReasonDuplicate
+		}
+	}
+	if f.MaxPerAuthor > 0 && authorCount >= f.MaxPerAuthor {
+		return SpamReasonRate
+	}
+
+	return ""
+}
+
+// expire forgets the records older than Window. The caller should hold the lock.
+func (f *SpamFilter) expire(now time.Time) {
+	i := 0
+	for i < len(f.recent) && now.Sub(f.recent[i].at) > f.Window {
+		i++
+	}
+	f.recent = f.recent[i:]
+}
+
+// Stats returns the number of dropped messages by reasons.
+func (f *SpamFilter) Stats() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make(map[string]int, len(f.stats))
+	for k, v := range f.stats {
+		stats[k] = v
+	}
+	return stats
+}
+
+func (f *SpamFilter) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	return filterChan(chIn, func(textIn *model.TextIn) bool {
+		if textIn == nil {
+			return false
+		}
+		reason := f.Check(textIn)
+		if reason == "" {
+			return true
+		}
+		slog.Info("[SpamFilter] drop spam.",
+			"reason", reason,
+			"author", textIn.Author,
+			"content", ellipsis.Centering(textIn.Content, 17),
+			"stats", f.Stats())
+		return false
+	})
+}
+
+// authorKey identifies the author: AuthorID if available, or the name.
+func authorKey(t *model.Text) string {
+	if t.AuthorID != "" {
+		return t.AuthorID
+	}
+	return t.Author
+}
+
+type spamOptions struct {
+	Window              time.Duration `mapstructure:"window"`
+	SimilarityThreshold *float64      `mapstructure:"similarity_threshold"`
+	MaxRepeatRatio      *float64      `mapstructure:"max_repeat_ratio"`
+	MinRepeatLen        *int          `mapstructure:"min_repeat_len"`
+	MaxPerAuthor        *int          `mapstructure:"max_per_author"`
+}
+
+func init() {
+	// spam: 刷屏、重复弹幕过滤。未设置的选项使用 NewSpamFilter 的默认值
+	RegisterFilter("spam", func(env *filterEnv, o spamOptions) (any, error) {
+		if o.Window <= 0 {
+			o.Window = 30 * time.Second
+		}
+		f := NewSpamFilter(o.Window)
+		if o.SimilarityThreshold != nil {
+			f.SimilarityThreshold = *o.SimilarityThreshold
+		}
+		if o.MaxRepeatRatio != nil {
+			f.MaxRepeatRatio = *o.MaxRepeatRatio
+		}
+		if o.MinRepeatLen != nil {
+			f.MinRepeatLen = *o.MinRepeatLen
+		}
+		if o.MaxPerAuthor != nil {
+			f.MaxPerAuthor = *o.MaxPerAuthor
+		}
+		return f, nil
+	})
+}
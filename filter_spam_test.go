@@ -0,0 +1,61 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+func TestSpamFilter_Check(t *testing.T) {
+	f := NewSpamFilter(time.Minute)
+	f.MaxPerAuthor = 2
+
+	tests := []struct {
+		author  string
+		content string
+		source  model.Source
+		want    string
+	}{
+		{"a", "主播今天唱什么歌", model.SourceDm, ""},
+		{"b", "主播今天唱什么歌？", model.SourceDm, SpamReasonDuplicate},
+		{"c", "哈哈哈哈哈", model.SourceDm, SpamReasonRepeated},
+		{"d", "666", model.SourceDm, SpamReasonRepeated},
+		{"e", "！！！", model.SourceDm, SpamReasonEmpty},
+		{"a", "晚饭吃了吗", model.SourceDm, ""},
+		{"a", "明天几点开播", model.SourceDm, SpamReasonRate},
+		{"f", "我送给你1个小花花。", model.SourceGift, ""},
+		{"g", "我送给你1个小花花。", model.SourceGift, ""},
+		{"h", "好", model.SourceDm, ""},
+	}
+	for i, tt := range tests {
+		textIn := model.NewTextIn(tt.source, tt.author, tt.content, model.PriorityLow)
+		if got := f.Check(textIn); got != tt.want {
+			t.Errorf("#%d Check(%q) = %q, want %q", i, tt.content, got, tt.want)
+		}
+	}
+
+	stats := f.Stats()
+	want := map[string]int{
+		SpamReasonDuplicate: 1,
+		SpamReasonRepeated:  2,
+		SpamReasonEmpty:     1,
+		SpamReasonRate:      1,
+	}
+	for reason, n := range want {
+		if stats[reason] != n {
+			t.Errorf("Stats()[%q] = %d, want %d", reason, stats[reason], n)
+		}
+	}
+}
+
+func TestSpamFilter_Window(t *testing.T) {
+	f := NewSpamFilter(10 * time.Millisecond)
+
+	if reason := f.Check(model.NewTextIn(model.SourceDm, "a", "你好呀", 0)); reason != "" {
+		t.Fatalf("first message: %q", reason)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if reason := f.Check(model.NewTextIn(model.SourceDm, "b", "你好呀", 0)); reason != "" {
+		t.Errorf("same message after the window: %q, want not spam", reason)
+	}
+}
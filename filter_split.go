@@ -0,0 +1,147 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"muvtuberdriver/pkg/sentence"
+	"strings"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// TooLongSplitFilter 是 TooLongFilter 的另一种模式：
+// 太长的 TextOut 不再整个丢掉，而是在句子边界切成若干段 (每段不超过 MaxWords)，
+// 依次作为连续的 TextOut 输出。
+//
+// 最多保留 MaxChunks 段，多出来的丢掉，这时如果 Cutoff 非空，会再多说一句 Cutoff。
+//
+// 切出来的每一段都有新的 ID，Metadata 中 MetaChunkOf 为原 TextOut 的 ID，
+// PriorityReduceFilter 会把同一个 TextOut 切出来的段一起输出。
+type TooLongSplitFilter struct {
+	MaxWords  int    // 每段的最大字数 (中文字符数 + 英文单词数)，同 tooLong
+	MaxChunks int    // 最多保留几段，0 则不限
+	Cutoff    string // 被截断时最后说的话，例如 "后面的就不念了。"，留空则不说
+}
+
+func NewTooLongSplitFilter(maxWords, maxChunks int, cutoff string) *TooLongSplitFilter {
+	return &TooLongSplitFilter{
+		MaxWords:  maxWords,
+		MaxChunks: maxChunks,
+		Cutoff:    cutoff,
+	}
+}
+
+func (f *TooLongSplitFilter) FilterTextOut(chIn chan *model.TextOut) (chOut chan *model.TextOut) {
+	chOut = make(chan *model.TextOut, RecvMsgChanBuf)
+	go func() {
+		for textOut := range chIn {
+			if textOut == nil {
+				continue
+			}
+			for _, chunk := range f.Split(textOut) {
+				chOut <- chunk
+			}
+		}
+	}()
+	return chOut
+}
+
+// Split returns the chunks of the textOut.
+// If the textOut is not too long, it's returned as is.
+func (f *TooLongSplitFilter) Split(textOut *model.TextOut) []*model.TextOut {
+	if !tooLong(textOut.Content, f.MaxWords) {
+		return []*model.TextOut{textOut}
+	}
+
+	contents := splitIntoChunks(textOut.Content, f.MaxWords)
+	truncated := false
+	if f.MaxChunks > 0 && len(contents) > f.MaxChunks {
+		contents = contents[:f.MaxChunks]
+		truncated = true
+	}
+	if truncated && f.Cutoff != "" {
+		contents = append(contents, f.Cutoff)
+	}
+
+	slog.Info("[TooLongSplitFilter] text is too long, split into chunks",
+		"text", ellipsis.Centering(textOut.Content, 17),
+		"chunks", len(contents),
+		"truncated", truncated)
+
+	textOut.EnsureID()
+	chunks := make([]*model.TextOut, 0, len(contents))
+	for i, content := range contents {
+		chunk := *textOut
+		chunk.ID = model.NewID()
+		chunk.Content = content
+		chunk.Metadata = make(map[string]any, len(textOut.Metadata)+2)
+		for k, v := range textOut.Metadata {
+			chunk.Metadata[k] = v
+		}
+		chunk.SetMeta(model.MetaChunkOf, textOut.ID)
+		chunk.SetMeta(model.MetaChunkIndex, i)
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
+
+// splitIntoChunks splits text at sentence boundaries into chunks of
+// at most maxWords words (counted by countWords).
+//
+// A sentence longer than maxWords is split at clause separators (commas),
+// and then, if still too long, cut hard.
+func splitIntoChunks(text string, maxWords int) []string {
+	var pieces []string
+	for _, s := range sentence.Split(text) {
+		if !tooLong(s, maxWords) {
+			pieces = append(pieces, s)
+			continue
+		}
+		for _, c := range sentence.SplitClauses(s) {
+			if !tooLong(c, maxWords) {
+				pieces = append(pieces, c)
+				continue
+			}
+			pieces = append(pieces, cutHard(c, maxWords)...)
+		}
+	}
+
+	// greedy: pack as many pieces as possible into a chunk
+	var chunks []string
+	var current []string
+	for _, p := range pieces {
+		if len(current) > 0 && tooLong(sentence.Join(append(current, p)), maxWords) {
+			chunks = append(chunks, sentence.Join(current))
+			current = current[:0]
+		}
+		current = append(current, p)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, sentence.Join(current))
+	}
+	return chunks
+}
+
+// cutHard cuts text into pieces of at most maxWords words,
+// regardless of the sentence boundaries.
+// It tries to cut at a space, to keep the English words whole.
+func cutHard(text string, maxWords int) []string {
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := 1
+		for n < len(runes) && !tooLong(string(runes[:n+1]), maxWords) {
+			n++
+		}
+		if n < len(runes) {
+			if sp := strings.LastIndexFunc(string(runes[:n]), func(r rune) bool { return r == ' ' }); sp > 0 {
+				n = len([]rune(string(runes[:n])[:sp]))
+			}
+		}
+		if piece := strings.TrimSpace(string(runes[:n])); piece != "" {
+			pieces = append(pieces, piece)
+		}
+		runes = runes[n:]
+	}
+	return pieces
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"muvtuberdriver/model"
+	"reflect"
+	"testing"
+)
+
+func Test_splitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxWords int
+		want     []string
+	}{
+		{"packSentences", "一二三。四五。六七八九。", 7, []string{"一二三。四五。", "六七八九。"}},
+		{"english", "one two. three four. five six.", 4, []string{"one two.", "three four.", "five six."}},
+		{"clauses", "一二三，四五六，七八九。", 4, []string{"一二三，", "四五六，", "七八九。"}},
+		{"cutHard", "一二三四五六七", 3, []string{"一二三", "四五六", "七"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitIntoChunks(tt.text, tt.maxWords)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitIntoChunks() = %q, want %q", got, tt.want)
+			}
+			for _, c := range got {
+				if tooLong(c, tt.maxWords) {
+					t.Errorf("chunk %q is too long", c)
+				}
+			}
+		})
+	}
+}
+
+func TestTooLongSplitFilter_Split(t *testing.T) {
+	f := NewTooLongSplitFilter(4, 2, "不念了。")
+
+	short := model.NewTextIn(model.SourceDm, "a", "q", 0).Reply("bot", "短。")
+	if got := f.Split(short); len(got) != 1 || got[0] != short {
+		t.Errorf("Split(short) = %v, want itself", got)
+	}
+
+	long := model.NewTextIn(model.SourceDm, "a", "q", 0).Reply("bot", "一二三。四五六。七八九。")
+	got := f.Split(long)
+
+	var contents []string
+	for _, c := range got {
+		contents = append(contents, c.Content)
+		if c.Meta(model.MetaChunkOf) != long.ID {
+			t.Errorf("chunk %q: chunk_of = %v, want %v", c.Content, c.Meta(model.MetaChunkOf), long.ID)
+		}
+		if c.ReplyTo != long.ReplyTo {
+			t.Errorf("chunk %q: ReplyTo changed", c.Content)
+		}
+	}
+	if want := []string{"一二三。", "四五六。", "不念了。"}; !reflect.DeepEqual(contents, want) {
+		t.Errorf("Split(long) = %q, want %q", contents, want)
+	}
+}
+
+func Test_withChunkSiblings(t *testing.T) {
+	long := model.NewTextIn(model.SourceDm, "a", "q", 0).Reply("bot", "一二三。四五六。")
+	chunks := NewTooLongSplitFilter(4, 0, "").Split(long)
+	other := model.NewTextIn(model.SourceDm, "b", "other", 0)
+	all := []*model.Text{chunks[0], other, chunks[1]}
+
+	got := withChunkSiblings([]*model.Text{chunks[1]}, all)
+	if want := []*model.Text{chunks[0], chunks[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withChunkSiblings() = %v, want the 2 chunks", got)
+	}
+}
@@ -17,6 +17,9 @@ import (
 //	Content-Type: application/json
 //	{ "author": "author", "content": "content" }
 //
+// The id and timestamp are generated if missing, and the source
+// defaults to model.SourceHTTP.
+//
 // routePath is the path of the route, default is "/".
 func TextInFromHTTP(addr string, routePath string, textInChan chan<- *model.TextIn) {
 	if strings.TrimSpace(routePath) == "" {
@@ -33,7 +36,13 @@ func TextInFromHTTP(addr string, routePath string, textInChan chan<- *model.Text
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		slog.Info("[TextInFromHTTP] recv TextIn from HTTP.", "author", textIn.Author, "priority", textIn.Priority, "content", textIn.Content)
+		textIn.EnsureID()
+		textIn.ReplyTo = nil
+		if textIn.Source == "" {
+			textIn.Source = model.SourceHTTP
+		}
+
+		slog.Info("[TextInFromHTTP] recv TextIn from HTTP.", "id", textIn.ID, "author", textIn.Author, "priority", textIn.Priority, "content", textIn.Content)
 		textInChan <- &textIn
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
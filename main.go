@@ -1,8 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"fmt"
 	"log"
 	"math/rand"
 	"muvtuberdriver/audio"
@@ -10,10 +11,17 @@ import (
 	"muvtuberdriver/config"
 	"muvtuberdriver/live2d"
 	"muvtuberdriver/model"
+	"muvtuberdriver/persona"
+	"muvtuberdriver/pkg/ratelimit"
+	"muvtuberdriver/queue"
 	"muvtuberdriver/sayer"
+	"muvtuberdriver/transcript"
 	"net/http"
 	"os"
+	"os/signal"
 	"reflect"
+	"syscall"
+	"time"
 
 	"golang.org/x/exp/slog"
 )
@@ -29,6 +37,15 @@ var (
 var Config = config.UseConfig()
 
 func main() {
+	// subcommands: muvtuberdriver export -dir ... (see exportMain)
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := exportMain(os.Args[2:]); err != nil {
+			slog.Error("export failed.", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	if *genExampleConfig {
@@ -52,8 +69,9 @@ func main() {
 		os.Exit(0)
 	}
 
-	os.Setenv("COOLDOWN_INTERVAL", fmt.Sprintf("%v", Config.Chatbot.Chatgpt.GetCooldownDuraton()))
-	slog.Info("set COOLDOWN_INTERVAL from config value.", "COOLDOWN_INTERVAL", os.Getenv("COOLDOWN_INTERVAL"))
+	// canceled on SIGINT / SIGTERM: stop chatting and shut down cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	textInChan := make(chan *model.TextIn, RecvMsgChanBuf)
 	textOutChan := make(chan *model.TextOut, RecvMsgChanBuf)
@@ -74,55 +92,145 @@ func main() {
 		sayer.WithLipsyncStrategy(Config.Sayer.GetLipsyncStrategy()))
 
 	// (dm) & (http) -> in
-	if Config.Blivedm.Roomid != 0 {
-		go TextInFromDm(Config.Blivedm.Roomid, textInChan, WithBlivedmServer(Config.Blivedm.Server))
+	dmOpts := []BlivedmClientOption{
+		WithGiftTemplate(Config.Blivedm.GiftTemplate),
+		WithGiftMinCoin(Config.Blivedm.GiftMinCoin),
+		WithMemberTemplate(Config.Blivedm.MemberTemplate),
+	}
+	switch Config.Blivedm.Protocol {
+	case "bilibili":
+		if Config.Blivedm.Bilibili.RoomID != 0 {
+			dmOpts = append(dmOpts, WithBilibiliServer(Config.Blivedm.Bilibili.Server))
+			go TextInFromBilibili(Config.Blivedm.Bilibili.RoomID, textInChan, dmOpts...)
+		}
+	default: // "blivechat"
+		if Config.Blivedm.Roomid != 0 {
+			dmOpts = append(dmOpts, WithBlivedmServer(Config.Blivedm.Server))
+			go TextInFromDm(Config.Blivedm.Roomid, textInChan, dmOpts...)
+		}
 	}
 	if Config.Listen.TextInHttp != "" {
 		go TextInFromHTTP(Config.Listen.TextInHttp, "/", textInChan)
 	}
 
-	// in -> filter -> in
-	textInFiltered := textInChan
-	// textInFiltered = ChineseFilter4TextIn.FilterTextIn(textInFiltered)
-	textInFiltered = NewPriorityReduceFilter(Config.GetReduceDuration()).FilterTextIn(textInFiltered)
-
-	// read dm
-	textInFiltered = TextFilterFunc(func(text string) bool {
-		if !Config.ReadDm {
-			return true
+	// transcript: in -> filters -> chatbot -> filters -> say
+	var rec *transcript.Recorder // nil: disabled
+	if Config.Transcript.Enabled {
+		var err error
+		rec, err = transcript.Open(Config.Transcript.Dir,
+			transcript.WithMaxSize(Config.Transcript.GetMaxSizeBytes()))
+		if err != nil {
+			log.Fatal(err)
 		}
-		live2d.Live2dToMotion("flick_head") // 准备张嘴说话
-		sayer.Say(text)
-		return true
-	}).FilterTextIn(textInFiltered)
+		defer rec.Close()
+		slog.Info("[transcript] recording.", "dir", Config.Transcript.Dir)
+	}
+
+	// persona: switched at runtime by the admin API
+	var personas *persona.Manager // nil: disabled
+	if Config.Persona.Enabled {
+		var err error
+		personas, err = persona.NewManager(Config.Persona.Dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// filters: see config.GetFilters & RegisterFilter
+	filters := Config.GetFilters()
+	env := &filterEnv{ctx: ctx, sayer: sayer, live2d: live2d, audio: audioController, transcript: rec, persona: personas}
+
+	inFilters, err := buildTextInFilters(env, filters.In)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// in -> filter -> in
+	textInReceived := textInChan
+	if rec != nil {
+		textInReceived = recordTextIns(rec, textInChan)
+	}
+	textInFiltered := chainTextInFilters(textInReceived, inFilters...)
+
+	// SC deleted while waiting
+	textInFiltered = DeletedSuperChatFilter.FilterTextIn(textInFiltered)
 
 	// in -> chatbot -> out
-	pchatbot, err := initPrioritizedChatbot()
+	var chatbotOpts []chatbot.PrioritizedChatbotOption
+	if rec != nil {
+		chatbotOpts = append(chatbotOpts, chatbot.WithChatObserver(rec.RecordChat))
+	}
+	pchatbot, err := initPrioritizedChatbot(chatbotOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the TextOut filters are built after the chatbot: moderation regenerates with it
+	env.regenerator = pchatbot
+	outFilters, err := buildTextOutFilters(env, filters.Out)
 	if err != nil {
 		log.Fatal(err)
 	}
-	go chatbot.TextOutFromChatbot(pchatbot, textInFiltered, textOutChan)
 
-	// out -> filter -> out
-	textOutFiltered := textOutChan
-	// textOutFiltered := ChineseFilter4TextOut.FilterTextOut(textOutChan)
-
-	// too long: no say
-	tooLongFilter := NewTooLongFilter(Config.TooLong.MaxWords, Config.TooLong.Quibbles)
-	textOutFiltered = tooLongFilter.TextFilterFunc(func(text, quibble *string) {
-		if quibble != nil {
-			sayer.Say(*quibble)
+	setupPersona(personas, Config.Persona.Default, pchatbot, sayer, Config.Sayer.Role)
+	if Config.Listen.Admin != "" {
+		go AdminServer(Config.Listen.Admin, Config.Listen.AdminToken, personas)
+	}
+
+	if interval := Config.Chatbot.GetHealthCheckInterval(); interval > 0 {
+		go chatbot.WatchHealth(ctx, interval)
+	}
+	order, err := chatbot.ParseOrder(Config.Chatbot.Order)
+	if err != nil {
+		log.Fatal(err)
+	}
+	workerOpts := []chatbot.WorkerOption{
+		chatbot.WithWorkers(Config.Chatbot.Workers),
+		chatbot.WithOrder(order),
+		chatbot.WithMaxAge(Config.Chatbot.GetMaxAge()),
+	}
+	if Config.Queue.Enabled {
+		// pull: in -> queue -> chatbot
+		q := queue.New(
+			queue.WithCapacity(Config.Queue.Capacity),
+			queue.WithAging(Config.Queue.GetAgingInterval()),
+			queue.WithTTL(Config.Queue.GetTTL()),
+			queue.WithDiscard(IsSuperChatDeleted))
+		warnReduceBeforeQueue(filters.In)
+
+		go q.PushFrom(ctx, textInFiltered)
+		if Config.Chatbot.Stream {
+			go chatbot.TextOutFromQueueStream(ctx, pchatbot, q, textOutChan, workerOpts...)
 		} else {
-			sayer.Say("这是禁止事项。")
+			go chatbot.TextOutFromQueue(ctx, pchatbot, q, textOutChan, workerOpts...)
 		}
-	}).FilterTextOut(textOutFiltered)
+	} else if Config.Chatbot.Stream {
+		go chatbot.TextOutFromChatbotStream(ctx, pchatbot, textInFiltered, textOutChan, workerOpts...)
+	} else {
+		go chatbot.TextOutFromChatbot(ctx, pchatbot, textInFiltered, textOutChan, workerOpts...)
+	}
+	if Config.Chatbot.Stream {
+		warnReduceInStream(filters.Out)
+	}
 
-	textOutFiltered = NewPriorityReduceFilter(Config.GetReduceDuration()).FilterTextOut(textOutFiltered)
+	// out -> filter -> out
+	textOutFiltered := chainTextOutFilters(textOutChan, outFilters...)
 
 	// out -> (live2d) & (say) & (stdout)
 
 	for {
-		textOut := <-textOutFiltered
+		var textOut *model.TextOut
+		select {
+		case <-ctx.Done():
+			slog.Info("Shutting down.", "cause", ctx.Err())
+			if err := pchatbot.Close(); err != nil {
+				slog.Error("close chatbots failed.", "err", err)
+			}
+			if err := errors.Join(closeFilters(inFilters), closeFilters(outFilters)); err != nil {
+				slog.Error("close filters failed.", "err", err)
+			}
+			return
+		case textOut = <-textOutFiltered:
+		}
 
 		if textOut == nil {
 			continue
@@ -130,9 +238,11 @@ func main() {
 
 		// fmt.Println(*textOut)
 		slog.Info("[textOut]",
+			"id", textOut.ID,
 			"author", textOut.Author,
 			"priority", textOut.Priority,
-			"content", textOut.Content)
+			"content", textOut.Content,
+			"latency", textOut.Latency())
 
 		// emotext result breaks the lipsync
 		// TODO: emotext on muvtuberdriver side, not on live2ddriver side
@@ -141,6 +251,8 @@ func main() {
 		}
 
 		sayer.Say(textOut.Content)
+		rec.RecordSay(textOut)
+		env.observeReply(textOut)
 
 		if Config.TextOutHttp.Server != "" {
 			if rand.Intn(100) >= Config.TextOutHttp.DropRate {
@@ -152,6 +264,31 @@ func main() {
 	}
 }
 
+// warnReduceBeforeQueue warns if a priority_reduce is still in the TextIn
+// filter chain when the queue is enabled: the reduce filter drops the
+// messages not chosen in its window before they could wait in the queue.
+func warnReduceBeforeQueue(in []config.FilterConfig) {
+	for _, f := range in {
+		if f.Name == "priority_reduce" && !f.Disabled {
+			slog.Warn("[queue] priority_reduce in TextIn filters drops messages before they are queued. Consider disabling it.")
+			return
+		}
+	}
+}
+
+// warnReduceInStream warns if a priority_reduce is in the TextOut filter
+// chain when the chatbot is streaming: it holds each sentence until its
+// window ends, and may drop the sentences of a reply that fall into
+// different windows.
+func warnReduceInStream(out []config.FilterConfig) {
+	for _, f := range out {
+		if f.Name == "priority_reduce" && !f.Disabled {
+			slog.Warn("[stream] priority_reduce in TextOut filters delays and may drop streamed sentences. Consider disabling it.")
+			return
+		}
+	}
+}
+
 // initChatbotFunc is a type of function that initializes a chatbot.
 //
 // A initChatbotFunc should return a chatbot and nil error if it succeeds.
@@ -161,26 +298,35 @@ func main() {
 type initChatbotFunc func() (chatbot.Chatbot, error)
 
 // initPrioritizedChatbot initializes a prioritized chatbot with all configured chatbots.
+// The extraOpts are applied after the ones from config.
 //
 // It logs the error and continue if a chatbot fails to initialize.
-func initPrioritizedChatbot() (chatbot.Chatbot, error) {
+func initPrioritizedChatbot(extraOpts ...chatbot.PrioritizedChatbotOption) (*chatbot.PrioritizedChatbot, error) {
 	var chatbots []chatbot.Chatbot
+	var opts []chatbot.PrioritizedChatbotOption
 
 	// 按照优先级 从低到高 依次加入 chatbots
 
-	initChatbotFuncs := []initChatbotFunc{
-		initMusharingChatbot,
-		initChatgptChatbot,
+	initChatbotFuncs := []struct {
+		init    initChatbotFunc
+		timeout time.Duration
+	}{
+		{initMusharingChatbot, Config.Chatbot.Musharing.GetTimeout()},
+		{initChatgptChatbot, Config.Chatbot.Chatgpt.GetTimeout()},
+		{initOpenAIChatbot, Config.Chatbot.OpenAI.GetTimeout()},
 	}
-	for _, initChatbotFunc := range initChatbotFuncs {
-		bot, err := initChatbotFunc()
+	for _, f := range initChatbotFuncs {
+		bot, err := f.init()
 		if err != nil {
 			slog.Error("init chatbot failed",
-				"initChatbotFunc", reflect.TypeOf(initChatbotFunc).Name(),
+				"initChatbotFunc", reflect.TypeOf(f.init).Name(),
 				"err", err)
 			continue
 		}
 		if bot != nil {
+			if f.timeout > 0 {
+				opts = append(opts, chatbot.WithLevelTimeout(model.Priority(len(chatbots)), f.timeout))
+			}
 			chatbots = append(chatbots, bot)
 		}
 	}
@@ -192,7 +338,20 @@ func initPrioritizedChatbot() (chatbot.Chatbot, error) {
 	for i, bot := range chatbots {
 		chatbotMap[model.Priority(i)] = bot
 	}
-	prioritizedChatbot := chatbot.NewPrioritizedChatbot(chatbotMap)
+
+	// 不论优先级，都失败了就用规则兜底
+	if rules, err := initRuleChatbot(); err != nil {
+		slog.Error("init rule chatbot failed", "err", err)
+	} else if rules != nil {
+		opts = append(opts, chatbot.WithFallback(rules))
+	}
+
+	opts = append(opts,
+		chatbot.WithHedgeDelay(Config.Chatbot.GetHedgeDelay()),
+		chatbot.WithCannedReplies(Config.Chatbot.CannedReplies...))
+	opts = append(opts, extraOpts...)
+
+	prioritizedChatbot := chatbot.NewPrioritizedChatbot(chatbotMap, opts...)
 	return prioritizedChatbot, nil
 }
 
@@ -227,8 +386,119 @@ func initChatgptChatbot() (chatbot.Chatbot, error) {
 		return nil, err
 	}
 
+	lifecycle := chatbot.SessionLifecycle{
+		MaxChats: cfg.Session.MaxChats,
+		MaxAge:   cfg.Session.GetMaxAge(),
+	}
 	chatgptChatbot, err := chatbot.NewChatGPTChatbot(
-		cfg.Server, cfg.GetCooldownDuraton(), cfg.Configs...)
+		cfg.Server, newRateLimiter(cfg.GetCooldownDuraton(), cfg.RateLimit), lifecycle, cfg.Configs...)
+	if err != nil {
+		return nil, err
+	}
+	// the sessions keep the conversation: no transcripts in the prompt
+	bot, err := withMemory(chatgptChatbot, cfg.Memory, chatbot.WithStatefulBackend())
+	if err != nil {
+		return nil, err
+	}
+	return withCache(bot, cfg.Cache)
+}
 
-	return chatgptChatbot, err
+// initOpenAIChatbot initializes an OpenAI-compatible HTTP chatbot if configured.
+//
+// This function directly reads the global Config.
+func initOpenAIChatbot() (chatbot.Chatbot, error) {
+	cfg := Config.Chatbot.OpenAI
+
+	enabled, err := cfg.IsEnabledAndValid()
+	if !enabled {
+		slog.Info("openai chatbot is disabled")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	openaiChatbot, err := chatbot.NewOpenAIChatbot(cfg.OpenAIConfig, newRateLimiter(cfg.GetCooldownDuraton(), cfg.RateLimit))
+	if err != nil {
+		return nil, err
+	}
+	bot, err := withMemory(openaiChatbot, cfg.Memory)
+	if err != nil {
+		return nil, err
+	}
+	return withCache(bot, cfg.Cache)
+}
+
+// initRuleChatbot initializes the rule chatbot if configured.
+//
+// This function directly reads the global Config.
+func initRuleChatbot() (chatbot.Chatbot, error) {
+	cfg := Config.Chatbot.Rules
+
+	enabled, err := cfg.IsEnabledAndValid()
+	if !enabled {
+		slog.Info("rule chatbot is disabled")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ruleChatbot, err := chatbot.LoadRuleChatbot(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	return ruleChatbot, nil
+}
+
+// withMemory wraps the chatbot with a MemoryChatbot if the memory is enabled.
+func withMemory(bot chatbot.Chatbot, cfg config.MemoryConfig, opts ...chatbot.MemoryOption) (chatbot.Chatbot, error) {
+	if !cfg.Enabled {
+		return bot, nil
+	}
+
+	opts = append([]chatbot.MemoryOption{
+		chatbot.WithMemoryBudget(cfg.Budget),
+		chatbot.WithMemoryLimits(cfg.RoomTurns, cfg.AuthorTurns, cfg.MaxAuthors),
+		chatbot.WithMemoryFile(cfg.File, cfg.GetSaveInterval()),
+	}, opts...)
+	memoryChatbot, err := chatbot.NewMemoryChatbot(bot, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return memoryChatbot, nil
+}
+
+// newRateLimiter creates the rate limiter of a chatbot: a call every
+// cooldown, with the burst and the daily quota. nil for no limit.
+func newRateLimiter(cooldown time.Duration, cfg config.RateLimitConfig) *ratelimit.Limiter {
+	if cooldown <= 0 && cfg.DailyQuota <= 0 {
+		return nil
+	}
+	slog.Info("[chatbot] rate limited.", "cooldown", cooldown, "burst", cfg.Burst, "dailyQuota", cfg.DailyQuota)
+	return ratelimit.New(cooldown,
+		ratelimit.WithBurst(cfg.Burst),
+		ratelimit.WithDailyQuota(cfg.DailyQuota))
+}
+
+// withCache wraps the chatbot with a CacheChatbot if the cache is enabled.
+//
+// It should wrap the MemoryChatbot (not the other way around):
+// the memory prompt differs every time, so it never hits.
+// The hits are remembered by the MemoryChatbot as well.
+func withCache(bot chatbot.Chatbot, cfg config.CacheConfig) (chatbot.Chatbot, error) {
+	if !cfg.Enabled {
+		return bot, nil
+	}
+
+	cacheChatbot, err := chatbot.NewCacheChatbot(bot,
+		chatbot.WithCacheTTL(cfg.GetTTL()),
+		chatbot.WithCacheSize(cfg.MaxSize),
+		chatbot.WithCacheVariety(cfg.Variety),
+		chatbot.WithCacheFuzzy(cfg.Similarity),
+		chatbot.WithCacheFile(cfg.File, cfg.GetSaveInterval()))
+	if err != nil {
+		return nil, err
+	}
+	return cacheChatbot, nil
 }
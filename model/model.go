@@ -1,9 +1,31 @@
 package model
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
 type Text struct {
-	Author   string   `json:"author"`
+	ID        string    `json:"id"`        // unique message id: NewID()
+	Timestamp time.Time `json:"timestamp"` // when the message is received (TextIn) or generated (TextOut)
+	Source    Source    `json:"source"`    // where the message comes from
+
+	Author      string `json:"author"`
+	AuthorID    string `json:"author_id,omitempty"`    // author id on the platform (e.g. bilibili uid)
+	AuthorLevel int    `json:"author_level,omitempty"` // author (user) level on the platform
+
 	Content  string   `json:"content"`
 	Priority Priority `json:"priority"`
+
+	// ReplyTo links a TextOut to the TextIn that caused it.
+	// It's nil for TextIns.
+	ReplyTo *Text `json:"reply_to,omitempty"`
+
+	// Metadata is free-form extra information.
+	// See the Meta* constants for well-known keys.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // TextIn 是 vtuber 看到的消息
@@ -20,3 +42,127 @@ const (
 	PriorityHigh    Priority = 2
 	PriorityHighest Priority = PriorityHigh
 )
+
+// Source is where a message comes from.
+type Source string
+
+const (
+	SourceDm        Source = "dm"        // danmaku (弹幕)
+	SourceSuperChat Source = "superchat" // super chat (醒目留言)
+	SourceGift      Source = "gift"      // gift event
+	SourceMember    Source = "member"    // guard (上舰) event
+	SourceHTTP      Source = "http"      // TextInFromHTTP
+	SourceChatbot   Source = "chatbot"   // chatbot reply (TextOut)
+)
+
+// Well-known Metadata keys
+const (
+	MetaPlatformID   = "platform_id"   // message id on the platform (e.g. the super chat id)
+	MetaMedalLevel   = "medal_level"   // int: fan medal (粉丝牌) level
+	MetaAuthorType   = "author_type"   // int: 0 normal, 1 guard, 2 admin, 3 streamer
+	MetaGiftName     = "gift_name"     // string
+	MetaGiftCoin     = "gift_coin"     // int64: total value of gifts (金瓜子)
+	MetaGuardLevel   = "guard_level"   // int: 1 总督, 2 提督, 3 舰长
+	MetaSuperChatID  = "superchat_id"  // string
+	MetaChunkOf      = "chunk_of"      // string: ID of the long text this chunk is split from
+	MetaChunkIndex   = "chunk_index"   // int: 0-based index of the chunk
+	MetaCacheHit     = "cache_hit"     // bool: the reply is from the response cache (chatbot.CacheChatbot)
+	MetaChatbotLevel = "chatbot_level" // Priority: the level of the chatbot.PrioritizedChatbot that answered
+	MetaModeration   = "moderation"    // string: what the moderation did to the reply: regenerated | fallback
+	MetaDegraded     = "degraded"      // string: the reply is a stopgap as all the chatbots failed: fallback | canned
+)
+
+// NewID returns a new random unique message id.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// never happens in practice: fallback to time
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewTextIn creates a TextIn with a new ID and the Timestamp of now.
+func NewTextIn(source Source, author string, content string, priority Priority) *TextIn {
+	return &TextIn{
+		ID:        NewID(),
+		Timestamp: time.Now(),
+		Source:    source,
+		Author:    author,
+		Content:   content,
+		Priority:  priority,
+	}
+}
+
+// Reply creates a TextOut replying to t.
+// The Priority is inherited from t.
+func (t *Text) Reply(author string, content string) *TextOut {
+	return &TextOut{
+		ID:        NewID(),
+		Timestamp: time.Now(),
+		Source:    SourceChatbot,
+		Author:    author,
+		Content:   content,
+		Priority:  t.Priority,
+		ReplyTo:   t,
+	}
+}
+
+// EnsureID fills the ID and Timestamp if they are missing,
+// for the messages that are not created by NewTextIn (e.g. decoded from json).
+func (t *Text) EnsureID() {
+	if t.ID == "" {
+		t.ID = NewID()
+	}
+	if t.Timestamp.IsZero() {
+		t.Timestamp = time.Now()
+	}
+}
+
+// SetMeta sets Metadata[key] = value. The map is created if it's nil.
+func (t *Text) SetMeta(key string, value any) {
+	if t.Metadata == nil {
+		t.Metadata = map[string]any{}
+	}
+	t.Metadata[key] = value
+}
+
+// Meta returns Metadata[key] or nil.
+func (t *Text) Meta(key string) any {
+	if t.Metadata == nil {
+		return nil
+	}
+	return t.Metadata[key]
+}
+
+// MetaInt returns Metadata[key] as an int.
+// The ints decoded from JSON (float64 or json.Number) are accepted too.
+func (t *Text) MetaInt(key string) (int, bool) {
+	switch v := t.Meta(key).(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+// MetaString returns Metadata[key] as a string.
+func (t *Text) MetaString(key string) (string, bool) {
+	s, ok := t.Meta(key).(string)
+	return s, ok
+}
+
+// Latency is the time from the TextIn (ReplyTo) received
+// to the TextOut generated. It's 0 if unknown.
+func (t *Text) Latency() time.Duration {
+	if t.ReplyTo == nil || t.ReplyTo.Timestamp.IsZero() || t.Timestamp.IsZero() {
+		return 0
+	}
+	return t.Timestamp.Sub(t.ReplyTo.Timestamp)
+}
@@ -0,0 +1,56 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	moderationv1 "muvtuberdriver/moderation/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// GRPCModerator asks a gRPC ModerationService (see proto/moderation.proto).
+type GRPCModerator struct {
+	addr   string
+	conn   *grpc.ClientConn
+	client moderationv1.ModerationServiceClient
+}
+
+// NewGRPCModerator connects to the ModerationService at addr.
+// The connection is established lazily.
+func NewGRPCModerator(addr string) (*GRPCModerator, error) {
+	if addr == "" {
+		return nil, errors.New("grpc moderator: addr is empty")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCModerator{
+		addr:   addr,
+		conn:   conn,
+		client: moderationv1.NewModerationServiceClient(conn),
+	}, nil
+}
+
+// Moderate implements the Moderator interface.
+// The ctx should have a deadline: no timeout is set here.
+func (m *GRPCModerator) Moderate(ctx context.Context, text string) (Verdict, error) {
+	resp, err := m.client.Moderate(ctx, &moderationv1.ModerateRequest{Text: text})
+	if err != nil {
+		return Verdict{}, err
+	}
+	if !resp.GetFlagged() {
+		return Verdict{}, nil
+	}
+	return Verdict{
+		Flagged:    true,
+		Categories: resp.GetCategories(),
+		Moderator:  "grpc",
+	}, nil
+}
+
+// Close the connection.
+func (m *GRPCModerator) Close() error {
+	return m.conn.Close()
+}
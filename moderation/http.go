@@ -0,0 +1,105 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/cdfmlr/ellipsis"
+)
+
+// HTTPModerator asks an HTTP moderation endpoint compatible with
+// OpenAI's moderations API:
+//
+//	POST https://api.openai.com/v1/moderations
+//	{"input": "text", "model": "text-moderation-latest"}
+//
+//	200 OK
+//	{"results": [{"flagged": true, "categories": {"hate": true, "violence": false, ...}}]}
+type HTTPModerator struct {
+	URL    string // the full url of the endpoint
+	ApiKey string // sent as "Authorization: Bearer ApiKey". Can be empty.
+	Model  string // optional
+
+	client *http.Client
+}
+
+// NewHTTPModerator creates an HTTPModerator.
+func NewHTTPModerator(url, apiKey, model string) (*HTTPModerator, error) {
+	if url == "" {
+		return nil, errors.New("http moderator: url is empty")
+	}
+	return &HTTPModerator{
+		URL:    url,
+		ApiKey: apiKey,
+		Model:  model,
+		client: &http.Client{},
+	}, nil
+}
+
+type moderationRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// Moderate implements the Moderator interface.
+// The ctx should have a deadline: no timeout is set here.
+func (m *HTTPModerator) Moderate(ctx context.Context, text string) (Verdict, error) {
+	body, err := json.Marshal(moderationRequest{Input: text, Model: m.Model})
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.ApiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return Verdict{}, fmt.Errorf("%s: %s", resp.Status, ellipsis.Ending(string(b), 100))
+	}
+	var r moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return Verdict{}, fmt.Errorf("bad response: %w", err)
+	}
+	if len(r.Results) == 0 {
+		return Verdict{}, errors.New("bad response: no results")
+	}
+
+	verdict := Verdict{Moderator: "http"}
+	for _, result := range r.Results {
+		if !result.Flagged {
+			continue
+		}
+		verdict.Flagged = true
+		for category, violated := range result.Categories {
+			if violated {
+				verdict.Categories = append(verdict.Categories, category)
+			}
+		}
+	}
+	sort.Strings(verdict.Categories)
+	return verdict, nil
+}
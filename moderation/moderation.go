@@ -0,0 +1,99 @@
+// Package moderation checks the texts (the answers of the chatbots)
+// before they are spoken.
+//
+// A Moderator tells whether a text violates the policy: a local word list
+// (WordList), an HTTP moderation endpoint (HTTPModerator, e.g. OpenAI's
+// /v1/moderations) or a gRPC moderation service (GRPCModerator).
+// Several of them can be used together with Chain.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"muvtuberdriver/pkg/wordfilter"
+	"unicode/utf8"
+
+	"github.com/cdfmlr/ellipsis"
+)
+
+// Verdict is the result of a moderation.
+type Verdict struct {
+	Flagged    bool     // true if the text violates the policy
+	Categories []string // the categories violated, e.g. "hate", "inline"
+	Moderator  string   // the Moderator that flagged the text
+
+	// Matches are the offending spans in the text, if the Moderator
+	// knows them (WordList does, the remote ones do not).
+	Matches []wordfilter.Match
+}
+
+// Moderator checks a text.
+type Moderator interface {
+	// Moderate returns the verdict on the text. An error means the text
+	// is not checked: the caller decides whether to let it go.
+	Moderate(ctx context.Context, text string) (Verdict, error)
+}
+
+// Redact the offending parts of the text, so that the verdict can be
+// logged: the matches are masked with '*' if known, otherwise the whole
+// text is redacted (only its length is kept).
+func Redact(text string, verdict Verdict) string {
+	if !verdict.Flagged {
+		return ellipsis.Centering(text, 31)
+	}
+	if len(verdict.Matches) > 0 {
+		return ellipsis.Centering(wordfilter.Mask(text, verdict.Matches, '*'), 31)
+	}
+	return fmt.Sprintf("[redacted: %d runes]", utf8.RuneCountInString(text))
+}
+
+// region Chain
+
+// Chain checks the text with the moderators in order, and returns the
+// first flagged verdict. So put the cheap local ones (WordList) first.
+//
+// A failed moderator does not stop the chain: if no one flags the text,
+// the errors are returned (joined) with the verdict not flagged.
+type Chain []Moderator
+
+func (c Chain) Moderate(ctx context.Context, text string) (Verdict, error) {
+	var errs []error
+	for _, m := range c {
+		verdict, err := m.Moderate(ctx, text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", m, err))
+			continue
+		}
+		if verdict.Flagged {
+			return verdict, nil
+		}
+	}
+	return Verdict{}, errors.Join(errs...)
+}
+
+// Close closes the moderators that are io.Closer-like (e.g. GRPCModerator).
+func (c Chain) Close() error {
+	var errs []error
+	for _, m := range c {
+		if closer, ok := m.(interface{ Close() error }); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// endregion Chain
+
+// categories returns the distinct categories of the matches.
+func categories(matches []wordfilter.Match) []string {
+	seen := map[string]bool{}
+	var categories []string
+	for _, m := range matches {
+		if !seen[m.Category] {
+			seen[m.Category] = true
+			categories = append(categories, m.Category)
+		}
+	}
+	return categories
+}
@@ -0,0 +1,65 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"muvtuberdriver/pkg/wordfilter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	matcher := wordfilter.NewMatcher()
+	matcher.Add("笨蛋", "insult")
+	words := NewWordList(matcher, []*regexp.Regexp{regexp.MustCompile(`\d{11}`)})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req moderationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		flagged := req.Input == "去打架吧"
+		json.NewEncoder(w).Encode(map[string]any{
+			"results": []map[string]any{{
+				"flagged":    flagged,
+				"categories": map[string]bool{"violence": flagged, "hate": false},
+			}},
+		})
+	}))
+	defer server.Close()
+	remote, _ := NewHTTPModerator(server.URL, "sk-test", "")
+	broken, _ := NewHTTPModerator(server.URL, "", "")
+
+	tests := []struct {
+		text       string
+		chain      Chain
+		flagged    bool
+		categories []string
+		redacted   string
+		wantErr    bool
+	}{
+		{"你好", Chain{words, remote}, false, nil, "你好", false},
+		{"你是笨 蛋", Chain{words, remote}, true, []string{"insult"}, "你是* *", false},
+		{"电话 13800138000", Chain{words, remote}, true, []string{"regexp"}, "电话 ***********", false},
+		{"去打架吧", Chain{words, remote}, true, []string{"violence"}, "[redacted: 4 runes]", false},
+		{"笨蛋", Chain{broken, words}, true, []string{"insult"}, "**", false},
+		{"你好", Chain{broken, words}, false, nil, "你好", true},
+	}
+	for _, tt := range tests {
+		verdict, err := tt.chain.Moderate(context.Background(), tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Moderate(%q) err = %v, wantErr %v", tt.text, err, tt.wantErr)
+		}
+		if verdict.Flagged != tt.flagged || !reflect.DeepEqual(verdict.Categories, tt.categories) {
+			t.Errorf("Moderate(%q) = %+v, want flagged %v, categories %v", tt.text, verdict, tt.flagged, tt.categories)
+		}
+		if got := Redact(tt.text, verdict); got != tt.redacted {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.redacted)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.29.0
+// 	protoc        (unknown)
+// source: muvtuber/moderation/v1/moderation.proto
+
+// 内容审核 api: 在 vtuber 说出 chatbot 的回答之前检查它
+
+package moderationapiv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ModerateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the text to check
+	Text string `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+}
+
+func (x *ModerateRequest) Reset() {
+	*x = ModerateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_muvtuber_moderation_v1_moderation_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ModerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModerateRequest) ProtoMessage() {}
+
+func (x *ModerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_muvtuber_moderation_v1_moderation_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModerateRequest.ProtoReflect.Descriptor instead.
+func (*ModerateRequest) Descriptor() ([]byte, []int) {
+	return file_muvtuber_moderation_v1_moderation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ModerateRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type ModerateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// true if the text violates the policy
+	Flagged bool `protobuf:"varint,1,opt,name=flagged,proto3" json:"flagged,omitempty"`
+	// the categories violated, e.g. "hate", "sexual". Empty if not flagged.
+	Categories []string `protobuf:"bytes,2,rep,name=categories,proto3" json:"categories,omitempty"`
+}
+
+func (x *ModerateResponse) Reset() {
+	*x = ModerateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_muvtuber_moderation_v1_moderation_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ModerateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModerateResponse) ProtoMessage() {}
+
+func (x *ModerateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_muvtuber_moderation_v1_moderation_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModerateResponse.ProtoReflect.Descriptor instead.
+func (*ModerateResponse) Descriptor() ([]byte, []int) {
+	return file_muvtuber_moderation_v1_moderation_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ModerateResponse) GetFlagged() bool {
+	if x != nil {
+		return x.Flagged
+	}
+	return false
+}
+
+func (x *ModerateResponse) GetCategories() []string {
+	if x != nil {
+		return x.Categories
+	}
+	return nil
+}
+
+var File_muvtuber_moderation_v1_moderation_proto protoreflect.FileDescriptor
+
+var file_muvtuber_moderation_v1_moderation_proto_rawDesc = []byte{
+	0x0a, 0x27, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2f, 0x6d, 0x6f, 0x64, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x31, 0x2f, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x16, 0x6d, 0x75, 0x76, 0x74, 0x75,
+	0x62, 0x65, 0x72, 0x2e, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76,
+	0x31, 0x22, 0x25, 0x0a, 0x0f, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x78, 0x74, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x22, 0x4c, 0x0a, 0x10, 0x4d, 0x6f, 0x64, 0x65,
+	0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x66, 0x6c, 0x61, 0x67, 0x67, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x66,
+	0x6c, 0x61, 0x67, 0x67, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x63, 0x61, 0x74, 0x65, 0x67, 0x6f,
+	0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x63, 0x61, 0x74, 0x65,
+	0x67, 0x6f, 0x72, 0x69, 0x65, 0x73, 0x32, 0x72, 0x0a, 0x11, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x5d, 0x0a, 0x08, 0x4d,
+	0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x12, 0x27, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62,
+	0x65, 0x72, 0x2e, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31,
+	0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x28, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x6d, 0x6f, 0x64, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61,
+	0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0xdf, 0x01, 0x0a, 0x1a, 0x63,
+	0x6f, 0x6d, 0x2e, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x6d, 0x6f, 0x64, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x31, 0x42, 0x0f, 0x4d, 0x6f, 0x64, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x50, 0x01, 0x5a, 0x36, 0x6d, 0x75,
+	0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2f, 0x67, 0x65, 0x6e,
+	0x2f, 0x6d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x2f, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x31, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x76, 0x31, 0xa2, 0x02, 0x03, 0x4d, 0x4d, 0x58, 0xaa, 0x02, 0x16, 0x4d, 0x75, 0x76,
+	0x74, 0x75, 0x62, 0x65, 0x72, 0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x56, 0x31, 0xca, 0x02, 0x16, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x5c, 0x4d,
+	0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5c, 0x56, 0x31, 0xe2, 0x02, 0x22, 0x4d,
+	0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x5c, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x5c, 0x56, 0x31, 0x5c, 0x47, 0x50, 0x42, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
+	0x61, 0xea, 0x02, 0x18, 0x4d, 0x75, 0x76, 0x74, 0x75, 0x62, 0x65, 0x72, 0x3a, 0x3a, 0x4d, 0x6f,
+	0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x3a, 0x3a, 0x56, 0x31, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_muvtuber_moderation_v1_moderation_proto_rawDescOnce sync.Once
+	file_muvtuber_moderation_v1_moderation_proto_rawDescData = file_muvtuber_moderation_v1_moderation_proto_rawDesc
+)
+
+func file_muvtuber_moderation_v1_moderation_proto_rawDescGZIP() []byte {
+	file_muvtuber_moderation_v1_moderation_proto_rawDescOnce.Do(func() {
+		file_muvtuber_moderation_v1_moderation_proto_rawDescData = protoimpl.X.CompressGZIP(file_muvtuber_moderation_v1_moderation_proto_rawDescData)
+	})
+	return file_muvtuber_moderation_v1_moderation_proto_rawDescData
+}
+
+var file_muvtuber_moderation_v1_moderation_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_muvtuber_moderation_v1_moderation_proto_goTypes = []interface{}{
+	(*ModerateRequest)(nil),  // 0: muvtuber.moderation.v1.ModerateRequest
+	(*ModerateResponse)(nil), // 1: muvtuber.moderation.v1.ModerateResponse
+}
+var file_muvtuber_moderation_v1_moderation_proto_depIdxs = []int32{
+	0, // 0: muvtuber.moderation.v1.ModerationService.Moderate:input_type -> muvtuber.moderation.v1.ModerateRequest
+	1, // 1: muvtuber.moderation.v1.ModerationService.Moderate:output_type -> muvtuber.moderation.v1.ModerateResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_muvtuber_moderation_v1_moderation_proto_init() }
+func file_muvtuber_moderation_v1_moderation_proto_init() {
+	if File_muvtuber_moderation_v1_moderation_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_muvtuber_moderation_v1_moderation_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ModerateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_muvtuber_moderation_v1_moderation_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ModerateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_muvtuber_moderation_v1_moderation_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_muvtuber_moderation_v1_moderation_proto_goTypes,
+		DependencyIndexes: file_muvtuber_moderation_v1_moderation_proto_depIdxs,
+		MessageInfos:      file_muvtuber_moderation_v1_moderation_proto_msgTypes,
+	}.Build()
+	File_muvtuber_moderation_v1_moderation_proto = out.File
+	file_muvtuber_moderation_v1_moderation_proto_rawDesc = nil
+	file_muvtuber_moderation_v1_moderation_proto_goTypes = nil
+	file_muvtuber_moderation_v1_moderation_proto_depIdxs = nil
+}
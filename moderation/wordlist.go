@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"context"
+	"muvtuberdriver/pkg/wordfilter"
+	"regexp"
+)
+
+// WordList flags the texts containing the words (wordfilter.Matcher,
+// tolerating the spaces and symbols inserted) or matching the regexps.
+//
+// The categories of the verdict are the categories of the words matched,
+// and "regexp" for the regexps.
+type WordList struct {
+	matcher *wordfilter.Matcher
+	regexps []*regexp.Regexp
+}
+
+// NewWordList creates a WordList. The matcher is built here.
+// Both matcher and regexps can be nil.
+func NewWordList(matcher *wordfilter.Matcher, regexps []*regexp.Regexp) *WordList {
+	if matcher == nil {
+		matcher = wordfilter.NewMatcher()
+	}
+	matcher.Build()
+	return &WordList{matcher: matcher, regexps: regexps}
+}
+
+// Find the words and regexps in the text.
+func (w *WordList) Find(text string) []wordfilter.Match {
+	matches := w.matcher.Find(text)
+	for _, re := range w.regexps {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, wordfilter.Match{
+				Start:    loc[0],
+				End:      loc[1],
+				Word:     re.String(),
+				Category: "regexp",
+			})
+		}
+	}
+	return matches
+}
+
+// Len returns the number of words and regexps.
+func (w *WordList) Len() int {
+	return w.matcher.Len() + len(w.regexps)
+}
+
+// Moderate implements the Moderator interface. It never fails.
+func (w *WordList) Moderate(ctx context.Context, text string) (Verdict, error) {
+	matches := w.Find(text)
+	if len(matches) == 0 {
+		return Verdict{}, nil
+	}
+	return Verdict{
+		Flagged:    true,
+		Categories: categories(matches),
+		Moderator:  "wordlist",
+		Matches:    matches,
+	}, nil
+}
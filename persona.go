@@ -0,0 +1,48 @@
+package main
+
+import (
+	"muvtuberdriver/chatbot"
+	"muvtuberdriver/persona"
+	"muvtuberdriver/sayer"
+
+	"golang.org/x/exp/slog"
+)
+
+// setupPersona applies the personas to the chatbot and the sayer on
+// switch, and switches to the default one if any.
+// Nothing to do if personas is nil (disabled).
+//
+// The empty fields of a persona keep the ones in the config:
+// the prompts of the chatbots and the sayer role (defaultTtsRole).
+func setupPersona(personas *persona.Manager, defaultPersona string,
+	pchatbot *chatbot.PrioritizedChatbot, s sayer.Sayer, defaultTtsRole string) {
+	if personas == nil {
+		return
+	}
+
+	// chatbot: new sessions with the prompt
+	personas.OnSwitch(func(p *persona.Persona) error {
+		return pchatbot.SetPrompt(p.Prompt)
+	})
+
+	// sayer: the voice and the expressions
+	if ps, ok := s.(sayer.PersonaSetter); ok {
+		personas.OnSwitch(func(p *persona.Persona) error {
+			role := p.TtsRole
+			if role == "" {
+				role = defaultTtsRole
+			}
+			ps.SetTtsRole(role)
+			ps.SetExpressions(p.Expressions)
+			return nil
+		})
+	} else {
+		slog.Warn("[persona] the sayer can not switch persona: tts role and expressions are ignored.")
+	}
+
+	if defaultPersona != "" {
+		if err := personas.Switch(defaultPersona); err != nil {
+			slog.Error("[persona] switch to the default persona failed.", "persona", defaultPersona, "err", err)
+		}
+	}
+}
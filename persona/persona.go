@@ -0,0 +1,221 @@
+// Package persona loads the persona profiles (who the vtuber is: the
+// prompt, the voice, the live2d expressions, the quibbles) from a
+// directory, and switches the active one at runtime.
+//
+// One YAML file per persona in the directory:
+//
+//	# personas/catgirl.yaml
+//	name: catgirl          # the file name (without the extension) if empty
+//	description: 猫娘之夜
+//	prompt: 你是一只猫娘，每句话都以“喵”结尾。
+//	tts_role: catgirl
+//	expressions: [happy, shy]
+//	quibbles: [太长了喵，不想念喵。]
+//
+// The empty fields keep the ones in the config.
+package persona
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// Persona is a persona profile.
+type Persona struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Prompt      string   `yaml:"prompt" json:"prompt,omitempty"`           // who the chatbot is: the initial (system) prompt
+	TtsRole     string   `yaml:"tts_role" json:"tts_role,omitempty"`       // the voice
+	Expressions []string `yaml:"expressions" json:"expressions,omitempty"` // the live2d expressions to speak with
+	Quibbles    []string `yaml:"quibbles" json:"quibbles,omitempty"`       // too_long: the complaints about a too long answer
+}
+
+// Load reads a persona from the YAML file.
+// The Name defaults to the file name without the extension.
+func Load(file string) (*Persona, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p Persona
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("read persona from %s: %w", file, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return &p, nil
+}
+
+// LoadDir reads the personas from the *.yaml and *.yml files in the dir,
+// ordered by name. The names should be unique.
+func LoadDir(dir string) ([]*Persona, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var personas []*Persona
+	seen := map[string]string{} // name -> file
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		p, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate persona %q: %s and %s", p.Name, other, file)
+		}
+		seen[p.Name] = file
+		personas = append(personas, p)
+	}
+	sort.Slice(personas, func(i, j int) bool {
+		return personas[i].Name < personas[j].Name
+	})
+	return personas, nil
+}
+
+// ErrNotFound is returned by Switch for an unknown persona.
+var ErrNotFound = errors.New("persona not found")
+
+// SwitchFunc applies the persona to a component (e.g. sets the prompt of
+// the chatbots). See Manager.OnSwitch.
+type SwitchFunc func(p *Persona) error
+
+// Manager holds the personas loaded from a directory and the active one.
+// It's safe for concurrent use.
+//
+// The methods of a nil *Manager return nothing (no active persona), so the
+// callers need not check whether the persona is enabled.
+type Manager struct {
+	dir string
+
+	mu       sync.RWMutex
+	personas map[string]*Persona
+	active   *Persona
+
+	switchMu sync.Mutex // one Switch at a time
+	onSwitch []SwitchFunc
+}
+
+// NewManager loads the personas from the dir. No persona is active
+// until Switch.
+func NewManager(dir string) (*Manager, error) {
+	m := &Manager{dir: dir}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OnSwitch adds a function to apply the persona on Switch.
+// It should be called before the first Switch.
+func (m *Manager) OnSwitch(fn SwitchFunc) {
+	m.switchMu.Lock()
+	defer m.switchMu.Unlock()
+	m.onSwitch = append(m.onSwitch, fn)
+}
+
+// Reload reads the personas from the dir again (e.g. a file is added or
+// edited). The active persona is kept (as loaded before): Switch to it
+// again to apply the changes.
+func (m *Manager) Reload() error {
+	personas, err := LoadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.personas = make(map[string]*Persona, len(personas))
+	for _, p := range personas {
+		m.personas[p.Name] = p
+	}
+	slog.Info("[persona] personas loaded.", "dir", m.dir, "personas", len(personas))
+	return nil
+}
+
+// List returns the personas ordered by name.
+func (m *Manager) List() []*Persona {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	personas := make([]*Persona, 0, len(m.personas))
+	for _, p := range m.personas {
+		personas = append(personas, p)
+	}
+	sort.Slice(personas, func(i, j int) bool {
+		return personas[i].Name < personas[j].Name
+	})
+	return personas
+}
+
+// Active returns the active persona, nil if none.
+func (m *Manager) Active() *Persona {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active
+}
+
+// Quibbles returns the quibbles of the active persona, nil if none.
+func (m *Manager) Quibbles() []string {
+	if p := m.Active(); p != nil {
+		return p.Quibbles
+	}
+	return nil
+}
+
+// Switch makes the named persona active and applies it with the
+// OnSwitch functions. All of them are called even if some fail, and
+// the persona is active anyway: the errors are returned joined.
+func (m *Manager) Switch(name string) error {
+	m.mu.RLock()
+	p, ok := m.personas[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+
+	m.switchMu.Lock()
+	defer m.switchMu.Unlock()
+
+	m.mu.Lock()
+	old := m.active
+	m.active = p
+	m.mu.Unlock()
+
+	var errs []error
+	for _, fn := range m.onSwitch {
+		errs = append(errs, fn(p))
+	}
+	err := errors.Join(errs...)
+
+	oldName := ""
+	if old != nil {
+		oldName = old.Name
+	}
+	slog.Info("[persona] switched.", "from", oldName, "to", p.Name, "err", err)
+	return err
+}
@@ -0,0 +1,74 @@
+package persona
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"muli.yaml":    "prompt: 你是 muli\n",
+		"catgirl.yml":  "name: neko\nprompt: 你是一只猫娘\nquibbles: [太长了喵]\n",
+		"README.txt":   "not a persona",
+		"broken.yaml~": "::",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := m.List(); len(list) != 2 || list[0].Name != "muli" || list[1].Name != "neko" {
+		t.Fatalf("List() = %v, want [muli neko]", list)
+	}
+	if m.Active() != nil || m.Quibbles() != nil {
+		t.Errorf("active before Switch: %v", m.Active())
+	}
+
+	var prompts []string
+	hookErr := errors.New("tts unavailable")
+	m.OnSwitch(func(p *Persona) error {
+		prompts = append(prompts, p.Prompt)
+		return nil
+	})
+	m.OnSwitch(func(p *Persona) error {
+		return hookErr
+	})
+
+	if err := m.Switch("nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Switch(nobody) = %v, want ErrNotFound", err)
+	}
+	// all the hooks are called, and the persona is active anyway
+	if err := m.Switch("neko"); !errors.Is(err, hookErr) {
+		t.Errorf("Switch(neko) = %v, want %v", err, hookErr)
+	}
+	if len(prompts) != 1 || prompts[0] != "你是一只猫娘" {
+		t.Errorf("prompts applied = %v", prompts)
+	}
+	if a := m.Active(); a == nil || a.Name != "neko" {
+		t.Errorf("Active() = %v, want neko", a)
+	}
+	if q := m.Quibbles(); len(q) != 1 || q[0] != "太长了喵" {
+		t.Errorf("Quibbles() = %v", q)
+	}
+
+	// duplicate names
+	if err := os.WriteFile(filepath.Join(dir, "neko.yaml"), []byte("prompt: 喵\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err == nil {
+		t.Error("Reload() with duplicate names: want error")
+	}
+
+	var nilManager *Manager
+	if nilManager.Active() != nil || nilManager.List() != nil || nilManager.Quibbles() != nil {
+		t.Error("nil Manager should have nothing")
+	}
+}
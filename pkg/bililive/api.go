@@ -0,0 +1,83 @@
+package bililive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// apiResponse is the common wrapper of bilibili live api responses.
+type apiResponse[T any] struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+}
+
+type roomInitData struct {
+	RoomID  int `json:"room_id"`
+	ShortID int `json:"short_id"`
+}
+
+type danmuInfoData struct {
+	Token    string `json:"token"`
+	HostList []struct {
+		Host    string `json:"host"`
+		WssPort int    `json:"wss_port"`
+	} `json:"host_list"`
+}
+
+// resolveRoom resolves the real room id (from a short id), the token and
+// the server to connect.
+//
+// Failing to get the token & server is not fatal: DefaultServer is used
+// without a token (the server accepts it, but may hide some user info).
+func (c *Client) resolveRoom(ctx context.Context) error {
+	var room apiResponse[roomInitData]
+	err := c.getJSON(ctx, fmt.Sprintf("%s/room/v1/Room/room_init?id=%d", c.api, c.roomID), &room)
+	if err != nil {
+		return fmt.Errorf("room_init: %w", err)
+	}
+	if room.Code != 0 || room.Data.RoomID == 0 {
+		return fmt.Errorf("room_init: code=%d message=%q", room.Code, room.Message)
+	}
+	c.roomID = room.Data.RoomID
+
+	c.server = DefaultServer
+
+	var info apiResponse[danmuInfoData]
+	err = c.getJSON(ctx, fmt.Sprintf("%s/xlive/web-room/v1/index/getDanmuInfo?id=%d&type=0", c.api, c.roomID), &info)
+	if err != nil || info.Code != 0 {
+		return nil
+	}
+	c.token = info.Data.Token
+	if len(info.Data.HostList) > 0 {
+		h := info.Data.HostList[0]
+		c.server = fmt.Sprintf("wss://%s:%d/sub", h.Host, h.WssPort)
+	}
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RoomID returns the (resolved) room id.
+func (c *Client) RoomID() int {
+	return c.roomID
+}
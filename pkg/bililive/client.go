@@ -0,0 +1,281 @@
+// Package bililive is a client to the bilibili live danmaku (broadcast)
+// server. It speaks the packet protocol directly over websocket:
+//
+//	client                          server
+//	  | -------- OpAuth ------------> |
+//	  | <------- OpAuthReply -------- |
+//	  | -------- OpHeartbeat -------> |  (every 30s)
+//	  | <------- OpHeartbeatReply --- |
+//	  | <------- OpMessage ---------- |  (DANMU_MSG, SEND_GIFT, ...)
+//
+// It is an alternative to the blivechat proxy.
+package bililive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Defaults
+var (
+	DefaultServer            = "wss://broadcastlv.chat.bilibili.com/sub"
+	DefaultOrigin            = "https://live.bilibili.com"
+	DefaultAPI               = "https://api.live.bilibili.com"
+	DefaultHeartbeatInterval = 30 * time.Second
+	DefaultHandshakeTimeout  = 10 * time.Second
+)
+
+// heartbeatBody is what the web client sends as the heartbeat body.
+const heartbeatBody = "[object Object]"
+
+var ErrAuthFailed = errors.New("auth failed")
+
+// Message is a command message (OpMessage) from the server.
+type Message struct {
+	Cmd string          // the command: DANMU_MSG, SEND_GIFT, ... (without the ":..." suffix)
+	Raw json.RawMessage // the whole message: {"cmd": "...", "info": [...], "data": {...}}
+}
+
+// Client connects to the danmaku server of a live room.
+type Client struct {
+	roomID int
+
+	server            string // "" => discovered by the API
+	origin            string
+	api               string
+	token             string
+	heartbeatInterval time.Duration
+	handshakeTimeout  time.Duration
+	httpClient        *http.Client
+
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+}
+
+type Option func(*Client)
+
+// WithServer sets the websocket url of the danmaku server.
+// The room id is used as-is (without resolving the real room id)
+// and the api is not called.
+func WithServer(url string) Option {
+	return func(c *Client) {
+		c.server = url
+	}
+}
+
+// WithAPI sets the base url of the bilibili live api.
+func WithAPI(url string) Option {
+	return func(c *Client) {
+		c.api = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithHeartbeatInterval sets the interval to send OpHeartbeat.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.heartbeatInterval = d
+	}
+}
+
+// WithHandshakeTimeout sets how long to wait for the OpAuthReply.
+// Default: 10s.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.handshakeTimeout = d
+		}
+	}
+}
+
+// NewClient creates a client to the room. Call Connect to connect.
+func NewClient(roomID int, opts ...Option) *Client {
+	c := &Client{
+		roomID:            roomID,
+		origin:            DefaultOrigin,
+		api:               DefaultAPI,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		handshakeTimeout:  DefaultHandshakeTimeout,
+		httpClient:        &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Connect resolves the room (if the server is not given), dials the server
+// and authenticates. It returns after the OpAuthReply is received.
+func (c *Client) Connect(ctx context.Context) error {
+	server := c.server
+	if server == "" {
+		if err := c.resolveRoom(ctx); err != nil {
+			return err
+		}
+		server = c.server
+	}
+
+	ws, err := websocket.Dial(server, "", c.origin)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", server, err)
+	}
+	c.ws = ws
+
+	if err := c.auth(ctx); err != nil {
+		ws.Close()
+		return err
+	}
+
+	return nil
+}
+
+// auth sends OpAuth and waits for OpAuthReply,
+// for handshakeTimeout at most (or until the ctx deadline if earlier).
+func (c *Client) auth(ctx context.Context) error {
+	body, _ := json.Marshal(map[string]any{
+		"uid":      0,
+		"roomid":   c.roomID,
+		"protover": ProtoVerBrotli,
+		"platform": "web",
+		"type":     2,
+		"key":      c.token,
+	})
+	if err := c.send(&Packet{ProtoVer: ProtoVerPopularity, Operation: OpAuth, Body: body}); err != nil {
+		return fmt.Errorf("send auth: %w", err)
+	}
+
+	deadline := time.Now().Add(c.handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.ws.SetReadDeadline(deadline); err != nil {
+		return fmt.Errorf("set read deadline: %w", err)
+	}
+	defer c.ws.SetReadDeadline(time.Time{}) // no deadline for Receive
+
+	var frame []byte
+	if err := websocket.Message.Receive(c.ws, &frame); err != nil {
+		return fmt.Errorf("recv auth reply: %w", err)
+	}
+	packets, err := DecodePackets(frame)
+	if err != nil {
+		return err
+	}
+	if len(packets) == 0 || packets[0].Operation != OpAuthReply {
+		return fmt.Errorf("%w: unexpected reply", ErrAuthFailed)
+	}
+
+	var reply struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(packets[0].Body, &reply); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	if reply.Code != 0 {
+		return fmt.Errorf("%w: code=%d", ErrAuthFailed, reply.Code)
+	}
+	return nil
+}
+
+// Receive keeps heartbeating and sends the received command messages to msgCh.
+//
+// Blocks until the connection is broken or the ctx is done.
+// The msgCh is not closed by Receive.
+func (c *Client) Receive(ctx context.Context, msgCh chan<- Message) error {
+	if c.ws == nil {
+		return errors.New("not connected")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go c.heartbeat(ctx)
+	go func() {
+		<-ctx.Done()
+		c.ws.Close() // unblocks the Receive below
+	}()
+
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(c.ws, &frame); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("recv: %w", err)
+		}
+
+		packets, err := DecodePackets(frame)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range packets {
+			if p.Operation != OpMessage {
+				continue // heartbeat replies: popularity is not interesting
+			}
+			msg, err := parseMessage(p.Body)
+			if err != nil {
+				continue
+			}
+			select {
+			case msgCh <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Close the connection.
+func (c *Client) Close() error {
+	if c.ws == nil {
+		return nil
+	}
+	return c.ws.Close()
+}
+
+func (c *Client) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+
+	hb := &Packet{ProtoVer: ProtoVerPopularity, Operation: OpHeartbeat, Body: []byte(heartbeatBody)}
+	for {
+		if err := c.send(hb); err != nil {
+			return // Receive will notice the broken connection
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send a packet as a binary websocket frame.
+func (c *Client) send(p *Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return websocket.Message.Send(c.ws, p.Encode())
+}
+
+func parseMessage(body []byte) (Message, error) {
+	var m struct {
+		Cmd string `json:"cmd"`
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return Message{}, err
+	}
+
+	// DANMU_MSG:4:0:2:2:2:0 -> DANMU_MSG
+	cmd, _, _ := strings.Cut(m.Cmd, ":")
+
+	return Message{Cmd: cmd, Raw: body}, nil
+}
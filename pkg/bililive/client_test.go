@@ -0,0 +1,161 @@
+package bililive
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/websocket"
+)
+
+// bodies captured from a live room (user info trimmed).
+const (
+	capturedDanmu = `{"cmd":"DANMU_MSG:4:0:2:2:2:0","info":[[0,1,25,16777215,1680000000000,1680000000,0,"a1b2c3d4",0,0,0,"",0,"{}","{}",{"mode":0}],"你好呀",[12345,"foo",0,0,0,10000,1,""],[21,"粉丝团","主播",26949229,398668,"",0,6809855,398668,6850801,3,1,1],[23,0,5805790,">50000",0],["",""],0,0,null,{"ts":1680000000,"ct":"ABCDEF"},0,0,null,null,0,105]}`
+	capturedGift  = `{"cmd":"SEND_GIFT","data":{"action":"投喂","coin_type":"gold","giftId":31036,"giftName":"小花花","num":3,"price":100,"total_coin":300,"timestamp":1680000001,"uid":23456,"uname":"bar"}}`
+	capturedSC    = `{"cmd":"SUPER_CHAT_MESSAGE","data":{"id":7654321,"uid":34567,"price":30,"message":"晚上好","start_time":1680000002,"user_info":{"uname":"baz"}}}`
+)
+
+func compressed(t *testing.T, protoVer uint16, bodies ...string) []byte {
+	var inner []byte
+	for _, b := range bodies {
+		p := Packet{ProtoVer: ProtoVerJSON, Operation: OpMessage, Body: []byte(b)}
+		inner = append(inner, p.Encode()...)
+	}
+
+	var buf bytes.Buffer
+	switch protoVer {
+	case ProtoVerZlib:
+		w := zlib.NewWriter(&buf)
+		w.Write(inner)
+		w.Close()
+	case ProtoVerBrotli:
+		w := brotli.NewWriter(&buf)
+		w.Write(inner)
+		w.Close()
+	default:
+		t.Fatalf("unexpected protoVer %d", protoVer)
+	}
+
+	p := Packet{ProtoVer: protoVer, Operation: OpMessage, Body: buf.Bytes()}
+	return p.Encode()
+}
+
+// fakeServer replays the frames after the client authenticated.
+func fakeServer(t *testing.T, roomID int, frames [][]byte) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		var frame []byte
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			t.Errorf("server: recv auth: %v", err)
+			return
+		}
+		packets, err := DecodePackets(frame)
+		if err != nil || len(packets) != 1 || packets[0].Operation != OpAuth {
+			t.Errorf("server: bad auth packet: %v, %v", packets, err)
+			return
+		}
+		var auth struct {
+			RoomID int `json:"roomid"`
+		}
+		json.Unmarshal(packets[0].Body, &auth)
+		if auth.RoomID != roomID {
+			t.Errorf("server: auth roomid = %d, want %d", auth.RoomID, roomID)
+		}
+
+		reply := Packet{ProtoVer: ProtoVerPopularity, Operation: OpAuthReply, Body: []byte(`{"code":0}`)}
+		websocket.Message.Send(ws, reply.Encode())
+
+		for _, f := range frames {
+			websocket.Message.Send(ws, f)
+		}
+
+		// keep the connection until the client leaves
+		websocket.Message.Receive(ws, &frame)
+		time.Sleep(100 * time.Millisecond)
+	}))
+}
+
+func TestClient(t *testing.T) {
+	const roomID = 26949229
+
+	popularity := Packet{ProtoVer: ProtoVerPopularity, Operation: OpHeartbeatReply, Body: []byte{0, 0, 0, 42}}
+	frames := [][]byte{
+		popularity.Encode(),
+		compressed(t, ProtoVerZlib, capturedDanmu, capturedDanmu),
+		compressed(t, ProtoVerBrotli, capturedGift),
+		(&Packet{ProtoVer: ProtoVerJSON, Operation: OpMessage, Body: []byte(capturedSC)}).Encode(),
+	}
+
+	srv := fakeServer(t, roomID, frames)
+	defer srv.Close()
+
+	c := NewClient(roomID, WithServer("ws"+strings.TrimPrefix(srv.URL, "http")))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	msgCh := make(chan Message, 10)
+	go c.Receive(ctx, msgCh)
+
+	wantCmds := []string{"DANMU_MSG", "DANMU_MSG", "SEND_GIFT", "SUPER_CHAT_MESSAGE"}
+	for i, want := range wantCmds {
+		select {
+		case msg := <-msgCh:
+			if msg.Cmd != want {
+				t.Errorf("msg[%d].Cmd = %q, want %q", i, msg.Cmd, want)
+			}
+			if !json.Valid(msg.Raw) {
+				t.Errorf("msg[%d].Raw is not valid json", i)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timeout waiting msg[%d]", i)
+		}
+	}
+}
+
+func TestClient_HandshakeTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		<-done // never replies to the auth
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := NewClient(1, WithServer("ws"+strings.TrimPrefix(srv.URL, "http")), WithHandshakeTimeout(100*time.Millisecond))
+	start := time.Now()
+	if err := c.Connect(context.Background()); err == nil {
+		c.Close()
+		t.Fatal("want err")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Connect took %v, want about the handshake timeout", elapsed)
+	}
+}
+
+func TestDecodePacketsBad(t *testing.T) {
+	good := (&Packet{ProtoVer: ProtoVerJSON, Operation: OpMessage, Body: []byte(`{}`)}).Encode()
+
+	if _, err := DecodePackets(good[:10]); err == nil {
+		t.Error("truncated header: want err")
+	}
+	if _, err := DecodePackets(good[:len(good)-1]); err == nil {
+		t.Error("truncated body: want err")
+	}
+
+	packets, err := DecodePackets(append(good, good...))
+	if err != nil || len(packets) != 2 {
+		t.Errorf("two packets in a frame: got %d, err=%v", len(packets), err)
+	}
+}
@@ -0,0 +1,139 @@
+package bililive
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// HeaderLen is the length of the packet header.
+//
+//	offset  size  field
+//	0       4     packet length (header + body)
+//	4       2     header length (16)
+//	6       2     protocol version (ProtoVer*)
+//	8       4     operation (Op*)
+//	12      4     sequence id (1)
+const HeaderLen = 16
+
+// Protocol versions: how the body is encoded.
+const (
+	ProtoVerJSON       uint16 = 0 // plain JSON
+	ProtoVerPopularity uint16 = 1 // uint32 popularity (heartbeat reply) or JSON (auth)
+	ProtoVerZlib       uint16 = 2 // zlib compressed packets
+	ProtoVerBrotli     uint16 = 3 // brotli compressed packets
+)
+
+// Operations
+const (
+	OpHeartbeat      uint32 = 2
+	OpHeartbeatReply uint32 = 3
+	OpMessage        uint32 = 5
+	OpAuth           uint32 = 7
+	OpAuthReply      uint32 = 8
+)
+
+// maxPacketLen is a sanity limit against broken streams.
+const maxPacketLen = 16 << 20
+
+var ErrBadPacket = errors.New("bad packet")
+
+// Packet is a packet of the bilibili live danmaku protocol.
+type Packet struct {
+	ProtoVer  uint16
+	Operation uint32
+	Body      []byte
+}
+
+// Encode the packet into bytes: header + body.
+func (p *Packet) Encode() []byte {
+	buf := make([]byte, HeaderLen+len(p.Body))
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.BigEndian.PutUint16(buf[4:6], HeaderLen)
+	binary.BigEndian.PutUint16(buf[6:8], p.ProtoVer)
+	binary.BigEndian.PutUint32(buf[8:12], p.Operation)
+	binary.BigEndian.PutUint32(buf[12:16], 1)
+
+	copy(buf[HeaderLen:], p.Body)
+	return buf
+}
+
+// DecodePackets decodes all the packets in data.
+// A websocket frame may contain several packets.
+//
+// Compressed packets (ProtoVerZlib, ProtoVerBrotli) are decompressed
+// and the packets inside are returned (flattened) instead.
+func DecodePackets(data []byte) ([]Packet, error) {
+	var packets []Packet
+
+	for len(data) > 0 {
+		if len(data) < HeaderLen {
+			return packets, fmt.Errorf("%w: %d bytes left, less than a header", ErrBadPacket, len(data))
+		}
+
+		packetLen := binary.BigEndian.Uint32(data[0:4])
+		headerLen := binary.BigEndian.Uint16(data[4:6])
+		if packetLen > maxPacketLen || int(packetLen) > len(data) || headerLen < HeaderLen || uint32(headerLen) > packetLen {
+			return packets, fmt.Errorf("%w: packetLen=%d headerLen=%d, got %d bytes",
+				ErrBadPacket, packetLen, headerLen, len(data))
+		}
+
+		p := Packet{
+			ProtoVer:  binary.BigEndian.Uint16(data[6:8]),
+			Operation: binary.BigEndian.Uint32(data[8:12]),
+			Body:      data[headerLen:packetLen],
+		}
+		data = data[packetLen:]
+
+		if p.Operation != OpMessage {
+			packets = append(packets, p)
+			continue
+		}
+
+		switch p.ProtoVer {
+		case ProtoVerZlib, ProtoVerBrotli:
+			inner, err := decompress(p.ProtoVer, p.Body)
+			if err != nil {
+				return packets, err
+			}
+			innerPackets, err := DecodePackets(inner)
+			packets = append(packets, innerPackets...)
+			if err != nil {
+				return packets, err
+			}
+		default:
+			packets = append(packets, p)
+		}
+	}
+
+	return packets, nil
+}
+
+func decompress(protoVer uint16, body []byte) ([]byte, error) {
+	var r io.Reader
+	switch protoVer {
+	case ProtoVerZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: zlib: %w", ErrBadPacket, err)
+		}
+		defer zr.Close()
+		r = zr
+	case ProtoVerBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return body, nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, maxPacketLen))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decompress (protover=%d): %w", ErrBadPacket, protoVer, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,211 @@
+// Package ratelimit provides a token bucket rate limiter with burst,
+// per-key buckets and a daily quota.
+//
+//	l := ratelimit.New(15*time.Second, ratelimit.WithBurst(3), ratelimit.WithDailyQuota(500))
+//	if ok, wait := l.Allow(""); !ok {
+//		// try again in wait
+//	}
+//
+// The bucket of a key holds at most burst tokens, and refills one token
+// every interval. Each Allow takes one. The daily quota counts the tokens
+// taken in a (local) day: no more tokens until the next midnight after it's
+// used up.
+//
+// With burst 1 and no quota, it's a cooldown: one call per interval.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter. Each key has its own bucket
+// (and daily quota). It's safe for concurrent use.
+//
+// A nil *Limiter allows everything.
+type Limiter struct {
+	interval time.Duration // refills a token every interval: 0 for no rate limit
+	burst    int           // capacity of the buckets
+	quota    int           // tokens a day of each key: 0 for no quota
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	now func() time.Time // time.Now, replaced in tests
+}
+
+// bucket of a key.
+type bucket struct {
+	tokens float64   // tokens at last
+	last   time.Time // last refilled
+
+	day  time.Time // the (local) midnight of the day used counted in
+	used int       // tokens taken in the day
+}
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithBurst sets the capacity of the buckets: how many tokens can be
+// saved up to be taken at once. 1 by default.
+func WithBurst(burst int) Option {
+	return func(l *Limiter) {
+		if burst > 0 {
+			l.burst = burst
+		}
+	}
+}
+
+// WithDailyQuota sets how many tokens a key can take in a (local) day.
+// 0 (default) for no quota.
+func WithDailyQuota(quota int) Option {
+	return func(l *Limiter) {
+		if quota > 0 {
+			l.quota = quota
+		}
+	}
+}
+
+// maxIdleBuckets is the number of buckets to keep before forgetting
+// the ones that are as good as new.
+const maxIdleBuckets = 1024
+
+// New creates a Limiter that refills a token every interval.
+// Interval 0 for no rate limit (the daily quota only, if any).
+func New(interval time.Duration, opts ...Option) *Limiter {
+	l := &Limiter{
+		interval: interval,
+		burst:    1,
+		buckets:  map[string]*bucket{},
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Allow takes a token for the key. If there is none, it returns false and
+// how long to wait for the next one: until the bucket refills it, or until
+// the next midnight if the daily quota is used up.
+func (l *Limiter) Allow(key string) (ok bool, wait time.Duration) {
+	if l.unlimited() {
+		return true, 0
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+	if wait = l.wait(b, now); wait > 0 {
+		return false, wait
+	}
+	if l.interval > 0 {
+		b.tokens--
+	}
+	b.used++
+	return true, 0
+}
+
+// Wait returns how long to wait for a token of the key, without taking it.
+// 0 if there is one right now.
+func (l *Limiter) Wait(key string) time.Duration {
+	if l.unlimited() {
+		return 0
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wait(l.bucket(key, now), now)
+}
+
+// Remaining returns the tokens left in the daily quota of the key.
+// -1 for no quota.
+func (l *Limiter) Remaining(key string) int {
+	if l == nil || l.quota <= 0 {
+		return -1
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.quota - l.bucket(key, now).used
+}
+
+// Interval returns the interval of the refills. 0 for no rate limit.
+func (l *Limiter) Interval() time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.interval
+}
+
+// unlimited reports whether the Limiter allows everything:
+// nil, or neither the rate limit nor the quota.
+func (l *Limiter) unlimited() bool {
+	return l == nil || (l.interval <= 0 && l.quota <= 0)
+}
+
+// bucket returns the bucket of the key refilled to now.
+// It should be called with l.mu held.
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	today := midnight(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.forgetIdle(now)
+		}
+		b = &bucket{tokens: float64(l.burst), last: now, day: today}
+		l.buckets[key] = b
+	}
+
+	if l.interval > 0 && now.After(b.last) {
+		b.tokens += float64(now.Sub(b.last)) / float64(l.interval)
+		if b.tokens > float64(l.burst) {
+			b.tokens = float64(l.burst)
+		}
+	}
+	b.last = now
+	if !b.day.Equal(today) {
+		b.day = today
+		b.used = 0
+	}
+	return b
+}
+
+// wait returns how long to wait for a token from the bucket.
+func (l *Limiter) wait(b *bucket, now time.Time) time.Duration {
+	if l.quota > 0 && b.used >= l.quota {
+		return midnight(now).AddDate(0, 0, 1).Sub(now)
+	}
+	if l.interval > 0 && b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(l.interval))
+		if wait <= 0 { // rounding: just a moment
+			wait = time.Nanosecond
+		}
+		return wait
+	}
+	return 0
+}
+
+// forgetIdle deletes the buckets that are full and have taken nothing
+// today (if there is a quota): they are the same as new ones.
+func (l *Limiter) forgetIdle(now time.Time) {
+	today := midnight(now)
+	for key, b := range l.buckets {
+		full := l.interval <= 0 ||
+			b.tokens+float64(now.Sub(b.last))/float64(l.interval) >= float64(l.burst)
+		if full && (l.quota <= 0 || b.used == 0 || !b.day.Equal(today)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// midnight returns the start of the (local) day of t.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock for tests, moved by hand.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time      { return c.t }
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+func newFakeClock(hour, min int) *fakeClock {
+	return &fakeClock{time.Date(2023, 5, 1, hour, min, 0, 0, time.Local)}
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	clock := newFakeClock(12, 0)
+	l := New(10*time.Second, WithBurst(3))
+	l.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("Allow #%d: want ok within the burst", i)
+		}
+	}
+	if ok, wait := l.Allow("a"); ok || wait != 10*time.Second {
+		t.Errorf("Allow after the burst = %v, %v; want false, 10s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("Allow(b): want ok, buckets are per key")
+	}
+
+	clock.add(4 * time.Second)
+	if wait := l.Wait("a"); wait != 6*time.Second {
+		t.Errorf("Wait = %v, want 6s", wait)
+	}
+	clock.add(6 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("Allow after the interval: want ok")
+	}
+}
+
+func TestLimiter_DailyQuota(t *testing.T) {
+	clock := newFakeClock(23, 0)
+	l := New(0, WithDailyQuota(2))
+	l.now = clock.now
+
+	l.Allow("a")
+	l.Allow("a")
+	if got := l.Remaining("a"); got != 0 {
+		t.Errorf("Remaining = %v, want 0", got)
+	}
+	if ok, wait := l.Allow("a"); ok || wait != time.Hour {
+		t.Errorf("Allow over the quota = %v, %v; want false, 1h (until midnight)", ok, wait)
+	}
+
+	clock.add(time.Hour)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("Allow on the next day: want ok")
+	}
+	if got := l.Remaining("a"); got != 1 {
+		t.Errorf("Remaining = %v, want 1", got)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	if ok, wait := l.Allow("a"); !ok || wait != 0 {
+		t.Errorf("nil Limiter: Allow = %v, %v; want true, 0", ok, wait)
+	}
+}
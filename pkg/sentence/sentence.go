@@ -0,0 +1,154 @@
+// Package sentence splits mixed Chinese / English text into sentences.
+package sentence
+
+import (
+	"strings"
+	"unicode"
+)
+
+// terminators end a sentence.
+// '.' is special: it ends a sentence only if followed by a space or the end
+// of the text (so "3.14" and "example.com" are not split).
+const terminators = "。！？!?；;…\n"
+
+// clauseSeparators end a clause (a part of a sentence).
+const clauseSeparators = "，,、：:"
+
+// closers are the closing quotes and brackets that stick to the terminator
+// before them: 他说：“好。” is one sentence.
+const closers = "”’\"'」』）)】》"
+
+// Split splits text into sentences at Chinese and English sentence
+// boundaries. The punctuation ending a sentence stays with it.
+// Sentences are trimmed, empty ones are dropped.
+func Split(text string) []string {
+	return split(text, terminators)
+}
+
+// SplitClauses is like Split, but also splits at the clause separators
+// (commas, colons, etc.). It's useful to break an overly long sentence.
+func SplitClauses(text string) []string {
+	return split(text, terminators+clauseSeparators)
+}
+
+func split(text string, ends string) []string {
+	var parts []string
+	runes := []rune(text)
+
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isEnd(runes, i, ends) {
+			continue
+		}
+		i = endRun(runes, i, ends)
+		parts = appendTrimmed(parts, string(runes[start:i+1]))
+		start = i + 1
+	}
+	parts = appendTrimmed(parts, string(runes[start:]))
+	return parts
+}
+
+// endRun returns the index of the last rune of the sentence ending at i:
+// a run of ends ("？！", "……", "...") followed by the closers.
+func endRun(runes []rune, i int, ends string) int {
+	for i+1 < len(runes) && (isEnd(runes, i+1, ends) || runes[i+1] == '.') {
+		i++
+	}
+	for i+1 < len(runes) && strings.ContainsRune(closers, runes[i+1]) {
+		i++
+	}
+	return i
+}
+
+// Accumulator collects a text arriving piece by piece (e.g. a streaming
+// chatbot reply), and hands out the sentences as soon as they are complete.
+//
+//	var acc Accumulator
+//	acc.Write("你好。今天")  // ["你好。"]
+//	acc.Write("天气不错！")  // []: maybe "！！" is coming
+//	acc.Write("我们")        // ["今天天气不错！"]
+//	acc.Flush()             // "我们"
+//
+// A sentence is complete only when something follows its ending, since the
+// next piece may continue the run of ends or the closers ("。”"), or
+// decide a '.' ("3." + "14"). Flush returns the rest at the end.
+//
+// The zero value is ready to use. An Accumulator is not safe for
+// concurrent use.
+type Accumulator struct {
+	buf []rune
+}
+
+// Write appends the piece and returns the sentences completed by it.
+func (a *Accumulator) Write(piece string) []string {
+	a.buf = append(a.buf, []rune(piece)...)
+
+	var sentences []string
+	start := 0
+	for i := 0; i < len(a.buf); i++ {
+		if !isEnd(a.buf, i, terminators) {
+			continue
+		}
+		end := endRun(a.buf, i, terminators)
+		if end+1 == len(a.buf) {
+			break // the run may go on in the next piece, or "3." may be "3.14"
+		}
+		sentences = appendTrimmed(sentences, string(a.buf[start:end+1]))
+		start = end + 1
+		i = end
+	}
+	a.buf = append(a.buf[:0], a.buf[start:]...)
+	return sentences
+}
+
+// Flush returns the rest (trimmed, maybe an incomplete sentence)
+// and resets the Accumulator.
+func (a *Accumulator) Flush() string {
+	rest := strings.TrimSpace(string(a.buf))
+	a.buf = a.buf[:0]
+	return rest
+}
+
+func isEnd(runes []rune, i int, ends string) bool {
+	r := runes[i]
+	if r == '.' {
+		return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	return strings.ContainsRune(ends, r)
+}
+
+func appendTrimmed(parts []string, s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return parts
+	}
+	return append(parts, s)
+}
+
+// Join joins the sentences back into a text. A space is put between two
+// sentences only if both sides are not CJK (e.g. English).
+func Join(sentences []string) string {
+	var sb strings.Builder
+	for i, s := range sentences {
+		if i > 0 && needSpace(sentences[i-1], s) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+func needSpace(prev, next string) bool {
+	if prev == "" || next == "" {
+		return false
+	}
+	last := []rune(prev)[len([]rune(prev))-1]
+	first := []rune(next)[0]
+	return !isCJK(last) && !isCJK(first)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJK punctuation
+		(r >= 0xFF00 && r <= 0xFFEF) // full width forms
+}
@@ -0,0 +1,95 @@
+package sentence
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"chinese", "你好。今天天气不错！要出去玩吗？", []string{"你好。", "今天天气不错！", "要出去玩吗？"}},
+		{"english", "Hello there. How are you? Fine!", []string{"Hello there.", "How are you?", "Fine!"}},
+		{"mixed", "我喜欢 Go. 你呢？", []string{"我喜欢 Go.", "你呢？"}},
+		{"decimal", "pi is 3.14 or so.", []string{"pi is 3.14 or so."}},
+		{"runOfEnds", "真的吗？！好吧……那算了", []string{"真的吗？！", "好吧……", "那算了"}},
+		{"ellipsis", "Well... ok.", []string{"Well...", "ok."}},
+		{"quote", "他说：“好。”然后走了。", []string{"他说：“好。”", "然后走了。"}},
+		{"newline", "第一行\n\n第二行", []string{"第一行", "第二行"}},
+		{"empty", "  ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitClauses(t *testing.T) {
+	got := SplitClauses("首先，我们需要水；其次, we need food.")
+	want := []string{"首先，", "我们需要水；", "其次,", "we need food."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitClauses() = %q, want %q", got, want)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		sentences []string
+		want      string
+	}{
+		{[]string{"你好。", "再见。"}, "你好。再见。"},
+		{[]string{"Hello.", "Bye."}, "Hello. Bye."},
+		{[]string{"Hello.", "你好。"}, "Hello.你好。"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := Join(tt.sentences); got != tt.want {
+			t.Errorf("Join(%q) = %q, want %q", tt.sentences, got, tt.want)
+		}
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	var acc Accumulator
+	steps := []struct {
+		piece string
+		want  []string
+	}{
+		{"你好。今天", []string{"你好。"}},
+		{"天气不错！", nil},
+		{"！我们", []string{"今天天气不错！！"}},
+		{"去 pi 3.", nil},
+		{"14 号楼吧。”", nil},
+		{"Ok", []string{"我们去 pi 3.14 号楼吧。”"}},
+	}
+	for _, s := range steps {
+		if got := acc.Write(s.piece); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("Write(%q) = %q, want %q", s.piece, got, s.want)
+		}
+	}
+	if got := acc.Flush(); got != "Ok" {
+		t.Errorf("Flush() = %q, want %q", got, "Ok")
+	}
+	if got := acc.Flush(); got != "" {
+		t.Errorf("Flush() again = %q, want empty", got)
+	}
+}
+
+func TestAccumulator_SameAsSplit(t *testing.T) {
+	text := "真的吗？！好吧……那算了。Well... ok. 他说：“好。”然后走了。pi is 3.14"
+	var acc Accumulator
+	var got []string
+	for _, r := range text { // rune by rune: the worst case
+		got = append(got, acc.Write(string(r))...)
+	}
+	got = appendTrimmed(got, acc.Flush())
+	if want := Split(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("accumulated %q, want %q", got, want)
+	}
+}
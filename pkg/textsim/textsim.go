@@ -0,0 +1,92 @@
+// Package textsim provides simple text normalization and similarity
+// measures for short messages (danmaku, questions).
+package textsim
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// Normalize folds the full-width characters, lowercases the letters
+// and removes the spaces, punctuation and symbols:
+//
+//	"Ｈｅｌｌｏ，  World!" -> "helloworld"
+func Normalize(s string) string {
+	s = width.Fold.String(s)
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// Shingles returns the set of k-rune shingles (substrings) of s.
+// If s is shorter than k, the set contains s itself (if not empty).
+func Shingles(s string, k int) map[string]struct{} {
+	runes := []rune(s)
+	set := map[string]struct{}{}
+
+	if len(runes) == 0 {
+		return set
+	}
+	if len(runes) <= k {
+		set[s] = struct{}{}
+		return set
+	}
+
+	for i := 0; i+k <= len(runes); i++ {
+		set[string(runes[i:i+k])] = struct{}{}
+	}
+	return set
+}
+
+// Similarity is the Jaccard similarity of the bigram shingles of
+// the normalized a and b: 0 (nothing in common) ~ 1 (the same).
+func Similarity(a, b string) float64 {
+	return Jaccard(Shingles(Normalize(a), 2), Shingles(Normalize(b), 2))
+}
+
+// Jaccard similarity of two sets: |a ∩ b| / |a ∪ b|.
+// Two empty sets are considered the same (1).
+func Jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	inter := 0
+	for s := range a {
+		if _, ok := b[s]; ok {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	return float64(inter) / float64(union)
+}
+
+// RepeatRatio is the share of the most frequent rune in s:
+//
+//	"哈哈哈哈" -> 1, "666" -> 1, "你好啊" -> 0.33
+//
+// It's 0 for an empty s.
+func RepeatRatio(s string) float64 {
+	counts := map[rune]int{}
+	total, max := 0, 0
+	for _, r := range s {
+		counts[r]++
+		total++
+		if counts[r] > max {
+			max = counts[r]
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(max) / float64(total)
+}
@@ -0,0 +1,54 @@
+package textsim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Ｈｅｌｌｏ，  World!", "helloworld"},
+		{"你好 呀～", "你好呀"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"哈哈哈哈", "哈哈哈哈哈哈", 1, 1},
+		{"你是谁", "你是谁？", 1, 1},
+		{"你是谁呀", "你是谁", 0.6, 0.7},
+		{"今天天气怎么样", "晚饭吃什么", 0, 0},
+	}
+	for _, tt := range tests {
+		got := Similarity(tt.a, tt.b)
+		if got < tt.min-1e-9 || got > tt.max+1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want in [%v, %v]", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRepeatRatio(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"哈哈哈哈", 1},
+		{"666", 1},
+		{"你好啊", 1.0 / 3},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := RepeatRatio(tt.s); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("RepeatRatio(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package wordfilter finds sensitive words in text with an Aho-Corasick
+// automaton.
+//
+// Both the words and the text are normalized before matching:
+// full-width characters are folded to half-width, letters are lowercased,
+// and spaces, punctuation and symbols in the text are skipped, so that
+// "f u c k", "ｆｕｃｋ" and "f*u-c.k" all match the word "fuck".
+package wordfilter
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// normalize folds r for matching. skip is true if r should be ignored
+// (spaces, punctuation, symbols and invisible format characters).
+func normalize(r rune) (n rune, skip bool) {
+	if folded := width.Fold.String(string(r)); folded != "" {
+		for _, f := range folded {
+			r = f
+			break
+		}
+	}
+	if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.Is(unicode.Cf, r) {
+		return r, true
+	}
+	return unicode.ToLower(r), false
+}
+
+// Match is a word found in the text.
+type Match struct {
+	Start, End int    // byte offsets of the match in the original text: text[Start:End]
+	Word       string // the matched word (as added)
+	Category   string
+}
+
+type pattern struct {
+	word     string
+	category string
+	runes    int // length in normalized runes
+}
+
+type node struct {
+	next  map[rune]int
+	fail  int
+	words []int // indexes of patterns ending here
+	out   []int // indexes of patterns ending here, including via fail links: by Build
+}
+
+// Matcher is an Aho-Corasick automaton of the words.
+//
+// Add words, then Build, then Find. Find builds the Matcher if it is not
+// built (or words are added after Build), so Build is only to pay the cost
+// in advance. A Matcher is safe for concurrent use.
+type Matcher struct {
+	mu       sync.RWMutex
+	nodes    []node
+	patterns []pattern
+	built    bool
+}
+
+func NewMatcher() *Matcher {
+	return &Matcher{nodes: []node{{next: map[rune]int{}}}}
+}
+
+// Add a word of the category. Empty words (after normalization) are ignored.
+func (m *Matcher) Add(word string, category string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, n := 0, 0
+	for _, r := range word {
+		r, skip := normalize(r)
+		if skip {
+			continue
+		}
+		nxt, ok := m.nodes[cur].next[r]
+		if !ok {
+			nxt = len(m.nodes)
+			m.nodes = append(m.nodes, node{next: map[rune]int{}})
+			m.nodes[cur].next[r] = nxt
+		}
+		cur = nxt
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	m.patterns = append(m.patterns, pattern{word: word, category: category, runes: n})
+	m.nodes[cur].words = append(m.nodes[cur].words, len(m.patterns)-1)
+	m.built = false
+}
+
+// AddReader adds words from r: one word per line.
+// Empty lines and lines starting with "#" are ignored.
+func (m *Matcher) AddReader(r io.Reader, category string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m.Add(line, category)
+	}
+	return scanner.Err()
+}
+
+// AddFile adds words from the file. See AddReader.
+func (m *Matcher) AddFile(path string, category string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.AddReader(f, category)
+}
+
+// Len returns the number of words added.
+func (m *Matcher) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.patterns)
+}
+
+// Build the fail links after adding words. Building a built Matcher
+// does nothing.
+func (m *Matcher) Build() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.build()
+}
+
+// build the fail links if not built. m.mu must be held for writing.
+func (m *Matcher) build() {
+	if m.built {
+		return
+	}
+	for i := range m.nodes {
+		m.nodes[i].out = append([]int(nil), m.nodes[i].words...)
+	}
+
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		m.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for r, child := range m.nodes[cur].next {
+			f := m.nodes[cur].fail
+			for {
+				if nxt, ok := m.nodes[f].next[r]; ok && nxt != child {
+					m.nodes[child].fail = nxt
+					break
+				}
+				if f == 0 {
+					m.nodes[child].fail = 0
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+
+	m.built = true
+}
+
+// Find returns all the matches in the text (possibly overlapping),
+// ordered by the end position. The Matcher is built first if it is not.
+func (m *Matcher) Find(text string) []Match {
+	m.mu.RLock()
+	for !m.built {
+		m.mu.RUnlock()
+		m.mu.Lock()
+		m.build()
+		m.mu.Unlock()
+		m.mu.RLock()
+	}
+	defer m.mu.RUnlock()
+
+	var matches []Match
+	var starts []int // byte offsets of the non-skipped runes
+
+	cur := 0
+	for i, r := range text {
+		n, skip := normalize(r)
+		if skip {
+			continue
+		}
+		starts = append(starts, i)
+
+		for {
+			if nxt, ok := m.nodes[cur].next[n]; ok {
+				cur = nxt
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+
+		end := i + len(string(r))
+		for _, p := range m.nodes[cur].out {
+			pat := m.patterns[p]
+			matches = append(matches, Match{
+				Start:    starts[len(starts)-pat.runes],
+				End:      end,
+				Word:     pat.word,
+				Category: pat.category,
+			})
+		}
+	}
+
+	return matches
+}
+
+// Contains reports whether any word is found in the text.
+func (m *Matcher) Contains(text string) bool {
+	return len(m.Find(text)) > 0
+}
+
+// Mask replaces the runes of the matches in the text with the mask rune.
+func Mask(text string, matches []Match, mask rune) string {
+	if len(matches) == 0 {
+		return text
+	}
+
+	masked := make([]bool, len(text))
+	for _, match := range matches {
+		for i := match.Start; i < match.End && i < len(text); i++ {
+			masked[i] = true
+		}
+	}
+
+	var sb strings.Builder
+	for i, r := range text {
+		if masked[i] && !unicode.IsSpace(r) {
+			sb.WriteRune(mask)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
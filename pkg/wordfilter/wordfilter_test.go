@@ -0,0 +1,110 @@
+package wordfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestMatcher() *Matcher {
+	m := NewMatcher()
+	m.Add("he", "test")
+	m.Add("she", "test")
+	m.Add("hers", "test")
+	m.Add("坏蛋", "insult")
+	m.Add("Bad Word", "insult")
+	m.Build()
+	return m
+}
+
+func TestMatcher_Find(t *testing.T) {
+	m := newTestMatcher()
+
+	tests := []struct {
+		name  string
+		text  string
+		words []string
+	}{
+		{"overlapping", "ushers", []string{"she", "he", "hers"}},
+		{"none", "hello", []string{"he"}},
+		{"chinese", "你这个坏蛋！", []string{"坏蛋"}},
+		{"insertedSymbols", "你这个坏*蛋", []string{"坏蛋"}},
+		{"insertedSpaces", "你这个 坏 　蛋", []string{"坏蛋"}},
+		{"fullWidth", "ＢＡＤ　ｗｏｒｄ", []string{"Bad Word"}},
+		{"caseAndPunct", "b.a.d-W.O.R.D", []string{"Bad Word"}},
+		{"notMatch", "好蛋", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := m.Find(tt.text)
+			var got []string
+			for _, match := range matches {
+				got = append(got, match.Word)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.words, ",") {
+				t.Errorf("Find(%q) = %v, want %v", tt.text, got, tt.words)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	m := newTestMatcher()
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"你这个坏蛋！", "你这个**！"},
+		{"你这个坏-蛋！", "你这个***！"},
+		{"a bad word now", "a *** **** now"},
+		{"nothing", "nothing"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.text, m.Find(tt.text), '*'); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMatcher_AddReader(t *testing.T) {
+	m := NewMatcher()
+	err := m.AddReader(strings.NewReader("# comment\n\nfoo\n  bar  \n"), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", m.Len())
+	}
+	m.Build()
+	if !m.Contains("xxBARxx") {
+		t.Error("Contains(xxBARxx) = false, want true")
+	}
+}
+
+func TestMatcher_BuildTwice(t *testing.T) {
+	m := NewMatcher()
+	m.Add("he", "c")
+	m.Add("she", "c")
+	m.Build()
+	m.Build()
+	if got := m.Find("she"); len(got) != 2 {
+		t.Errorf("Find(she) after Build twice = %v, want 2 matches", got)
+	}
+
+	// rebuilt after adding more words
+	m.Add("s", "c")
+	m.Build()
+	if got := m.Find("she"); len(got) != 3 {
+		t.Errorf("Find(she) after Add and Build = %v, want 3 matches", got)
+	}
+}
+
+func TestMatcher_AddAfterBuild(t *testing.T) {
+	m := NewMatcher()
+	m.Add("he", "c")
+	m.Build()
+	m.Add("she", "c") // no Build: Find builds it
+	if got := m.Find("she"); len(got) != 2 {
+		t.Errorf("Find(she) after Add without Build = %v, want 2 matches", got)
+	}
+}
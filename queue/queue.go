@@ -0,0 +1,405 @@
+// Package queue implements a bounded priority queue of TextIn,
+// from which the chatbot stage pulls messages when it is ready.
+//
+// Compared to the windowed PriorityReduceFilter, nothing is thrown away
+// just because a higher-priority message arrived in the same window:
+//
+//   - entries age: the longer a message waits, the higher its priority;
+//   - entries expire: a message waiting longer than TTL is dropped;
+//   - when the queue is full, the lowest-priority entry is evicted;
+//   - protected entries (super chats by default) never expire and are
+//     never evicted until they are popped and answered: a failed one is
+//     requeued, and popped again after a backoff.
+package queue
+
+import (
+	"context"
+	"muvtuberdriver/model"
+	"sync"
+	"time"
+
+	"github.com/cdfmlr/ellipsis"
+	"golang.org/x/exp/slog"
+)
+
+// PriorityQueue is a bounded priority queue of TextIn with aging and TTL.
+// It is safe for concurrent use.
+type PriorityQueue struct {
+	capacity      int
+	agingInterval time.Duration
+	ttl           time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+	protected     func(t *model.TextIn) bool
+	discard       func(t *model.TextIn) bool
+
+	mu      sync.Mutex
+	entries []*entry
+	popped  map[*model.TextIn]*entry // the protected entries popped: may be requeued
+	notify  chan struct{}            // wakes up a waiting Pop
+
+	now func() time.Time // for testing
+}
+
+type entry struct {
+	textIn    *model.TextIn
+	priority  model.Priority // of the textIn when pushed, before aging
+	enqueued  time.Time
+	notBefore time.Time // requeued: not popped before this
+	retries   int       // times requeued
+	popped    time.Time
+}
+
+func newEntry(textIn *model.TextIn, now time.Time) *entry {
+	return &entry{textIn: textIn, priority: textIn.Priority, enqueued: now}
+}
+
+type Option func(q *PriorityQueue)
+
+// WithCapacity sets the max number of (unprotected) entries in the queue.
+// Default: 64.
+func WithCapacity(capacity int) Option {
+	return func(q *PriorityQueue) {
+		if capacity > 0 {
+			q.capacity = capacity
+		}
+	}
+}
+
+// WithAging raises the priority of an entry by 1 every interval it waits,
+// up to model.PriorityHighest. Zero disables aging.
+// Default: 10s.
+func WithAging(interval time.Duration) Option {
+	return func(q *PriorityQueue) {
+		q.agingInterval = interval
+	}
+}
+
+// WithTTL drops the unprotected entries waiting longer than ttl.
+// Zero means never expire.
+// Default: 60s.
+func WithTTL(ttl time.Duration) Option {
+	return func(q *PriorityQueue) {
+		q.ttl = ttl
+	}
+}
+
+// WithProtected sets the func deciding which entries are never dropped
+// (neither expired nor evicted) until popped.
+// Default: IsSuperChat.
+func WithProtected(protected func(t *model.TextIn) bool) Option {
+	return func(q *PriorityQueue) {
+		q.protected = protected
+	}
+}
+
+// WithDiscard sets the func deciding which entries should be dropped
+// before popping, even if protected. E.g. a deleted super chat.
+func WithDiscard(discard func(t *model.TextIn) bool) Option {
+	return func(q *PriorityQueue) {
+		q.discard = discard
+	}
+}
+
+// WithMaxRetries limits how many times a protected entry can be requeued
+// after it failed to be answered. Default: 0, no limit.
+func WithMaxRetries(n int) Option {
+	return func(q *PriorityQueue) {
+		q.maxRetries = n
+	}
+}
+
+// WithRetryBackoff sets how long a requeued entry waits before it can be
+// popped again: backoff for the first retry, doubled for each one after,
+// up to maxRetryBackoff. Default: 5s.
+func WithRetryBackoff(backoff time.Duration) Option {
+	return func(q *PriorityQueue) {
+		q.retryBackoff = backoff
+	}
+}
+
+// maxRetryBackoff caps the backoff of the requeued entries.
+const maxRetryBackoff = time.Minute
+
+// poppedTTL is how long a popped protected entry is kept for Requeue.
+// A textIn requeued later than that is requeued as a new one.
+const poppedTTL = 10 * time.Minute
+
+// IsSuperChat is the default protected func.
+func IsSuperChat(t *model.TextIn) bool {
+	return t.Source == model.SourceSuperChat
+}
+
+func New(opts ...Option) *PriorityQueue {
+	q := &PriorityQueue{
+		capacity:      64,
+		agingInterval: 10 * time.Second,
+		ttl:           60 * time.Second,
+		retryBackoff:  5 * time.Second,
+		protected:     IsSuperChat,
+		popped:        map[*model.TextIn]*entry{},
+		notify:        make(chan struct{}, 1),
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// Len returns the number of entries in the queue (including the expired
+// ones that have not been cleaned up yet).
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Push adds textIn to the queue. If the queue is full, the entry with the
+// lowest priority (maybe the textIn itself) is evicted, unless all the
+// entries are protected.
+func (q *PriorityQueue) Push(textIn *model.TextIn) {
+	if textIn == nil {
+		return
+	}
+	q.push(newEntry(textIn, q.now()))
+}
+
+func (q *PriorityQueue) push(e *entry) {
+	q.mu.Lock()
+	q.expire()
+	q.entries = append(q.entries, e)
+	q.evict()
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// PushFrom pushes all the TextIns from ch into the queue,
+// until ch is closed or ctx is done.
+func (q *PriorityQueue) PushFrom(ctx context.Context, ch <-chan *model.TextIn) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case textIn, ok := <-ch:
+			if !ok {
+				return
+			}
+			q.Push(textIn)
+		}
+	}
+}
+
+// Requeue puts a popped textIn back to the queue if it is protected.
+// It is used when the textIn failed to be answered.
+//
+// It keeps its place (the time it was pushed first, so it keeps aging),
+// but can not be popped again until a backoff (see WithRetryBackoff):
+// the chatbot may be failing fast, e.g. with the circuit open.
+//
+// Returns false if the textIn is not requeued: not protected,
+// or retried too many times (see WithMaxRetries).
+func (q *PriorityQueue) Requeue(textIn *model.TextIn) bool {
+	if textIn == nil || !q.protected(textIn) {
+		return false
+	}
+	now := q.now()
+
+	q.mu.Lock()
+	e, ok := q.popped[textIn]
+	delete(q.popped, textIn)
+	q.mu.Unlock()
+	if !ok { // not popped from this queue, or popped too long ago
+		e = newEntry(textIn, now)
+	}
+
+	if q.maxRetries > 0 && e.retries >= q.maxRetries {
+		return false
+	}
+	e.retries++
+	e.notBefore = now.Add(q.backoff(e.retries))
+	textIn.Priority = e.priority // the aged one is set by Pop
+	q.push(e)
+	return true
+}
+
+// backoff of the retry-th retry: retryBackoff * 2^(retry-1), capped.
+func (q *PriorityQueue) backoff(retry int) time.Duration {
+	backoff := q.retryBackoff
+	for i := 1; i < retry && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// Pop removes and returns the entry with the highest (aged) priority,
+// the oldest one first if several. The Priority of the returned TextIn is
+// set to the aged priority.
+//
+// Pop blocks until there is an entry (not waiting for the retry backoff)
+// or ctx is done.
+func (q *PriorityQueue) Pop(ctx context.Context) (*model.TextIn, error) {
+	for {
+		textIn, wait := q.tryPop()
+		if textIn != nil {
+			return textIn, nil
+		}
+		if err := q.wait(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until an entry is pushed, the wait (if > 0) elapsed,
+// or ctx is done.
+func (q *PriorityQueue) wait(ctx context.Context, wait time.Duration) error {
+	var retry <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		retry = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.notify:
+	case <-retry:
+	}
+	return nil
+}
+
+// tryPop pops the best entry, or returns nil and how long to wait for a
+// requeued entry to be poppable (0 for none).
+func (q *PriorityQueue) tryPop() (textIn *model.TextIn, wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire()
+
+	now := q.now()
+	best := -1
+	var bestPriority model.Priority
+	for i, e := range q.entries {
+		if e.notBefore.After(now) {
+			if w := e.notBefore.Sub(now); wait == 0 || w < wait {
+				wait = w
+			}
+			continue
+		}
+		p := q.agedPriority(e, now)
+		if best < 0 || p > bestPriority ||
+			(p == bestPriority && e.enqueued.Before(q.entries[best].enqueued)) {
+			best, bestPriority = i, p
+		}
+	}
+	if best < 0 {
+		return nil, wait
+	}
+
+	e := q.entries[best]
+	q.entries = append(q.entries[:best], q.entries[best+1:]...)
+
+	if q.protected(e.textIn) { // may be requeued
+		e.popped = now
+		q.popped[e.textIn] = e
+		q.forgetPopped(now)
+	}
+
+	if bestPriority != e.priority {
+		slog.Info("[PriorityQueue] aged.",
+			"author", e.textIn.Author,
+			"content", ellipsis.Centering(e.textIn.Content, 17),
+			"priority", e.priority, "aged", bestPriority)
+		e.textIn.Priority = bestPriority
+	}
+	return e.textIn, 0
+}
+
+// forgetPopped forgets the popped entries older than poppedTTL:
+// answered (or given up) long ago. q.mu must be held.
+func (q *PriorityQueue) forgetPopped(now time.Time) {
+	for textIn, e := range q.popped {
+		if now.Sub(e.popped) > poppedTTL {
+			delete(q.popped, textIn)
+		}
+	}
+}
+
+// agedPriority: Priority + 1 every agingInterval waited.
+// Aging never raises a priority above model.PriorityHighest.
+func (q *PriorityQueue) agedPriority(e *entry, now time.Time) model.Priority {
+	p := e.priority
+	if q.agingInterval <= 0 || p >= model.PriorityHighest {
+		return p
+	}
+	p += model.Priority(now.Sub(e.enqueued) / q.agingInterval)
+	if p > model.PriorityHighest {
+		p = model.PriorityHighest
+	}
+	return p
+}
+
+// expire removes the discarded and the expired unprotected entries.
+// q.mu must be held.
+func (q *PriorityQueue) expire() {
+	now := q.now()
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		switch {
+		case q.discard != nil && q.discard(e.textIn):
+			q.logDrop("discarded", e)
+		case q.ttl > 0 && now.Sub(e.enqueued) > q.ttl && !q.protected(e.textIn):
+			q.logDrop("expired", e)
+		default:
+			kept = append(kept, e)
+		}
+	}
+	for i := len(kept); i < len(q.entries); i++ {
+		q.entries[i] = nil // let gc
+	}
+	q.entries = kept
+}
+
+// evict removes the lowest-priority unprotected entries (the newest one
+// first if several) until the number of unprotected entries fits the
+// capacity. q.mu must be held.
+func (q *PriorityQueue) evict() {
+	now := q.now()
+	for {
+		unprotected := 0
+		worst := -1
+		var worstPriority model.Priority
+		for i, e := range q.entries {
+			if q.protected(e.textIn) {
+				continue
+			}
+			unprotected++
+			p := q.agedPriority(e, now)
+			if worst < 0 || p < worstPriority ||
+				(p == worstPriority && !e.enqueued.Before(q.entries[worst].enqueued)) {
+				worst, worstPriority = i, p
+			}
+		}
+		if unprotected <= q.capacity || worst < 0 {
+			return
+		}
+		q.logDrop("evicted", q.entries[worst])
+		q.entries = append(q.entries[:worst], q.entries[worst+1:]...)
+	}
+}
+
+func (q *PriorityQueue) logDrop(reason string, e *entry) {
+	slog.Info("[PriorityQueue] drop.",
+		"reason", reason,
+		"author", e.textIn.Author,
+		"content", ellipsis.Centering(e.textIn.Content, 17),
+		"priority", e.textIn.Priority,
+		"waited", q.now().Sub(e.enqueued))
+}
@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"context"
+	"muvtuberdriver/model"
+	"testing"
+	"time"
+)
+
+// fakeClock is a controllable q.now
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time      { return c.t }
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+func newTestQueue(opts ...Option) (*PriorityQueue, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	q := New(opts...)
+	q.now = clock.now
+	return q, clock
+}
+
+func dm(content string, priority model.Priority) *model.TextIn {
+	return model.NewTextIn(model.SourceDm, "someone", content, priority)
+}
+
+func superChat(content string) *model.TextIn {
+	return model.NewTextIn(model.SourceSuperChat, "rich", content, model.PriorityLow)
+}
+
+func mustPop(t *testing.T, q *PriorityQueue) *model.TextIn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	textIn, err := q.Pop(ctx)
+	if err != nil {
+		t.Fatalf("Pop() error: %v", err)
+	}
+	return textIn
+}
+
+func TestPriorityQueue_Order(t *testing.T) {
+	q, clock := newTestQueue(WithAging(0))
+
+	q.Push(dm("low", model.PriorityLow))
+	clock.add(time.Second)
+	q.Push(dm("high1", model.PriorityHigh))
+	clock.add(time.Second)
+	q.Push(dm("high2", model.PriorityHigh))
+
+	for _, want := range []string{"high1", "high2", "low"} {
+		if got := mustPop(t, q); got.Content != want {
+			t.Errorf("Pop() = %q, want %q", got.Content, want)
+		}
+	}
+}
+
+func TestPriorityQueue_Aging(t *testing.T) {
+	q, clock := newTestQueue(WithAging(10*time.Second), WithTTL(0))
+
+	q.Push(dm("old", model.PriorityLow))
+	clock.add(25 * time.Second) // +2: low -> high
+	q.Push(dm("new", model.PriorityNormal))
+
+	got := mustPop(t, q)
+	if got.Content != "old" {
+		t.Fatalf("Pop() = %q, want the aged one", got.Content)
+	}
+	if got.Priority != model.PriorityHigh {
+		t.Errorf("aged Priority = %v, want %v", got.Priority, model.PriorityHigh)
+	}
+}
+
+func TestPriorityQueue_TTLAndProtected(t *testing.T) {
+	q, clock := newTestQueue(WithTTL(time.Minute))
+
+	q.Push(dm("expired", model.PriorityHigh))
+	q.Push(superChat("sc"))
+	clock.add(2 * time.Minute)
+
+	if got := mustPop(t, q); got.Content != "sc" {
+		t.Errorf("Pop() = %q, want sc", got.Content)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", q.Len())
+	}
+}
+
+func TestPriorityQueue_Evict(t *testing.T) {
+	q, _ := newTestQueue(WithCapacity(2), WithAging(0))
+
+	q.Push(superChat("sc1"))
+	q.Push(dm("normal", model.PriorityNormal))
+	q.Push(dm("low", model.PriorityLow))
+	q.Push(superChat("sc2"))
+	q.Push(dm("high", model.PriorityHigh)) // evicts low
+
+	var got []string
+	for q.Len() > 0 {
+		got = append(got, mustPop(t, q).Content)
+	}
+	want := []string{"high", "normal", "sc1", "sc2"} // sc: PriorityLow but kept
+	if len(got) != len(want) {
+		t.Fatalf("popped %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("popped %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestPriorityQueue_Requeue(t *testing.T) {
+	q, clock := newTestQueue(WithMaxRetries(1))
+
+	if q.Requeue(dm("dm", model.PriorityLow)) {
+		t.Error("Requeue(dm) = true, want false")
+	}
+	sc := superChat("sc")
+	if !q.Requeue(sc) {
+		t.Fatal("Requeue(sc) = false, want true")
+	}
+	clock.add(time.Minute) // backoff
+	mustPop(t, q)
+	if q.Requeue(sc) {
+		t.Error("Requeue(sc) after max retries = true, want false")
+	}
+}
+
+func TestPriorityQueue_RequeueBackoff(t *testing.T) {
+	q, clock := newTestQueue(WithAging(30*time.Second), WithRetryBackoff(5*time.Second))
+
+	sc := superChat("sc")
+	q.Push(sc)
+	clock.add(20 * time.Second)
+	popped := mustPop(t, q)
+
+	for retry, backoff := range []time.Duration{5 * time.Second, 10 * time.Second} {
+		if !q.Requeue(popped) {
+			t.Fatalf("Requeue #%d = false, want true (no limit by default)", retry)
+		}
+		if got, wait := q.tryPop(); got != nil || wait != backoff {
+			t.Fatalf("tryPop() in backoff #%d = %v, %v; want nil, %v", retry, got, wait, backoff)
+		}
+		clock.add(backoff)
+		popped = mustPop(t, q)
+	}
+	// waited 35s since the first push: aged by 1
+	if want := model.PriorityNormal; popped.Priority != want {
+		t.Errorf("Priority after requeues = %v, want %v", popped.Priority, want)
+	}
+	if len(popped.Metadata) != 0 {
+		t.Errorf("Metadata = %v, want the queue state kept out of the message", popped.Metadata)
+	}
+}
+
+func TestPriorityQueue_PopBlocks(t *testing.T) {
+	q := New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Pop(ctx); err == nil {
+		t.Fatal("Pop() on empty queue: want ctx error")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(dm("hi", model.PriorityLow))
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if got, err := q.Pop(ctx); err != nil || got.Content != "hi" {
+		t.Errorf("Pop() = %v, %v, want hi", got, err)
+	}
+}
+
+func TestPriorityQueue_Discard(t *testing.T) {
+	q, _ := newTestQueue(WithDiscard(func(t *model.TextIn) bool {
+		return t.Content == "deleted"
+	}))
+	q.Push(superChat("deleted"))
+	q.Push(dm("kept", model.PriorityLow))
+
+	if got := mustPop(t, q); got.Content != "kept" {
+		t.Errorf("Pop() = %q, want kept", got.Content)
+	}
+}
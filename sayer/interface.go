@@ -6,3 +6,13 @@ type Sayer interface {
 	// Say text.
 	Say(text string) error
 }
+
+// PersonaSetter is a Sayer whose voice and looks can be changed at
+// runtime (e.g. to switch the persona).
+type PersonaSetter interface {
+	// SetTtsRole sets the TTS role (the voice).
+	SetTtsRole(role string)
+	// SetExpressions sets the live2d expressions to speak with:
+	// one of them is used for each Say. Empty for no expression.
+	SetExpressions(expressions []string)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"muvtuberdriver/audio"
 	"muvtuberdriver/live2d"
 	"strings"
@@ -47,6 +48,8 @@ type lipsyncSayer struct {
 
 	lipsyncStrategy LipsyncStrategy
 	ttsRole         string
+	expressions     []string // live2d expressions, for LipsyncStrategyAudioAnalyze
+	configMu        sync.RWMutex
 
 	// internal state
 
@@ -164,7 +167,7 @@ func (s *lipsyncSayer) say(text string) error {
 
 	if s.lipsyncStrategy == LipsyncStrategyAudioAnalyze {
 		logger.Info("[lipsyncSayer] LipsyncStrategyAudioAnalyze: Live2dSpeak", "len(audioContent)", len(audioContent))
-		err := s.live2dDriver.Live2dSpeak(audioContent, "", "") // TODO: expression, motion
+		err := s.live2dDriver.Live2dSpeak(audioContent, s.expression(), "") // TODO: motion
 		if err != nil {
 			logger.Warn("[lipsyncSayer] Live2dSpeak failed (LipsyncStrategyAudioAnalyze)",
 				"err", err, "falling-back-to", "LipsyncStrategyKeepMotion")
@@ -202,7 +205,40 @@ func (s *lipsyncSayer) shouldPlayAt() audio.PlayAt {
 
 // textToAudio converts text to audio via RPC.
 func (s *lipsyncSayer) textToAudio(text string) (format string, audio []byte, err error) {
-	return s.textAudioConverter.Say(s.ttsRole, text)
+	s.configMu.RLock()
+	role := s.ttsRole
+	s.configMu.RUnlock()
+
+	return s.textAudioConverter.Say(role, text)
+}
+
+// SetTtsRole implements PersonaSetter. An empty role is the default one.
+func (s *lipsyncSayer) SetTtsRole(role string) {
+	if role == "" {
+		role = defaultTtsRole
+	}
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.ttsRole = role
+	s.logger.Info("[lipsyncSayer] SetTtsRole", "ttsRole", role)
+}
+
+// SetExpressions implements PersonaSetter.
+// The expressions are used with LipsyncStrategyAudioAnalyze only.
+func (s *lipsyncSayer) SetExpressions(expressions []string) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.expressions = expressions
+}
+
+// expression returns a random one of the expressions, "" if none.
+func (s *lipsyncSayer) expression() string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	if len(s.expressions) == 0 {
+		return ""
+	}
+	return s.expressions[rand.Intn(len(s.expressions))]
 }
 
 // audioToTrack converts audio to audio.Track locally.
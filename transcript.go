@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"muvtuberdriver/model"
+	"muvtuberdriver/transcript"
+	"os"
+	"strings"
+	"time"
+)
+
+// recordTextIns records every TextIn from ch to the transcript:
+// ch -> (record) -> chOut.
+func recordTextIns(rec *transcript.Recorder, ch chan *model.TextIn) (chOut chan *model.TextIn) {
+	chOut = make(chan *model.TextIn, RecvMsgChanBuf)
+	go func() {
+		defer close(chOut)
+		for textIn := range ch {
+			rec.RecordIn(textIn)
+			chOut <- textIn
+		}
+	}()
+	return chOut
+}
+
+// rejectReporter is a filter that reports the Texts it rejects (drops or
+// replaces), e.g. ModerationFilter. They are recorded as KindReject events.
+type rejectReporter interface {
+	OnReject(fn func(text *model.Text, reason string))
+}
+
+// recordRejects records the Texts rejected by the filter, if it's a
+// rejectReporter, in the chain (in or out).
+func recordRejects(rec *transcript.Recorder, chain, name string, filter any) {
+	if r, ok := filter.(rejectReporter); ok {
+		r.OnReject(func(text *model.Text, reason string) {
+			rec.RecordReject(chain, name, text, reason)
+		})
+	}
+}
+
+// recordedTextInFilter records the TextIns passed the filter.
+type recordedTextInFilter struct {
+	TextInFilter
+	name string
+	rec  *transcript.Recorder
+}
+
+// Close closes the filter if it's an io.Closer. See closeFilters.
+func (f recordedTextInFilter) Close() error {
+	return closeFilters([]TextInFilter{f.TextInFilter})
+}
+
+func (f recordedTextInFilter) FilterTextIn(chIn chan *model.TextIn) (chOut chan *model.TextIn) {
+	passed := f.TextInFilter.FilterTextIn(chIn)
+	chOut = make(chan *model.TextIn, RecvMsgChanBuf)
+	go func() {
+		defer close(chOut)
+		for textIn := range passed {
+			f.rec.RecordFilter("in", f.name, textIn)
+			chOut <- textIn
+		}
+	}()
+	return chOut
+}
+
+// recordedTextOutFilter records the TextOuts passed the filter.
+type recordedTextOutFilter struct {
+	TextOutFilter
+	name string
+	rec  *transcript.Recorder
+}
+
+// Close closes the filter if it's an io.Closer. See closeFilters.
+func (f recordedTextOutFilter) Close() error {
+	return closeFilters([]TextOutFilter{f.TextOutFilter})
+}
+
+func (f recordedTextOutFilter) FilterTextOut(chIn chan *model.TextOut) (chOut chan *model.TextOut) {
+	passed := f.TextOutFilter.FilterTextOut(chIn)
+	chOut = make(chan *model.TextOut, RecvMsgChanBuf)
+	go func() {
+		defer close(chOut)
+		for textOut := range passed {
+			f.rec.RecordFilter("out", f.name, textOut)
+			chOut <- textOut
+		}
+	}()
+	return chOut
+}
+
+// exportMain is the export subcommand: exports the transcripts as
+// prompt/response pairs (JSONL) for fine-tuning. The responses rejected by
+// the TextOut filters (e.g. flagged by the moderation) are never exported.
+//
+//	muvtuberdriver export -dir /app/data/transcript -from 2023-04-01 -to 2023-04-30 -o pairs.jsonl
+func exportMain(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := fs.String("dir", "", "transcript directory (transcript.dir in config)")
+	from := fs.String("from", "", "first day to export: 2006-01-02. Empty for the earliest")
+	to := fs.String("to", "", "last day to export: 2006-01-02. Empty for the latest")
+	out := fs.String("o", "-", "output file, - for stdout")
+	format := fs.String("format", string(transcript.FormatPairs), "output format: pairs ({prompt, response}) | messages ({messages: [user, assistant]})")
+	spoken := fs.Bool("spoken", false, "only the responses actually spoken (not dropped by the TextOut filters)")
+	exclude := fs.String("exclude", "CannedReply,CacheChatbot", "comma separated chatbots (TextOut authors) to exclude")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("export: -dir is required")
+	}
+
+	opts := transcript.ExportOptions{SpokenOnly: *spoken}
+	var err error
+	if opts.From, err = parseDay(*from); err != nil {
+		return fmt.Errorf("export: bad -from: %w", err)
+	}
+	if opts.To, err = parseDay(*to); err != nil {
+		return fmt.Errorf("export: bad -to: %w", err)
+	}
+	for _, b := range strings.Split(*exclude, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			opts.ExcludeBackends = append(opts.ExcludeBackends, b)
+		}
+	}
+
+	var w io.WriteCloser = os.Stdout
+	if *out != "-" {
+		if w, err = os.Create(*out); err != nil {
+			return err
+		}
+	}
+
+	n, err := transcript.Export(*dir, w, transcript.Format(*format), opts)
+	if w != os.Stdout {
+		err = errors.Join(err, w.Close())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d pairs.\n", n)
+	return nil
+}
+
+// parseDay parses 2006-01-02 in local time. Empty for the zero time.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
@@ -0,0 +1,269 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"muvtuberdriver/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// fileNameRegexp matches the transcript file names: day, index.
+var fileNameRegexp = regexp.MustCompile(`^transcript-(\d{4}-\d{2}-\d{2})(?:\.(\d+))?\.jsonl$`)
+
+// transcriptFile is a transcript file found in the directory.
+type transcriptFile struct {
+	path  string
+	day   time.Time
+	index int
+}
+
+// listFiles returns the transcript files of the days in [from, to]
+// (the dates of from and to, in local time) in the order they are written.
+// A zero from or to is unbounded.
+func listFiles(dir string, from, to time.Time) ([]transcriptFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fromDay, toDay := truncateDay(from), truncateDay(to)
+
+	var files []transcriptFile
+	for _, entry := range entries {
+		m := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		day, err := time.ParseInLocation(dayLayout, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && day.Before(fromDay)) || (!to.IsZero() && day.After(toDay)) {
+			continue
+		}
+		index := 0
+		if m[2] != "" {
+			index, _ = strconv.Atoi(m[2])
+		}
+		files = append(files, transcriptFile{path: filepath.Join(dir, entry.Name()), day: day, index: index})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].day.Equal(files[j].day) {
+			return files[i].day.Before(files[j].day)
+		}
+		return files[i].index < files[j].index
+	})
+	return files, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// ReadEvents reads the events of the days in [from, to] from the
+// transcript files in dir, and calls fn with each of them in order.
+// A zero from or to is unbounded. Reading stops if fn returns an error.
+//
+// Malformed lines (e.g. the last line cut off by a crash) are skipped.
+func ReadEvents(dir string, from, to time.Time, fn func(e Event) error) error {
+	files, err := listFiles(dir, from, to)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := readFile(f.path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(e Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for lineno := 1; ; lineno++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var e Event
+			if jsonErr := json.Unmarshal(line, &e); jsonErr != nil {
+				slog.Warn("[transcript] skip malformed line.", "file", path, "line", lineno, "err", jsonErr)
+			} else if fnErr := fn(e); fnErr != nil {
+				return fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Pair is a prompt/response pair exported for fine-tuning.
+type Pair struct {
+	Time     time.Time `json:"time"`
+	Author   string    `json:"author,omitempty"`
+	Backend  string    `json:"backend,omitempty"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+}
+
+// ExportOptions selects the pairs to export.
+type ExportOptions struct {
+	From, To        time.Time // the days to export, inclusive. Zero for unbounded
+	SpokenOnly      bool      // only the responses actually spoken (with a KindSay event of it or its chunks)
+	ExcludeBackends []string  // e.g. CannedReply, CacheChatbot: not worth training on
+}
+
+// Pairs collects the prompt/response pairs from the successful chats
+// in the transcript files in dir.
+//
+// The responses rejected by an out filter (KindReject, e.g. flagged by the
+// moderation and regenerated or replaced by a fallback line) are never
+// exported.
+func Pairs(dir string, opts ExportOptions) ([]Pair, error) {
+	exclude := map[string]bool{}
+	for _, b := range opts.ExcludeBackends {
+		exclude[b] = true
+	}
+
+	type chat struct {
+		Pair
+		id     string // of the response
+		textIn string // ID
+	}
+	var chats []chat
+	var spoken, rejected []Event
+
+	err := ReadEvents(dir, opts.From, opts.To, func(e Event) error {
+		switch e.Kind {
+		case KindSay:
+			spoken = append(spoken, e)
+		case KindReject:
+			if e.Chain == "out" {
+				rejected = append(rejected, e)
+			}
+		case KindChat:
+			if e.Error != "" || e.Text == nil || e.Text.ReplyTo == nil || exclude[e.Backend] {
+				return nil
+			}
+			if e.Text.ReplyTo.Content == "" || e.Text.Content == "" {
+				return nil
+			}
+			chats = append(chats, chat{Pair{
+				Time:     e.Time,
+				Author:   e.Text.ReplyTo.Author,
+				Backend:  e.Backend,
+				Prompt:   e.Text.ReplyTo.Content,
+				Response: e.Text.Content,
+			}, e.ID, e.ReplyTo})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]bool, len(chats))
+	for _, c := range chats {
+		responses[c.id] = true
+	}
+	isSpoken, isRejected := responseSet(spoken, responses), responseSet(rejected, responses)
+
+	var pairs []Pair
+	for _, c := range chats {
+		if isRejected(c.id, c.textIn) {
+			continue
+		}
+		if !opts.SpokenOnly || isSpoken(c.id, c.textIn) {
+			pairs = append(pairs, c.Pair)
+		}
+	}
+	return pairs, nil
+}
+
+// responseSet returns whether a response (id, and the ID of the TextIn it
+// replies to) has any of the (say or reject) events.
+//
+// The event of a chunk counts for the response it's split from (the too_long
+// filter: model.MetaChunkOf is the ID of the response). The chunks streamed
+// (chatbot.ChatSentences) are not split from a recorded response: they count
+// for the response to their TextIn, which is answered only once in streaming.
+func responseSet(events []Event, responses map[string]bool) func(id, textIn string) bool {
+	ids, textIns := map[string]bool{}, map[string]bool{}
+	for _, e := range events {
+		var chunkOf string
+		if e.Text != nil {
+			chunkOf, _ = e.Text.MetaString(model.MetaChunkOf)
+		}
+		switch {
+		case chunkOf == "":
+			ids[e.ID] = true
+		case responses[chunkOf]:
+			ids[chunkOf] = true
+		default:
+			textIns[e.ReplyTo] = true
+		}
+	}
+	return func(id, textIn string) bool {
+		return ids[id] || textIns[textIn]
+	}
+}
+
+// Format is the output format of Export.
+type Format string
+
+const (
+	FormatPairs    Format = "pairs"    // {"prompt": ..., "response": ..., ...}
+	FormatMessages Format = "messages" // {"messages": [{"role": "user", ...}, {"role": "assistant", ...}]}
+)
+
+// Export writes the pairs (see Pairs) to w as JSONL in the format.
+// It returns the number of pairs written.
+func Export(dir string, w io.Writer, format Format, opts ExportOptions) (int, error) {
+	pairs, err := Pairs(dir, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for i, p := range pairs {
+		var v any = p
+		switch format {
+		case FormatPairs, "":
+		case FormatMessages:
+			v = struct {
+				Messages []message `json:"messages"`
+			}{[]message{{"user", p.Prompt}, {"assistant", p.Response}}}
+		default:
+			return 0, errors.New("unknown export format: " + string(format))
+		}
+		if err := encoder.Encode(v); err != nil {
+			return i, err
+		}
+	}
+	return len(pairs), nil
+}
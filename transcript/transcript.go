@@ -0,0 +1,273 @@
+// Package transcript records what happens to the messages as JSONL files:
+// every TextIn received, the filters it passed, the chatbot that answered
+// it and the TextOut, and whether the TextOut was spoken.
+//
+// One event per line, in rotating files in a directory:
+//
+//	transcript-2023-04-01.jsonl
+//	transcript-2023-04-01.1.jsonl   (the first one is full, see WithMaxSize)
+//	transcript-2023-04-02.jsonl
+//
+// The files can be read back with ReadEvents, and exported as
+// prompt/response pairs for fine-tuning with Export.
+package transcript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"muvtuberdriver/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Kind is the kind of an Event.
+type Kind string
+
+const (
+	KindIn     Kind = "in"     // a TextIn is received (before the filters)
+	KindFilter Kind = "filter" // a Text passed a filter
+	KindChat   Kind = "chat"   // the chatbot answered a TextIn (or failed)
+	KindSay    Kind = "say"    // a TextOut is spoken (after the filters)
+	KindReject Kind = "reject" // a filter rejected a Text (e.g. flagged by the moderation): dropped or replaced
+)
+
+// Event is a line in the transcript.
+//
+// A TextIn dropped by a filter has the KindFilter events of the filters
+// before that one only, and a KindReject event if the filter reports it.
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind Kind      `json:"kind"`
+
+	ID      string `json:"id"`                 // the ID of the Text
+	ReplyTo string `json:"reply_to,omitempty"` // the ID of the TextIn a TextOut replies to
+
+	Chain  string `json:"chain,omitempty"`  // filter, reject: in | out
+	Filter string `json:"filter,omitempty"` // filter: the name of the filter passed; reject: the one rejected
+	Reason string `json:"reason,omitempty"` // reject: why
+
+	Backend   string `json:"backend,omitempty"`    // chat: the chatbot that answered (TextOut.Author)
+	LatencyMs int64  `json:"latency_ms,omitempty"` // chat: from the TextIn received to the TextOut generated
+	Error     string `json:"error,omitempty"`      // chat: the error if failed
+
+	// in: the TextIn; chat, say: the TextOut (with the TextIn in reply_to);
+	// reject: the Text as rejected
+	Text *model.Text `json:"text,omitempty"`
+}
+
+// region Recorder
+
+// Recorder writes the events to the rotating JSONL files.
+// It's safe for concurrent use.
+//
+// The Record* methods of a nil *Recorder do nothing, so the callers
+// need not check whether the transcript is enabled.
+type Recorder struct {
+	dir     string
+	maxSize int64 // bytes, 0 for no limit
+
+	mu    sync.Mutex
+	file  *os.File
+	day   string // of the file: 2006-01-02
+	index int    // of the file in the day
+	size  int64  // of the file
+
+	now func() time.Time // for testing
+}
+
+type Option func(r *Recorder)
+
+// WithMaxSize sets the max size (in bytes) of a file: a new file of the
+// same day is started when it's exceeded. Default: 0, no limit.
+func WithMaxSize(bytes int64) Option {
+	return func(r *Recorder) {
+		r.maxSize = bytes
+	}
+}
+
+// Open creates a Recorder writing to the directory.
+// The directory is created if not exists. The events are appended to
+// the existing file of the day if any.
+func Open(dir string, opts ...Option) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		dir: dir,
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// Record writes the event. The Time is set to now if it's zero.
+func (r *Recorder) Record(e Event) error {
+	if r == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = r.now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.rotate(e.Time, int64(len(line))); err != nil {
+		return err
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+// rotate opens the file to write n more bytes at t. r.mu must be held.
+func (r *Recorder) rotate(t time.Time, n int64) error {
+	day := t.Format(dayLayout)
+	full := r.maxSize > 0 && r.size > 0 && r.size+n > r.maxSize
+	if r.file != nil && day == r.day && !full {
+		return nil
+	}
+
+	index := 0
+	if day == r.day && full {
+		index = r.index + 1
+	}
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			slog.Warn("[transcript] close file failed.", "file", r.file.Name(), "err", err)
+		}
+		r.file = nil
+	}
+
+	// skip the full files of the day (e.g. written before a restart)
+	for {
+		name := filepath.Join(r.dir, fileName(day, index))
+		info, err := os.Stat(name)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && (r.maxSize <= 0 || info.Size()+n <= r.maxSize)) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		index++
+	}
+
+	name := filepath.Join(r.dir, fileName(day, index))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.day, r.index, r.size = f, day, index, info.Size()
+	return nil
+}
+
+// Close closes the current file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// record writes the event, logging the error if any.
+func (r *Recorder) record(e Event) {
+	if err := r.Record(e); err != nil {
+		slog.Warn("[transcript] record failed.", "kind", e.Kind, "id", e.ID, "err", err)
+	}
+}
+
+// RecordIn records a TextIn received.
+func (r *Recorder) RecordIn(textIn *model.TextIn) {
+	if r == nil || textIn == nil {
+		return
+	}
+	r.record(Event{Kind: KindIn, ID: textIn.ID, Text: textIn})
+}
+
+// RecordFilter records a Text passed the filter in the chain (in or out).
+func (r *Recorder) RecordFilter(chain, filter string, text *model.Text) {
+	if r == nil || text == nil {
+		return
+	}
+	r.record(Event{Kind: KindFilter, ID: text.ID, ReplyTo: replyToID(text), Chain: chain, Filter: filter})
+}
+
+// RecordReject records a Text rejected by the filter in the chain (in or
+// out): dropped, or replaced (e.g. by a fallback line) after this.
+func (r *Recorder) RecordReject(chain, filter string, text *model.Text, reason string) {
+	if r == nil || text == nil {
+		return
+	}
+	r.record(Event{Kind: KindReject, ID: text.ID, ReplyTo: replyToID(text), Chain: chain, Filter: filter, Reason: reason, Text: text})
+}
+
+// RecordChat records the outcome of a chat: the textOut or the err.
+// It's a chatbot.ChatObserver.
+func (r *Recorder) RecordChat(textIn *model.TextIn, textOut *model.TextOut, err error) {
+	if r == nil || textIn == nil {
+		return
+	}
+	e := Event{Kind: KindChat, ReplyTo: textIn.ID}
+	if textOut != nil {
+		e.ID = textOut.ID
+		e.Backend = textOut.Author
+		e.LatencyMs = textOut.Latency().Milliseconds()
+		e.Text = textOut
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.record(e)
+}
+
+// RecordSay records a TextOut spoken.
+func (r *Recorder) RecordSay(textOut *model.TextOut) {
+	if r == nil || textOut == nil {
+		return
+	}
+	r.record(Event{Kind: KindSay, ID: textOut.ID, ReplyTo: replyToID(textOut), Text: textOut})
+}
+
+func replyToID(t *model.Text) string {
+	if t.ReplyTo == nil {
+		return ""
+	}
+	return t.ReplyTo.ID
+}
+
+// endregion Recorder
+
+const dayLayout = "2006-01-02"
+
+// fileName of the index-th file of the day:
+// transcript-2006-01-02.jsonl, transcript-2006-01-02.1.jsonl, ...
+func fileName(day string, index int) string {
+	if index == 0 {
+		return fmt.Sprintf("transcript-%s.jsonl", day)
+	}
+	return fmt.Sprintf("transcript-%s.%d.jsonl", day, index)
+}
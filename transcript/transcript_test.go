@@ -0,0 +1,140 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"muvtuberdriver/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := Open(dir, WithMaxSize(1200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day1 := time.Date(2023, 4, 1, 20, 0, 0, 0, time.Local)
+	rec.now = func() time.Time { return day1 }
+
+	chat := func(content, reply string, say bool) {
+		textIn := model.NewTextIn(model.SourceDm, "a", content, 0)
+		rec.RecordIn(textIn)
+		rec.RecordFilter("in", "spam", textIn)
+		textOut := textIn.Reply("ChatGPTChatbot", reply)
+		rec.RecordChat(textIn, textOut, nil)
+		if say {
+			rec.RecordSay(textOut)
+		}
+	}
+
+	chat("你好", "你好呀", true)
+	chat("你是谁", "我是 muli", false)
+	rec.RecordChat(model.NewTextIn(model.SourceDm, "b", "在吗", 0), nil, errors.New("all failed"))
+	rec.now = func() time.Time { return day1.Add(24 * time.Hour) }
+	chat("晚安", "晚安~", true)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) < 3 { // day 1 is rotated by size
+		t.Errorf("files = %v, want rotated", files)
+	}
+	for _, f := range files {
+		if info, _ := os.Stat(f); info.Size() > 1200 {
+			t.Errorf("%s: size %d > max size", f, info.Size())
+		}
+	}
+
+	var kinds []string
+	err = ReadEvents(dir, day1, day1, func(e Event) error {
+		kinds = append(kinds, string(e.Kind))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(kinds, ","); got != "in,filter,chat,say,in,filter,chat,chat" {
+		t.Errorf("day 1 events = %v", got)
+	}
+
+	var buf bytes.Buffer
+	n, err := Export(dir, &buf, FormatPairs, ExportOptions{SpokenOnly: true})
+	if err != nil || n != 2 {
+		t.Fatalf("Export() = %v, %v; want 2 spoken pairs", n, err)
+	}
+	if !strings.Contains(buf.String(), `"prompt":"你好","response":"你好呀"`) {
+		t.Errorf("Export() = %s", buf.String())
+	}
+
+	buf.Reset()
+	n, err = Export(dir, &buf, FormatMessages, ExportOptions{From: day1, To: day1, ExcludeBackends: []string{"CannedReply"}})
+	if err != nil || n != 2 {
+		t.Fatalf("Export(day 1) = %v, %v; want 2 pairs", n, err)
+	}
+	if !strings.Contains(buf.String(), `{"messages":[{"role":"user","content":"你是谁"},{"role":"assistant","content":"我是 muli"}]}`) {
+		t.Errorf("Export(messages) = %s", buf.String())
+	}
+}
+
+func TestPairs_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// regenerated: the flagged answer is rejected, the second one spoken
+	textIn := model.NewTextIn(model.SourceDm, "a", "骂我", 0)
+	flagged := textIn.Reply("ChatGPTChatbot", "笨蛋")
+	rec.RecordChat(textIn, flagged, nil)
+	rec.RecordReject("out", "moderation", flagged, "flagged")
+	regenerated := textIn.Reply("ChatGPTChatbot", "才不要")
+	rec.RecordChat(textIn, regenerated, nil)
+	rec.RecordSay(regenerated)
+
+	// fallback: the flagged answer is replaced and spoken with the same ID
+	textIn = model.NewTextIn(model.SourceDm, "b", "打架吗", 0)
+	flagged = textIn.Reply("ChatGPTChatbot", "打架")
+	rec.RecordChat(textIn, flagged, nil)
+	rec.RecordReject("out", "moderation", flagged, "flagged")
+	flagged.Content = "换个话题吧"
+	rec.RecordSay(flagged)
+
+	// split by too_long: a chunk of the answer spoken
+	textIn = model.NewTextIn(model.SourceDm, "c", "讲个故事", 0)
+	long := textIn.Reply("ChatGPTChatbot", "从前有座山。山里有座庙。")
+	rec.RecordChat(textIn, long, nil)
+	chunk := textIn.Reply("ChatGPTChatbot", "从前有座山。")
+	chunk.SetMeta(model.MetaChunkOf, long.ID)
+	rec.RecordSay(chunk)
+
+	// streamed: the chunks are not split from the recorded answer
+	textIn = model.NewTextIn(model.SourceDm, "d", "唱首歌", 0)
+	chunk = textIn.Reply("ChatGPTChatbot", "啦啦啦。")
+	chunk.SetMeta(model.MetaChunkOf, model.NewID())
+	rec.RecordSay(chunk)
+	rec.RecordChat(textIn, textIn.Reply("ChatGPTChatbot", "啦啦啦。"), nil)
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spokenOnly := range []bool{false, true} {
+		pairs, err := Pairs(dir, ExportOptions{SpokenOnly: spokenOnly})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var responses []string
+		for _, p := range pairs {
+			responses = append(responses, p.Response)
+		}
+		if got := strings.Join(responses, ","); got != "才不要,从前有座山。山里有座庙。,啦啦啦。" {
+			t.Errorf("Pairs(spokenOnly=%v) responses = %v", spokenOnly, got)
+		}
+	}
+}